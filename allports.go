@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+var allPorts bool
+
+// The conservative defaults of -all-ports, used unless the flag is given:
+// only connections a day old go, and ssh sessions are never cut
+const (
+	allPortsMaxActiveMin = 24 * 60
+	allPortsNeverTouch   = "sshd"
+)
+
+func init() {
+	flag.BoolVar(&allPorts, "all-ports", false, "Track every TCP connection on the host instead of those on -port, with -max-active 1d and -never-touch sshd unless given; override per port with -scope 'port:N,key=value'")
+}
+
+// setupAllPorts applies the -all-ports defaults to the flags not given
+// explicitly in fs
+func setupAllPorts(fs *flag.FlagSet) error {
+	if !allPorts {
+		return nil
+	}
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	switch {
+	case given["port"]:
+		return fmt.Errorf("-all-ports replaces -port; use -scope 'port:N,...' for per-port thresholds")
+	case discovering():
+		return fmt.Errorf("-all-ports can't be combined with -discover-process or -discover-unit")
+	case protocol != "tcp":
+		return fmt.Errorf("-all-ports only works with -protocol tcp")
+	case healthCheck:
+		return fmt.Errorf("-all-ports has no single service for -health-check to dial")
+	}
+	if !given["max-active"] {
+		maxActiveDurMin = allPortsMaxActiveMin
+	}
+	if !given["never-touch"] {
+		neverTouch = allPortsNeverTouch
+	}
+	sourcePort = "all"
+	return nil
+}
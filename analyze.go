@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+)
+
+var (
+	analyzeMin       int
+	analyzeMarginPct int
+)
+
+func init() {
+	minutesVar(&analyzeMin, "analyze", 0, "Observe for this many minutes without killing, then print suggested thresholds and exit (0 disables)")
+	flag.IntVar(&analyzeMarginPct, "analyze-margin", 20, "Safety margin, in percent, added to the observed p99.5 lifetime when suggesting -max-active")
+}
+
+// printThresholdSuggestion recommends max-active/max-inactive from the lifetimes
+// observed during an -analyze run, as a ready-to-paste configuration snippet
+func printThresholdSuggestion() {
+	// Connections that disappeared but haven't expired yet have ended too; count them now
+	mu.Lock()
+	stillOpen := 0
+	for _, conn := range connections {
+		if conn.Alive() {
+			stillOpen++
+			continue
+		}
+		lifetimes.Observe(conn.LastSeen.Sub(conn.TimeAdded))
+	}
+	mu.Unlock()
+
+	values, n := lifetimes.Percentiles(50, 99.5)
+
+	if jsonOutput && n == 0 {
+		printJSON(outputLine{Type: "analysis", Analysis: &analysisOutput{StillOpen: stillOpen}})
+		return
+	}
+
+	fmt.Printf("\n--- Threshold analysis after %s ---\n", humanMinutes(analyzeMin))
+	if n == 0 {
+		fmt.Printf("No connection ended during the analysis window (%d still open); run -analyze for longer.\n", stillOpen)
+		return
+	}
+
+	p995 := values[1]
+	suggestedActive := int(math.Ceil(p995.Minutes() * float64(100+analyzeMarginPct) / 100))
+	suggestedActive = max(suggestedActive, 2*checkIntervalMin)
+	suggestedInactive := 2 * checkIntervalMin
+
+	if jsonOutput {
+		printJSON(outputLine{Type: "analysis", Analysis: &analysisOutput{
+			Ended:             n,
+			StillOpen:         stillOpen,
+			P50:               values[0].String(),
+			P995:              p995.String(),
+			SuggestedActive:   suggestedActive,
+			SuggestedInactive: suggestedInactive,
+			CurrentTooLow:     p995 > minutes(maxActiveDurMin),
+		}})
+		return
+	}
+
+	fmt.Printf("Observed %d ended connections: p50 %s, p99.5 %s (%d still open)\n", n, humanDuration(values[0]), humanDuration(p995), stillOpen)
+	fmt.Printf("Suggested configuration (p99.5 + %d%% margin, at least two check intervals):\n\n", analyzeMarginPct)
+	fmt.Printf("# .env for docker compose\n")
+	fmt.Printf("CHECK_INTEVAL=%d\nMAX_ACTIVE=%d\nMAX_INACTIVE=%d\n\n", checkIntervalMin, suggestedActive, suggestedInactive)
+	fmt.Printf("# command-line flags\n")
+	fmt.Printf("-check-interval=%s -max-active=%s -max-inactive=%s\n", humanMinutes(checkIntervalMin), humanMinutes(suggestedActive), humanMinutes(suggestedInactive))
+
+	if p995 > minutes(maxActiveDurMin) {
+		fmt.Printf("\nWARNING: the current -max-active=%s would have killed more than 0.5%% of connections that ended on their own.\n", humanMinutes(maxActiveDurMin))
+	}
+}
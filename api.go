@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+var apiAddr string
+
+func init() {
+	flag.StringVar(&apiAddr, "http-addr", "", "Address for the management HTTP server, e.g. 127.0.0.1:9090 (empty disables it)")
+}
+
+// setupAPI starts the management HTTP server when -http-addr is set
+func setupAPI() error {
+	if apiAddr == "" {
+		return nil
+	}
+	if err := loadAPIAuth(); err != nil {
+		return err
+	}
+	tlsConfig, err := apiTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	broadcaster := newEventBroadcaster()
+	sinks = append(sinks, broadcaster)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /events", requireRole(roleRead, broadcaster.ServeHTTP))
+	mux.HandleFunc("GET /connections", requireRole(roleRead, handleConnections))
+	mux.HandleFunc("POST /policy/diff", requireRole(roleRead, handlePolicyDiff))
+	mux.HandleFunc("GET /peers", requireRole(roleRead, handlePeers))
+	mux.HandleFunc("GET /kill-backends", requireRole(roleRead, handleKillBackends))
+	mux.HandleFunc("GET /processes", requireRole(roleRead, handleProcesses))
+	mux.HandleFunc("GET /reputation", requireRole(roleRead, handleReputation))
+	mux.HandleFunc("POST /client-map", requireRole(roleOperator, handleClientMap))
+	mux.HandleFunc("GET /pins", requireRole(roleRead, handlePins))
+	mux.HandleFunc("POST /pins", requireRole(roleOperator, handleAddPins))
+	mux.HandleFunc("DELETE /pins", requireRole(roleOperator, handleDeletePins))
+	mux.HandleFunc("GET /config/history", requireRole(roleRead, handleConfigHistory))
+	mux.HandleFunc("POST /config/rollback", requireRole(roleAdmin, handleConfigRollback))
+
+	listener, err := net.Listen("tcp", apiAddr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", apiAddr, err)
+	}
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         tlsConfig,
+	}
+	go func() {
+		serve := server.Serve
+		if tlsConfig != nil {
+			serve = func(l net.Listener) error { return server.ServeTLS(l, "", "") }
+		}
+		if err := serve(listener); err != nil {
+			log.Printf("Management HTTP server stopped: %v", err)
+		}
+	}()
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	infof("Management API listening on: %s://%s\n", scheme, listener.Addr())
+	if len(apiCallers) > 0 {
+		infof("Management API callers: %d from %s\n", len(apiCallers), apiAuthFile)
+	}
+	return nil
+}
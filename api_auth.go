@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	apiAuthFile  string
+	apiTLSCert   string
+	apiTLSKey    string
+	apiClientCA  string
+	apiAuditFile string
+)
+
+func init() {
+	flag.StringVar(&apiAuthFile, "api-auth", "", "File of API callers, one '<role> <name> token:<secret>|cert:<common name>' per line; roles are read, operator and admin (empty leaves the API open)")
+	flag.StringVar(&apiTLSCert, "api-tls-cert", "", "Certificate file for serving the management API over TLS")
+	flag.StringVar(&apiTLSKey, "api-tls-key", "", "Key file for -api-tls-cert")
+	flag.StringVar(&apiClientCA, "api-client-ca", "", "CA file verifying client certificates, for cert: callers in -api-auth")
+	flag.StringVar(&apiAuditFile, "api-audit-log", "", "File every mutating API call is appended to as a JSON line, with the caller (default: the log)")
+}
+
+// apiRole is what a caller may do; each role includes the ones below it
+type apiRole int
+
+const (
+	roleRead     apiRole = iota + 1 // GET endpoints and previews
+	roleOperator                    // kills, exemptions and client mappings
+	roleAdmin                       // policy changes
+)
+
+var apiRoleNames = map[string]apiRole{"read": roleRead, "operator": roleOperator, "admin": roleAdmin}
+
+func (r apiRole) String() string {
+	for name, role := range apiRoleNames {
+		if role == r {
+			return name
+		}
+	}
+	return "none"
+}
+
+// apiCaller is one line of -api-auth
+type apiCaller struct {
+	name  string
+	role  apiRole
+	token string // set for token: callers
+	cert  string // common name, for cert: callers
+}
+
+var apiCallers []apiCaller
+
+// loadAPIAuth reads -api-auth and checks the TLS flags
+func loadAPIAuth() error {
+	if (apiTLSCert == "") != (apiTLSKey == "") {
+		return fmt.Errorf("-api-tls-cert and -api-tls-key go together")
+	}
+	if apiClientCA != "" && apiTLSCert == "" {
+		return fmt.Errorf("-api-client-ca needs -api-tls-cert")
+	}
+	if apiAuthFile == "" {
+		return nil
+	}
+	f, err := os.Open(apiAuthFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return fmt.Errorf("%s: invalid line %q: want '<role> <name> token:<secret>|cert:<common name>'", apiAuthFile, line)
+		}
+		role, ok := apiRoleNames[fields[0]]
+		if !ok {
+			return fmt.Errorf("%s: unknown role %q: must be read, operator or admin", apiAuthFile, fields[0])
+		}
+		caller := apiCaller{name: fields[1], role: role}
+		kind, value, _ := strings.Cut(fields[2], ":")
+		switch {
+		case kind == "token" && value != "":
+			caller.token = value
+		case kind == "cert" && value != "":
+			if apiClientCA == "" {
+				return fmt.Errorf("%s: caller %s authenticates by certificate, which needs -api-client-ca", apiAuthFile, caller.name)
+			}
+			caller.cert = value
+		default:
+			return fmt.Errorf("%s: invalid credential for %s: want token:<secret> or cert:<common name>", apiAuthFile, caller.name)
+		}
+		apiCallers = append(apiCallers, caller)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(apiCallers) == 0 {
+		return fmt.Errorf("%s lists no callers", apiAuthFile)
+	}
+	return nil
+}
+
+// apiTLSConfig returns the server TLS config, or nil to serve plain HTTP
+func apiTLSConfig() (*tls.Config, error) {
+	if apiTLSCert == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(apiTLSCert, apiTLSKey)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if apiClientCA != "" {
+		pem, err := os.ReadFile(apiClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", apiClientCA)
+		}
+		// Token callers may come without a certificate
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// identify returns the caller making r. Without -api-auth everyone is an
+// anonymous admin, as before roles existed.
+func identify(r *http.Request) (apiCaller, bool) {
+	if len(apiCallers) == 0 {
+		return apiCaller{name: "anonymous", role: roleAdmin}, true
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for _, c := range apiCallers {
+			if c.token != "" && subtle.ConstantTimeCompare([]byte(c.token), []byte(token)) == 1 {
+				return c, true
+			}
+		}
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		for _, c := range apiCallers {
+			if c.cert != "" && c.cert == cn {
+				return c, true
+			}
+		}
+	}
+	return apiCaller{}, false
+}
+
+// statusRecorder remembers the status a handler answered with
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps /events streaming through the recorder
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// requireRole wraps h so only callers holding role reach it. Calls that may
+// change something (anything but GET) are audited, refused ones included.
+func requireRole(role apiRole, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		caller, ok := identify(r)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		switch {
+		case !ok:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="deadsocketdropper"`)
+			http.Error(rec, "authentication required", http.StatusUnauthorized)
+		case caller.role < role:
+			http.Error(rec, fmt.Sprintf("%s needs the %s role, %s has %s", r.URL.Path, role, caller.name, caller.role), http.StatusForbidden)
+		default:
+			h(rec, r)
+		}
+		if r.Method != http.MethodGet {
+			audit(caller, r, rec.status)
+		}
+	}
+}
+
+// auditEntry is one line of -api-audit-log
+type auditEntry struct {
+	Time   time.Time `json:"time"`
+	Caller string    `json:"caller"`
+	Role   string    `json:"role"`
+	Remote string    `json:"remote"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Status int       `json:"status"`
+}
+
+var auditMu sync.Mutex
+
+// audit records a mutating call
+func audit(caller apiCaller, r *http.Request, status int) {
+	entry := auditEntry{
+		Time:   clock.Now(),
+		Caller: caller.name,
+		Role:   caller.role.String(),
+		Remote: r.RemoteAddr,
+		Method: r.Method,
+		Path:   r.URL.RequestURI(),
+		Status: status,
+	}
+	if entry.Caller == "" {
+		entry.Caller = "unauthenticated"
+	}
+	if apiAuditFile == "" {
+		log.Printf("Audit: %s (%s) from %s: %s %s -> %d", entry.Caller, entry.Role, entry.Remote, entry.Method, entry.Path, entry.Status)
+		return
+	}
+	data, _ := json.Marshal(entry)
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, err := os.OpenFile(apiAuditFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		log.Printf("Error writing audit log %s: %v", apiAuditFile, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Printf("Error writing audit log %s: %v", apiAuditFile, err)
+	}
+}
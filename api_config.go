@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// handleConfigHistory returns the kept configurations of the live flags,
+// oldest first
+func handleConfigHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshotConfigHistory())
+}
+
+// handleConfigRollback queues the configuration of ?version=N; it takes
+// effect before the next cycle
+func handleConfigRollback(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(r.URL.Query().Get("version"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid version %q", r.URL.Query().Get("version")), http.StatusBadRequest)
+		return
+	}
+	v, err := rollbackConfig(version)
+	if err != nil {
+		status := http.StatusNotFound
+		if errorClass(err) == "config" {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(v)
+}
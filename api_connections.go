@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Snapshot tokens let a client page through one consistent copy of a large
+// tracker: ?snapshot=new copies it and returns a token in X-Snapshot-Token,
+// and later pages pass ?snapshot=<token> instead of copying again.
+const (
+	snapshotTTL  = 5 * time.Minute // since the snapshot was last read
+	maxSnapshots = 4               // copies of 200k connections aren't small
+)
+
+// connSnapshot is a frozen copy of the tracked connections
+type connSnapshot struct {
+	conns    []*ConnectionInfo
+	taken    time.Time
+	lastUsed time.Time
+}
+
+var (
+	snapshots   = make(map[string]*connSnapshot)
+	snapshotsMu sync.Mutex
+)
+
+// takeSnapshot copies the tracked connections; mu is only held for the copy
+func takeSnapshot() []*ConnectionInfo {
+	mu.Lock()
+	defer mu.Unlock()
+	snapshot := make([]*ConnectionInfo, 0, len(connections))
+	for _, conn := range connections {
+		c := *conn
+		snapshot = append(snapshot, &c)
+	}
+	return snapshot
+}
+
+// storeSnapshot keeps snap under a new token, evicting expired snapshots and,
+// past maxSnapshots, the least recently read one
+func storeSnapshot(snap *connSnapshot) string {
+	var b [16]byte
+	rand.Read(b[:])
+	token := hex.EncodeToString(b[:])
+
+	snapshotsMu.Lock()
+	defer snapshotsMu.Unlock()
+	for t, s := range snapshots {
+		if snap.taken.Sub(s.lastUsed) > snapshotTTL {
+			delete(snapshots, t)
+		}
+	}
+	for len(snapshots) >= maxSnapshots {
+		oldest := ""
+		for t, s := range snapshots {
+			if oldest == "" || s.lastUsed.Before(snapshots[oldest].lastUsed) {
+				oldest = t
+			}
+		}
+		delete(snapshots, oldest)
+	}
+	snapshots[token] = snap
+	return token
+}
+
+// loadSnapshot returns the snapshot of token unless it expired
+func loadSnapshot(token string, now time.Time) (*connSnapshot, bool) {
+	snapshotsMu.Lock()
+	defer snapshotsMu.Unlock()
+	snap, ok := snapshots[token]
+	if !ok || now.Sub(snap.lastUsed) > snapshotTTL {
+		delete(snapshots, token)
+		return nil, false
+	}
+	snap.lastUsed = now
+	return snap, true
+}
+
+// handleConnections returns a snapshot of the tracked connections, oldest
+// first unless ?sort says otherwise. The query parameters of connFilterKeys
+// filter and page it; X-Total-Count carries the number that matched before
+// paging, and X-Next-Offset the offset of the next page when there is one.
+// ?since asks for changes instead, see handleConnectionsSince.
+func handleConnections(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if since := query.Get("since"); since != "" {
+		handleConnectionsSince(w, since)
+		return
+	}
+	filter, err := parseConnFilter(query.Get)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := clock.Now()
+	snap := &connSnapshot{taken: now, lastUsed: now}
+	switch token := query.Get("snapshot"); token {
+	case "":
+		snap.conns = takeSnapshot()
+	case "new":
+		snap.conns = takeSnapshot()
+		w.Header().Set("X-Snapshot-Token", storeSnapshot(snap))
+	default:
+		var ok bool
+		if snap, ok = loadSnapshot(token, now); !ok {
+			http.Error(w, "unknown or expired snapshot, start over with ?snapshot=new", http.StatusGone)
+			return
+		}
+		w.Header().Set("X-Snapshot-Token", token)
+	}
+
+	// Ages are measured at the snapshot, so every page agrees on them
+	page, matched := filter.apply(snap.conns, snap.taken)
+	body := make([]ConnectionInfo, 0, len(page))
+	for _, conn := range page {
+		body = append(body, *conn)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(matched))
+	w.Header().Set("X-Snapshot-Time", snap.taken.UTC().Format(time.RFC3339))
+	if next := filter.offset + len(page); filter.limit > 0 && next < matched {
+		w.Header().Set("X-Next-Offset", strconv.Itoa(next))
+	}
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// changeLogKeep bounds the removals remembered for GET /connections?since;
+// a cursor older than the oldest one kept must resync from since=0
+const changeLogKeep = 10000
+
+// removal is a connection that left the tracker
+type removal struct {
+	Inode        string `json:"inode"`
+	Host         string `json:"host,omitempty"`
+	ConnectionID string `json:"connection"`
+	seq          uint64
+}
+
+// changeEntry is what the change log knows of one tracked connection
+type changeEntry struct {
+	added   uint64 // cycle it was first seen in
+	changed uint64 // cycle it last changed in
+	sum     uint64 // fingerprint of its JSON form
+	removal removal
+}
+
+// changeLog numbers tracker changes for delta readers. Each cycle is one
+// sequence number.
+var changeLog = struct {
+	sync.Mutex
+	epoch    string // tells cursors from before a restart apart
+	seq      uint64
+	tracked  map[string]*changeEntry
+	removed  []removal
+	lostUpTo uint64 // removals at or below this were dropped
+}{
+	epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+	tracked: make(map[string]*changeEntry),
+}
+
+// connDelta is the body of GET /connections?since
+type connDelta struct {
+	Cursor  string           `json:"cursor"`
+	Added   []ConnectionInfo `json:"added"`
+	Updated []ConnectionInfo `json:"updated"`
+	Removed []removal        `json:"removed"`
+}
+
+// recordChanges compares the tracker with the previous cycle and numbers what
+// was added, changed or removed. Called at the end of a cycle with mu held.
+func recordChanges() {
+	if apiAddr == "" {
+		return
+	}
+	changeLog.Lock()
+	defer changeLog.Unlock()
+	changeLog.seq++
+	seq := changeLog.seq
+
+	for key, conn := range connections {
+		data, _ := json.Marshal(conn)
+		h := fnv.New64a()
+		h.Write(data)
+		sum := h.Sum64()
+		entry, ok := changeLog.tracked[key]
+		if !ok {
+			entry = &changeEntry{added: seq}
+			changeLog.tracked[key] = entry
+		} else if entry.sum == sum {
+			continue
+		}
+		entry.changed, entry.sum = seq, sum
+		entry.removal = removal{Inode: conn.Inode, Host: conn.Host, ConnectionID: conn.ConnectionID}
+	}
+	for key, entry := range changeLog.tracked {
+		if _, ok := connections[key]; ok {
+			continue
+		}
+		r := entry.removal
+		r.seq = seq
+		changeLog.removed = append(changeLog.removed, r)
+		delete(changeLog.tracked, key)
+	}
+	if drop := len(changeLog.removed) - changeLogKeep; drop > 0 {
+		changeLog.lostUpTo = changeLog.removed[drop-1].seq
+		changeLog.removed = append(changeLog.removed[:0:0], changeLog.removed[drop:]...)
+	}
+}
+
+// parseCursor splits an "<epoch>.<seq>" cursor; "0" is the start
+func parseCursor(cursor string) (epoch string, seq uint64, err error) {
+	if cursor == "0" {
+		return "", 0, nil
+	}
+	epoch, s, ok := strings.Cut(cursor, ".")
+	if ok {
+		seq, err = strconv.ParseUint(s, 10, 64)
+	}
+	if !ok || err != nil {
+		return "", 0, fmt.Errorf("invalid cursor %q", cursor)
+	}
+	return epoch, seq, nil
+}
+
+// handleConnectionsSince serves GET /connections?since=<cursor>: the
+// connections added, updated and removed since the cursor, and the cursor to
+// ask with next time. since=0 returns every tracked connection as added. A
+// cursor from before a restart, or older than the removals kept, gets 410 and
+// must start over from 0.
+func handleConnectionsSince(w http.ResponseWriter, since string) {
+	epoch, seq, err := parseCursor(since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	delta := connDelta{Added: []ConnectionInfo{}, Updated: []ConnectionInfo{}, Removed: []removal{}}
+	mu.Lock()
+	changeLog.Lock()
+	if seq > 0 && (epoch != changeLog.epoch || seq > changeLog.seq || seq < changeLog.lostUpTo) {
+		changeLog.Unlock()
+		mu.Unlock()
+		http.Error(w, "cursor expired, start over with since=0", http.StatusGone)
+		return
+	}
+	delta.Cursor = changeLog.epoch + "." + strconv.FormatUint(changeLog.seq, 10)
+	for key, conn := range connections {
+		entry, ok := changeLog.tracked[key]
+		switch {
+		case seq == 0:
+			delta.Added = append(delta.Added, *conn)
+		case !ok || entry.changed <= seq:
+			// Unchanged, or not numbered until the running cycle ends
+		case entry.added > seq:
+			delta.Added = append(delta.Added, *conn)
+		default:
+			delta.Updated = append(delta.Updated, *conn)
+		}
+	}
+	for _, r := range changeLog.removed {
+		if seq > 0 && r.seq > seq {
+			delta.Removed = append(delta.Removed, r)
+		}
+	}
+	changeLog.Unlock()
+	mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delta)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// handlePeers returns the peers on the escalation ladder, highest rung first
+func handlePeers(w http.ResponseWriter, r *http.Request) {
+	peers := snapshotPeers()
+	sort.Slice(peers, func(a, b int) bool {
+		if peers[a].Rung != peers[b].Rung {
+			return peers[a].Rung > peers[b].Rung
+		}
+		return peers[a].Peer < peers[b].Peer
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(peers)
+}
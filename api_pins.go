@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// pinFileMu serializes edits of -pin-file through the API
+var pinFileMu sync.Mutex
+
+// handlePins returns the pins of -pin-file, match key -> reason
+func handlePins(w http.ResponseWriter, r *http.Request) {
+	if pinFile == "" {
+		http.Error(w, "pinning needs -pin-file", http.StatusConflict)
+		return
+	}
+	pinFileMu.Lock()
+	pins, err := loadPins(pinFile)
+	pinFileMu.Unlock()
+	if errors.Is(err, fs.ErrNotExist) {
+		pins, err = map[string]string{}, nil
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pins)
+}
+
+// handleAddPins pins the '<inode|peer-ip|peer-ip:port> <reason>' lines of
+// the body, replacing the reason of keys already pinned
+func handleAddPins(w http.ResponseWriter, r *http.Request) {
+	if pinFile == "" {
+		http.Error(w, "pinning needs -pin-file", http.StatusConflict)
+		return
+	}
+	added, err := parsePins(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil || len(added) == 0 {
+		http.Error(w, "want '<inode|peer-ip|peer-ip:port> <reason>' lines", http.StatusBadRequest)
+		return
+	}
+	if _, err := editPinFile(added, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%d pins added\n", len(added))
+}
+
+// handleDeletePins unpins the keys given as ?key=
+func handleDeletePins(w http.ResponseWriter, r *http.Request) {
+	if pinFile == "" {
+		http.Error(w, "pinning needs -pin-file", http.StatusConflict)
+		return
+	}
+	remove := make(map[string]bool)
+	for _, key := range r.URL.Query()["key"] {
+		remove[key] = true
+	}
+	if len(remove) == 0 {
+		http.Error(w, "want ?key=<inode|peer-ip|peer-ip:port>", http.StatusBadRequest)
+		return
+	}
+	removed, err := editPinFile(nil, remove)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%d pins removed\n", removed)
+}
+
+// editPinFile sets and removes pins in -pin-file, keeping its comments and
+// order, then applies the result to the tracked connections right away. The
+// file is replaced atomically, so the monitor never reads half of it. It
+// returns how many pins were removed.
+func editPinFile(set map[string]string, remove map[string]bool) (int, error) {
+	pinFileMu.Lock()
+	defer pinFileMu.Unlock()
+
+	data, err := os.ReadFile(pinFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	var b strings.Builder
+	removed := 0
+	written := make(map[string]bool)
+	for line := range strings.Lines(string(data)) {
+		trimmed := strings.TrimSpace(line)
+		key, _, _ := strings.Cut(trimmed, " ")
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			if remove[key] {
+				removed++
+				continue
+			}
+			if reason, ok := set[key]; ok {
+				line = key + " " + reason + "\n"
+				written[key] = true
+			}
+		}
+		b.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	var keys []string
+	for key := range set {
+		if !written[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s %s\n", key, set[key])
+	}
+
+	mode := fs.FileMode(0644)
+	if info, err := os.Stat(pinFile); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(pinFile), "."+filepath.Base(pinFile)+".*")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), pinFile); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+
+	mu.Lock()
+	applyPins(readPins())
+	mu.Unlock()
+	return removed, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+// policyDiffEntry is a tracked connection that the proposed policy would newly kill
+type policyDiffEntry struct {
+	Inode        string    `json:"inode"`
+	ConnectionID string    `json:"connection"`
+	TimeAdded    time.Time `json:"time_added"`
+	AgeMinutes   float64   `json:"age_minutes"`
+	Reason       string    `json:"reason"`
+}
+
+// handlePolicyDiff evaluates a proposed config document, in the format of
+// -consul-key, against the tracked set and reports the connections that would
+// newly become kill candidates, with the reason the proposed policy gives.
+// Flags the document leaves out fall back to their command-line values, as
+// they would if it were applied.
+func handlePolicyDiff(w http.ResponseWriter, r *http.Request) {
+	doc, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	values, err := parseConfigDoc(string(doc))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mu.Lock()
+	now := clock.Now()
+	current, currentConfig := policyVerdicts(now), liveConfig()
+	var proposed map[string]KillReason
+	var proposedConfig map[string]string
+	err = withLiveConfig(values, func() {
+		proposed, proposedConfig = policyVerdicts(now), liveConfig()
+	})
+	newlyKilled := []policyDiffEntry{}
+	for inode, reason := range proposed {
+		if _, ok := current[inode]; ok {
+			continue
+		}
+		conn := connections[inode]
+		newlyKilled = append(newlyKilled, policyDiffEntry{
+			Inode:        inode,
+			ConnectionID: conn.ConnectionID,
+			TimeAdded:    conn.TimeAdded,
+			AgeMinutes:   now.Sub(conn.TimeAdded).Minutes(),
+			Reason:       reason.String(),
+		})
+	}
+	tracked := len(connections)
+	mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"current":             currentConfig,
+		"proposed":            proposedConfig,
+		"tracked":             tracked,
+		"new_kill_candidates": newlyKilled,
+	})
+}
+
+// policyVerdicts returns the reason each tracked connection is a kill
+// candidate for under the live thresholds, judged as the monitor loop judges
+// it: under its scope, reputation and the pressure and flood overrides, with
+// every interval policy due. Pinned and protected connections, and those
+// whose kill is already under way, are left out. Must be called with mu held.
+func policyVerdicts(now time.Time) map[string]KillReason {
+	due := make(map[string]bool, len(intervalPolicies))
+	for _, name := range intervalPolicies {
+		due[name] = true
+	}
+	limit := lastActiveLimit()
+	verdicts := make(map[string]KillReason)
+	for inode, conn := range connections {
+		switch conn.State {
+		case StateKillPending, StateKillRetry, StateKillAbandoned:
+			continue
+		}
+		if conn.Pinned {
+			continue
+		}
+		if _, ok := protected.protects(conn); ok {
+			continue
+		}
+		if reason, ok := thresholdReason(conn, now, policyFor(conn, limit), due); ok {
+			verdicts[inode] = reason
+		}
+	}
+	return verdicts
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// handleProcesses returns the tracked connections per owning process, busiest first
+func handleProcesses(w http.ResponseWriter, r *http.Request) {
+	procs := snapshotProcesses()
+	sort.Slice(procs, func(a, b int) bool {
+		if procs[a].Tracked != procs[b].Tracked {
+			return procs[a].Tracked > procs[b].Tracked
+		}
+		return procs[a].PID < procs[b].PID
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(procs)
+}
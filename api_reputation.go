@@ -0,0 +1,21 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// handleReputation returns the score of every peer with a history, worst first
+func handleReputation(w http.ResponseWriter, r *http.Request) {
+	peers := snapshotReputations(clock.Now())
+	sort.Slice(peers, func(a, b int) bool {
+		if peers[a].Score != peers[b].Score {
+			return peers[a].Score < peers[b].Score
+		}
+		return peers[a].Peer < peers[b].Peer
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(peers)
+}
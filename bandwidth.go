@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+var (
+	maxTransferMB     int
+	maxThroughputKBps int
+	throughputMin     int
+)
+
+func init() {
+	flag.IntVar(&maxTransferMB, "max-transfer", 0, "Kill connections that have moved more than this many MB in total, sent plus received (0 disables)")
+	flag.IntVar(&maxThroughputKBps, "max-throughput", 0, "Kill connections sustaining more than this many KB/s, sent plus received, for -throughput-window minutes (0 disables)")
+	minutesVar(&throughputMin, "throughput-window", 60, "Minutes -max-throughput must be exceeded without interruption before a kill")
+}
+
+// updateThroughputSince tracks how long the connection's throughput has stayed
+// above limitKBps; must run after updateTraffic
+func (c *ConnectionInfo) updateThroughputSince(now time.Time, limitKBps int) {
+	switch {
+	case limitKBps <= 0 || c.SendRate+c.RecvRate <= float64(limitKBps)*1024:
+		c.ThroughputSince = time.Time{}
+	case c.ThroughputSince.IsZero():
+		c.ThroughputSince = now
+	}
+}
+
+// bandwidthReason returns the reason to kill a connection over its transfer
+// quota or sustained throughput limit, if any
+func bandwidthReason(conn *ConnectionInfo, now time.Time, policy Policy) (KillReason, bool) {
+	if policy.MaxTransfer > 0 && conn.BytesSent+conn.BytesReceived > int64(policy.MaxTransfer)<<20 {
+		return KillReason{ReasonTransferQuota, fmt.Sprintf("moved %s, quota %d MB",
+			humanBytes(conn.BytesSent+conn.BytesReceived), policy.MaxTransfer)}, true
+	}
+	if policy.MaxThroughput > 0 && !conn.ThroughputSince.IsZero() &&
+		now.Sub(conn.ThroughputSince) > minutes(throughputMin) {
+		return KillReason{ReasonThroughput, fmt.Sprintf("above %d KB/s for more than %s", policy.MaxThroughput, humanMinutes(throughputMin))}, true
+	}
+	return KillReason{}, false
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// runBench implements 'bench': it feeds synthetic ss listings through the
+// parser, the tracker and the policies, as a dry run with a manual clock, and
+// reports throughput and allocations. No ss, root or live traffic is needed,
+// so performance changes can be compared between builds on any machine.
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	lines := fs.Int("lines", 100000, "Connections in each synthetic listing (10000 to 1000000 is typical)")
+	cycles := fs.Int("cycles", 10, "Monitoring cycles to run; the clock advances -check-interval between them, so later cycles hit max-active")
+	churn := fs.Float64("churn", 5, "Percent of connections replaced by new ones every cycle")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *lines < 1 || *cycles < 1 || *churn < 0 || *churn > 100 {
+		return fmt.Errorf("-lines and -cycles must be at least 1, -churn within 0-100")
+	}
+
+	// Everything the daemon would print or run is switched off or faked
+	dryRun, jsonOutput = true, true
+	listOwners = true
+	fake := &benchRunner{}
+	runner = fake
+	ssFormats[""] = &ssFormat{Version: "bench", NoHeader: true, StateCol: 0, LocalCol: 3, PeerCol: 4}
+	manual := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	clock = manual
+	interval := minutes(checkIntervalMin)
+
+	fmt.Printf("Synthetic listing: %d connections, %d cycles, %g%% churn, -max-active %s, -check-interval %s\n\n",
+		*lines, *cycles, *churn, humanMinutes(maxActiveDurMin), humanMinutes(checkIntervalMin))
+	fmt.Printf("%-6s %-11s %12s %14s %13s %12s %9s %8s %8s\n", "cycle", "phase", "time", "lines/s", "allocs/line", "bytes/line", "tracked", "new", "expired")
+
+	var parse, full benchResult
+	for c := range *cycles {
+		fake.listing = benchListing(*lines, c, *churn)
+
+		r := measure(*lines, func() {
+			conns, err := listConnectionsFrom(context.Background(), "", "")
+			if err == nil {
+				releaseConns(conns)
+			}
+		})
+		parse.add(r)
+		fmt.Printf("%-6d %-11s %12s %14.0f %13.1f %12.0f\n", c+1, "parse", r.elapsed.Round(time.Microsecond), r.rate(), r.allocsPer(), r.bytesPer())
+
+		var stats CycleStats
+		r = measure(*lines, func() { stats = monitorConnections() })
+		full.add(r)
+		fmt.Printf("%-6d %-11s %12s %14.0f %13.1f %12.0f %9d %8d %8d\n", c+1, "full cycle", r.elapsed.Round(time.Microsecond), r.rate(), r.allocsPer(), r.bytesPer(), stats.Tracked, stats.New, stats.Expired)
+
+		manual.Advance(interval)
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	fmt.Printf("\nAverage parse:      %s per cycle, %.0f lines/s, %.1f allocs and %.0f bytes per line\n",
+		parse.mean().elapsed.Round(time.Microsecond), parse.rate(), parse.allocsPer(), parse.bytesPer())
+	fmt.Printf("Average full cycle: %s per cycle, %.0f lines/s, %.1f allocs and %.0f bytes per line\n",
+		full.mean().elapsed.Round(time.Microsecond), full.rate(), full.allocsPer(), full.bytesPer())
+	fmt.Printf("Heap in use at the end: %s (Go %s, %s/%s, GOMAXPROCS %d)\n",
+		humanBytes(int64(mem.HeapInuse)), runtime.Version(), runtime.GOOS, runtime.GOARCH, runtime.GOMAXPROCS(0))
+	return nil
+}
+
+// benchResult is the cost of processing some number of listing lines
+type benchResult struct {
+	lines   int
+	runs    int
+	elapsed time.Duration
+	mallocs uint64
+	bytes   uint64
+}
+
+// measure runs f once and returns what it cost
+func measure(lines int, f func()) benchResult {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	f()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	return benchResult{
+		lines:   lines,
+		runs:    1,
+		elapsed: elapsed,
+		mallocs: after.Mallocs - before.Mallocs,
+		bytes:   after.TotalAlloc - before.TotalAlloc,
+	}
+}
+
+func (b *benchResult) add(r benchResult) {
+	b.lines += r.lines
+	b.runs += r.runs
+	b.elapsed += r.elapsed
+	b.mallocs += r.mallocs
+	b.bytes += r.bytes
+}
+
+func (b benchResult) mean() benchResult {
+	b.elapsed /= time.Duration(max(b.runs, 1))
+	return b
+}
+
+func (b benchResult) rate() float64 {
+	return float64(b.lines) / max(b.elapsed.Seconds(), 1e-9)
+}
+
+func (b benchResult) allocsPer() float64 { return float64(b.mallocs) / float64(max(b.lines, 1)) }
+func (b benchResult) bytesPer() float64  { return float64(b.bytes) / float64(max(b.lines, 1)) }
+
+// benchListing builds an 'ss -tnpeoiH' listing of n established connections
+// for cycle. Every cycle the first churn percent of them are replaced with new
+// sockets, and half of them move some traffic.
+func benchListing(n, cycle int, churn float64) []byte {
+	replaced := int(float64(n) * churn / 100)
+	var b bytes.Buffer
+	b.Grow(n * 400)
+	line := make([]byte, 0, 512)
+	for i := range n {
+		inode := 1000000 + i
+		if i < replaced {
+			inode += n * cycle
+		}
+		sent := int64(4096)
+		if i%2 == 0 {
+			sent += int64(cycle) * 1500
+		}
+		line = line[:0]
+		line = append(line, "ESTAB 0 0 10.0.0.1:50090 "...)
+		line = appendBenchPeer(line, i)
+		line = append(line, ` users:(("svc",pid=`...)
+		line = strconv.AppendInt(line, int64(1000+i%64), 10)
+		line = append(line, ",fd="...)
+		line = strconv.AppendInt(line, int64(10+i%60000), 10)
+		line = append(line, ")) timer:(keepalive,52sec,0) uid:1000 ino:"...)
+		line = strconv.AppendInt(line, int64(inode), 10)
+		line = append(line, " sk:1 cgroup:/ <->\n\t ts sack cubic wscale:7,7 rto:204 rtt:0.52/0.11 mss:1448 cwnd:10 bytes_sent:"...)
+		line = strconv.AppendInt(line, sent, 10)
+		line = append(line, " bytes_acked:"...)
+		line = strconv.AppendInt(line, sent, 10)
+		line = append(line, " bytes_received:2048 segs_out:"...)
+		line = strconv.AppendInt(line, sent/1448+1, 10)
+		line = append(line, " segs_in:3 data_segs_out:2 lastsnd:1000 lastrcv:1000 lastack:1000 snd_wnd:65536\n"...)
+		b.Write(line)
+	}
+	return b.Bytes()
+}
+
+// appendBenchPeer appends a distinct peer address for connection i
+func appendBenchPeer(b []byte, i int) []byte {
+	b = append(b, "172."...)
+	b = strconv.AppendInt(b, int64(16+(i>>24)&15), 10)
+	b = append(b, '.')
+	b = strconv.AppendInt(b, int64(i>>16&255), 10)
+	b = append(b, '.')
+	b = strconv.AppendInt(b, int64(i>>8&255), 10)
+	b = append(b, ':')
+	return strconv.AppendInt(b, int64(1024+(i&255)*200), 10)
+}
+
+// benchRunner stands in for ss: listings come from the synthetic buffer and
+// every other command succeeds without output
+type benchRunner struct {
+	listing []byte
+}
+
+func (r *benchRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if slices.Contains(args, "-V") {
+		return []byte("ss utility, iproute2-bench\n"), nil
+	}
+	return nil, nil
+}
+
+func (r *benchRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return nil, nil
+}
+
+func (r *benchRunner) Exchange(ctx context.Context, input []byte, name string, args ...string) ([]byte, error) {
+	return nil, nil
+}
+
+func (r *benchRunner) Stream(ctx context.Context, name string, args ...string) (io.Reader, func() error, error) {
+	return bytes.NewReader(r.listing), func() error { return nil }, nil
+}
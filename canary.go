@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+)
+
+var (
+	canarySettings string
+	canaryPercent  int
+	canaryMinutes  int
+)
+
+func init() {
+	flag.StringVar(&canarySettings, "canary", "", "Trial a stricter policy, e.g. 'max-active=30,max-persist=5' (keys as in -scope): it kills only within -canary-percent of peers and logs would-kill decisions for the rest, then reports the difference")
+	flag.IntVar(&canaryPercent, "canary-percent", 10, "Percentage of peers, picked by a hash of the peer IP, that -canary applies to")
+	minutesVar(&canaryMinutes, "canary-minutes", 1440, "Length of the -canary trial in minutes")
+}
+
+// canary is the state of the -canary trial. Guarded by mu.
+var canary struct {
+	scope   policyScope
+	until   time.Time
+	done    bool
+	inGroup map[string]bool // tracked connections evaluated, by key, and whether they are in the canary group
+	flagged map[string]bool // tracked connections the canary policy killed or would have killed
+	gone    canaryTally     // outcomes of evaluated connections that have left the tracker
+}
+
+// canaryTally counts the connections the -canary trial evaluated
+type canaryTally struct {
+	group, others, kills, would int
+}
+
+func (t *canaryTally) add(in, flagged bool) {
+	switch {
+	case in && flagged:
+		t.kills++
+	case flagged:
+		t.would++
+	}
+	if in {
+		t.group++
+	} else {
+		t.others++
+	}
+}
+
+// setupCanary parses -canary and starts the trial
+func setupCanary() error {
+	if canarySettings == "" {
+		return nil
+	}
+	if canaryPercent < 1 || canaryPercent > 100 {
+		return fmt.Errorf("-canary-percent %d must be between 1 and 100", canaryPercent)
+	}
+	if canaryMinutes < 1 {
+		return fmt.Errorf("-canary-minutes must be at least 1")
+	}
+	canary.scope = policyScope{set: make(map[string]bool)}
+	if err := canary.scope.parseSettings(splitList(canarySettings)); err != nil {
+		return fmt.Errorf("-canary: %w", err)
+	}
+	canary.until = clock.Now().Add(minutes(canaryMinutes))
+	canary.inGroup = make(map[string]bool)
+	canary.flagged = make(map[string]bool)
+	canary.gone = canaryTally{}
+	return nil
+}
+
+// forgetCanary folds the trial's outcome for a connection leaving the tracker
+// into the tally, so the maps only hold tracked connections. Must be called
+// with mu held.
+func forgetCanary(conn *ConnectionInfo) {
+	key := conn.key()
+	in, seen := canary.inGroup[key]
+	if !seen {
+		return
+	}
+	canary.gone.add(in, canary.flagged[key])
+	delete(canary.inGroup, key)
+	delete(canary.flagged, key)
+}
+
+// inCanaryGroup reports whether conn's peer is among the -canary-percent the
+// trial policy applies to. Hashing the peer keeps a client in the same group
+// across its connections.
+func inCanaryGroup(conn *ConnectionInfo) bool {
+	h := fnv.New32a()
+	h.Write([]byte(peerIP(conn)))
+	return int(h.Sum32()%100) < canaryPercent
+}
+
+// canaryDecision evaluates the -canary policy for a connection the current
+// policy keeps. Within the canary group it returns the reason to kill; for
+// the rest it only logs, once, that the canary policy would kill. Must be
+// called with mu held.
+func canaryDecision(conn *ConnectionInfo, now time.Time, policy Policy, due map[string]bool) (KillReason, bool) {
+	if canarySettings == "" || canary.done || !now.Before(canary.until) {
+		return KillReason{}, false
+	}
+	key := conn.key()
+	group, seen := canary.inGroup[key]
+	if !seen {
+		group = inCanaryGroup(conn)
+		canary.inGroup[key] = group
+	}
+
+	reason, ok := thresholdReason(conn, now, canary.scope.overlay(policy), due)
+	if !ok {
+		return KillReason{}, false
+	}
+	reason.Detail += " [canary]"
+	first := !canary.flagged[key]
+	canary.flagged[key] = true
+	if group {
+		return reason, true
+	}
+	if first {
+		reportConn(rowWouldKill, conn, "canary: "+reason.String(), " ? Canary policy would kill (%s, Inode %s): %s\n", reason, conn.Inode, conn.ConnectionID)
+	}
+	return KillReason{}, false
+}
+
+// reportCanary reports the trial once it is over and stops it. Called
+// without mu held.
+func reportCanary(now time.Time) {
+	if canarySettings == "" {
+		return
+	}
+	mu.Lock()
+	if canary.done || now.Before(canary.until) {
+		mu.Unlock()
+		return
+	}
+	canary.done = true
+	tally := canary.gone
+	for key, in := range canary.inGroup {
+		tally.add(in, canary.flagged[key])
+	}
+	canary.inGroup, canary.flagged = nil, nil
+	mu.Unlock()
+
+	pct := func(n, of int) float64 {
+		if of == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(of)
+	}
+	msg := fmt.Sprintf("canary %s finished after %s: killed %d of %d connections in its %d%% of peers (%.1f%%); it would have killed %d of the other %d (%.1f%%)",
+		strings.Join(splitList(canarySettings), ","), humanMinutes(canaryMinutes), tally.kills, tally.group, canaryPercent, pct(tally.kills, tally.group), tally.would, tally.others, pct(tally.would, tally.others))
+	alertf(" ! %s\n", strings.ToUpper(msg[:1])+msg[1:])
+	emitEvent(Event{Type: EventCanary, Message: msg})
+}
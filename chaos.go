@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+var (
+	chaosPercent     float64
+	chaosIntervalMin int
+	chaosWindows     string
+	chaosConfirmed   bool
+)
+
+func init() {
+	flag.Float64Var(&chaosPercent, "chaos-percent", 0, "Resilience testing: kill this percentage of the tracked connections, picked at random, every -chaos-interval (0 disables; needs -i-understand-this-is-chaos)")
+	minutesVar(&chaosIntervalMin, "chaos-interval", 10, "Minutes between chaos rounds")
+	flag.StringVar(&chaosWindows, "chaos-window", "", "Only run chaos rounds within these times of day, e.g. '09:00-17:00' or '22:00-02:00,12:00-13:00' (in -timezone; empty means any time)")
+	flag.BoolVar(&chaosConfirmed, "i-understand-this-is-chaos", false, "Confirm that -chaos-percent deliberately kills healthy connections")
+}
+
+// chaosWindow is a daily span of -chaos-window, in minutes since midnight.
+// A span whose end is before its start runs past midnight.
+type chaosWindow struct {
+	from, to int
+}
+
+var (
+	chaosSpans []chaosWindow
+	lastChaos  time.Time
+)
+
+// setupChaos validates the chaos flags
+func setupChaos() error {
+	if chaosPercent == 0 {
+		return nil
+	}
+	if chaosPercent < 0 || chaosPercent > 100 {
+		return fmt.Errorf("-chaos-percent %g must be between 0 and 100", chaosPercent)
+	}
+	if !chaosConfirmed {
+		return fmt.Errorf("-chaos-percent kills healthy connections on purpose; add -i-understand-this-is-chaos to confirm")
+	}
+	if chaosIntervalMin < 1 {
+		return fmt.Errorf("-chaos-interval must be at least 1 minute")
+	}
+	for _, span := range splitList(chaosWindows) {
+		from, to, ok := strings.Cut(span, "-")
+		start, err1 := parseClock(from)
+		end, err2 := parseClock(to)
+		if !ok || err1 != nil || err2 != nil {
+			return fmt.Errorf("invalid -chaos-window %q: want HH:MM-HH:MM", span)
+		}
+		chaosSpans = append(chaosSpans, chaosWindow{start, end})
+	}
+	return nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// inChaosWindow reports whether now falls within -chaos-window
+func inChaosWindow(now time.Time) bool {
+	if len(chaosSpans) == 0 {
+		return true
+	}
+	t := now.In(displayLocation)
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range chaosSpans {
+		if w.from <= w.to && minute >= w.from && minute < w.to ||
+			w.from > w.to && (minute >= w.from || minute < w.to) {
+			return true
+		}
+	}
+	return false
+}
+
+// chaosVictims picks the connections of a due chaos round: -chaos-percent of
+// the live ones not already scheduled, rounded up. It returns nothing between
+// rounds and outside -chaos-window. Must be called with mu held.
+func chaosVictims(scheduled []*ConnectionInfo, now time.Time) []*ConnectionInfo {
+	if chaosPercent == 0 || now.Sub(lastChaos) < minutes(chaosIntervalMin) || !inChaosWindow(now) {
+		return nil
+	}
+	lastChaos = now
+
+	skip := make(map[*ConnectionInfo]bool, len(scheduled))
+	for _, conn := range scheduled {
+		skip[conn] = true
+	}
+	var candidates []*ConnectionInfo
+	for _, conn := range connections {
+		if conn.Alive() && !skip[conn] {
+			candidates = append(candidates, conn)
+		}
+	}
+	n := int(math.Ceil(float64(len(candidates)) * chaosPercent / 100))
+	if n == 0 {
+		return nil
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	msg := fmt.Sprintf("chaos round: killing %d of %d connections (%g%%)", n, len(candidates), chaosPercent)
+	alertf(" ! %s\n", strings.ToUpper(msg[:1])+msg[1:])
+	emitEvent(Event{Type: EventChaos, Message: msg})
+	return candidates[:n]
+}
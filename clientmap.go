@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	clientMapFile   string
+	clientMapTTLMin int
+)
+
+func init() {
+	flag.StringVar(&clientMapFile, "client-map", "", "File mapping proxy-side peer addresses to real client IPs, one '<peer ip:port> <client ip>' per line, for connections from an L4 proxy; re-read when it changes")
+	minutesVar(&clientMapTTLMin, "client-map-ttl", 60, "Minutes a mapping posted to POST /client-map is kept")
+}
+
+// clientMapping is the real client behind one proxy-side peer address
+type clientMapping struct {
+	client netip.Addr
+	posted time.Time // zero for mappings from -client-map
+}
+
+var (
+	clientMap      = make(map[string]clientMapping)
+	clientMapMu    sync.Mutex
+	clientMapMTime time.Time
+)
+
+// parseClientMap reads '<peer ip:port> <client ip>' lines; blank lines and
+// lines starting with '#' are ignored
+func parseClientMap(r io.Reader) (map[string]netip.Addr, error) {
+	mappings := make(map[string]netip.Addr)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid line %q: want '<peer ip:port> <client ip>'", line)
+		}
+		peer, err := netip.ParseAddrPort(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer address %q: %w", fields[0], err)
+		}
+		client, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid client IP %q: %w", fields[1], err)
+		}
+		mappings[netip.AddrPortFrom(peer.Addr().Unmap(), peer.Port()).String()] = client.Unmap()
+	}
+	return mappings, scanner.Err()
+}
+
+// reloadClientMap re-reads -client-map when it has changed and drops the
+// posted mappings older than -client-map-ttl. Called once per cycle; when
+// the file can't be read the previous mappings are kept.
+func reloadClientMap(now time.Time) {
+	var fromFile map[string]netip.Addr
+	if clientMapFile != "" {
+		info, err := os.Stat(clientMapFile)
+		if err != nil {
+			log.Printf("Warning: Could not read client map %s: %v", clientMapFile, err)
+		} else if !info.ModTime().Equal(clientMapMTime) {
+			f, err := os.Open(clientMapFile)
+			if err == nil {
+				fromFile, err = parseClientMap(f)
+				f.Close()
+			}
+			if err != nil {
+				log.Printf("Warning: Could not read client map %s: %v", clientMapFile, err)
+			} else {
+				clientMapMTime = info.ModTime()
+			}
+		}
+	}
+
+	ttl := minutes(clientMapTTLMin)
+	clientMapMu.Lock()
+	defer clientMapMu.Unlock()
+	for peer, m := range clientMap {
+		if fromFile != nil && m.posted.IsZero() || !m.posted.IsZero() && now.Sub(m.posted) > ttl {
+			delete(clientMap, peer)
+		}
+	}
+	for peer, client := range fromFile {
+		if _, posted := clientMap[peer]; !posted {
+			clientMap[peer] = clientMapping{client: client}
+		}
+	}
+}
+
+// mapClient sets the connection's ClientIP when its peer address is mapped.
+// A mapping that disappears later doesn't clear it: the connection still
+// belongs to the same client.
+func (c *ConnectionInfo) mapClient() {
+	if clientMapFile == "" && apiAddr == "" {
+		return
+	}
+	peer, err := netip.ParseAddrPort(c.PeerAddr)
+	if err != nil {
+		return
+	}
+	clientMapMu.Lock()
+	m, ok := clientMap[netip.AddrPortFrom(peer.Addr().Unmap(), peer.Port()).String()]
+	clientMapMu.Unlock()
+	if ok {
+		c.ClientIP = m.client.String()
+	}
+}
+
+// peerAddr returns the address policies see as the connection's peer: the
+// mapped client behind a proxy, otherwise the socket's peer
+func peerAddr(conn *ConnectionInfo) (netip.Addr, bool) {
+	if conn.ClientIP != "" {
+		if ip, err := netip.ParseAddr(conn.ClientIP); err == nil {
+			return ip, true
+		}
+	}
+	ip, ok := localIP(conn.PeerAddr)
+	return ip.Unmap(), ok
+}
+
+// handleClientMap serves POST /client-map: the body holds lines as in
+// -client-map, kept for -client-map-ttl minutes. Mappings posted here win
+// over the file.
+func handleClientMap(w http.ResponseWriter, r *http.Request) {
+	mappings, err := parseClientMap(http.MaxBytesReader(w, r.Body, 16<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := clock.Now()
+	clientMapMu.Lock()
+	for peer, client := range mappings {
+		clientMap[peer] = clientMapping{client: client, posted: now}
+	}
+	clientMapMu.Unlock()
+	fmt.Fprintf(w, "%d mappings added\n", len(mappings))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		period   time.Duration
+		advances []time.Duration
+		stop     bool
+		ticks    []time.Time // received after the advances, in order
+	}{
+		{"before the first period", 30 * time.Minute, []time.Duration{29 * time.Minute}, false, nil},
+		{"exactly one period", 30 * time.Minute, []time.Duration{30 * time.Minute}, false,
+			[]time.Time{start.Add(30 * time.Minute)}},
+		{"in small steps", 30 * time.Minute, []time.Duration{10 * time.Minute, 10 * time.Minute, 10 * time.Minute}, false,
+			[]time.Time{start.Add(30 * time.Minute)}},
+		{"ticks the reader missed are dropped", 30 * time.Minute, []time.Duration{95 * time.Minute}, false,
+			[]time.Time{start.Add(30 * time.Minute)}},
+		{"stopped", 30 * time.Minute, []time.Duration{time.Hour}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := NewManualClock(start)
+			ticker := clock.NewTicker(tt.period)
+			if tt.stop {
+				ticker.Stop()
+			}
+			var elapsed time.Duration
+			for _, d := range tt.advances {
+				clock.Advance(d)
+				elapsed += d
+			}
+			if got := clock.Now(); !got.Equal(start.Add(elapsed)) {
+				t.Errorf("Now() = %v, want %v", got, start.Add(elapsed))
+			}
+
+			var got []time.Time
+		drain:
+			for {
+				select {
+				case tick := <-ticker.C():
+					got = append(got, tick)
+				default:
+					break drain
+				}
+			}
+			if len(got) != len(tt.ticks) {
+				t.Fatalf("got %d ticks %v, want %v", len(got), got, tt.ticks)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.ticks[i]) {
+					t.Errorf("tick %d = %v, want %v", i, got[i], tt.ticks[i])
+				}
+			}
+		})
+	}
+}
+
+func TestManualClockKeepsPeriodAfterDrop(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	ticker := clock.NewTicker(time.Minute)
+
+	clock.Advance(150 * time.Second) // ticks at 1m and 2m, only the first is kept
+	<-ticker.C()
+	clock.Advance(30 * time.Second)
+	select {
+	case tick := <-ticker.C():
+		if want := start.Add(3 * time.Minute); !tick.Equal(want) {
+			t.Errorf("tick = %v, want %v", tick, want)
+		}
+	default:
+		t.Fatal("no tick at 3m")
+	}
+}
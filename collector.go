@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var collectIntervalMin int
+
+func init() {
+	minutesVar(&collectIntervalMin, "collect-interval", 0, "Minutes between ss listings when listing runs on its own schedule, apart from the policy checks every -check-interval (0 lists at every check)")
+}
+
+// listing is one snapshot taken by the collector
+type listing struct {
+	at       time.Time // when the listing started
+	conns    []*ConnectionInfo
+	unlisted map[string]bool
+	err      error
+}
+
+// collected holds the latest snapshot until the evaluator takes it
+var collected struct {
+	sync.Mutex
+	latest *listing
+}
+
+// startCollector starts listing on the -collect-interval schedule. The first
+// listing is taken before it returns, so the first evaluation has one.
+func startCollector() {
+	if collectIntervalMin <= 0 {
+		return
+	}
+	interval := minutes(collectIntervalMin)
+	collect(interval)
+	go func() {
+		ticker := clock.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			<-ticker.C()
+			collect(interval)
+		}
+	}()
+}
+
+// collect takes one listing, replacing a snapshot the evaluator hasn't taken.
+// A listing still running after an interval is cancelled.
+func collect(interval time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), interval)
+	defer cancel()
+	at := clock.Now()
+	conns, unlisted, err := listCurrentConnections(ctx)
+
+	collected.Lock()
+	defer collected.Unlock()
+	if old := collected.latest; old != nil {
+		releaseConns(old.conns)
+	}
+	collected.latest = &listing{at: at, conns: conns, unlisted: unlisted, err: err}
+}
+
+// takeListing returns the listing for this check and when it started: a new
+// one when listing runs inline, or else the collector's snapshot if it is new
+// since the last check. listedAt is zero when there is none, and the tracker
+// is evaluated on what it already knows.
+func takeListing() (conns []*ConnectionInfo, unlisted map[string]bool, listedAt time.Time, err error) {
+	if collectIntervalMin <= 0 {
+		listedAt = clock.Now()
+		conns, unlisted, err = listCurrentConnections(cycleContext())
+		return conns, unlisted, listedAt, err
+	}
+	collected.Lock()
+	defer collected.Unlock()
+	l := collected.latest
+	collected.latest = nil
+	if l == nil {
+		return nil, nil, time.Time{}, nil
+	}
+	return l.conns, l.unlisted, l.at, l.err
+}
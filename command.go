@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// commandPath is the PATH external commands run with. The commands themselves
+// are still looked up in the daemon's own PATH.
+const commandPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// passedEnv are the variables external commands inherit; ssh needs the
+// home directory and agent socket to find its keys
+var passedEnv = []string{"HOME", "USER", "LOGNAME", "TZ", "SSH_AUTH_SOCK"}
+
+// commandEnv is the sanitized environment shared by every external command
+var commandEnv = sync.OnceValue(func() []string {
+	env := []string{"LC_ALL=C", "LANG=C", "PATH=" + commandPath}
+	for _, name := range passedEnv {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	return env
+})
+
+// CommandRunner starts every external process the daemon uses: ss listings
+// and kills, ssh and -probe-cmd. Deadlines and cancellation come from ctx.
+type CommandRunner interface {
+	// Run executes the command and returns its combined stdout and stderr
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
+	// Output executes the command and returns its stdout
+	Output(ctx context.Context, name string, args ...string) ([]byte, error)
+	// Exchange executes the command with input on its stdin and returns its stdout
+	Exchange(ctx context.Context, input []byte, name string, args ...string) ([]byte, error)
+	// Stream starts the command and returns its stdout. wait reaps the
+	// command once stdout is drained, or after ctx is cancelled, and reports
+	// a failed exit along with the command's stderr.
+	Stream(ctx context.Context, name string, args ...string) (stdout io.Reader, wait func() error, err error)
+}
+
+// runner is the CommandRunner used by the daemon
+var runner CommandRunner = execRunner{}
+
+// execRunner runs commands as child processes in the C locale, so ss output
+// is never localized, with the minimal commandEnv environment. Every
+// invocation is printed with -debug.
+type execRunner struct{}
+
+func (execRunner) command(ctx context.Context, name string, args []string) *exec.Cmd {
+	debugf("   $ %s %s\n", name, strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = commandEnv()
+	return cmd
+}
+
+func (r execRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return r.command(ctx, name, args).CombinedOutput()
+}
+
+func (r execRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return r.command(ctx, name, args).Output()
+}
+
+func (r execRunner) Exchange(ctx context.Context, input []byte, name string, args ...string) ([]byte, error) {
+	cmd := r.command(ctx, name, args)
+	cmd.Stdin = bytes.NewReader(input)
+	return cmd.Output()
+}
+
+func (r execRunner) Stream(ctx context.Context, name string, args ...string) (io.Reader, func() error, error) {
+	cmd := r.command(ctx, name, args)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	var stderr cappedBuffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	wait := func() error {
+		err := cmd.Wait()
+		if err != nil && stderr.Len() > 0 {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return err
+	}
+	return stdout, wait, nil
+}
+
+// streamStderrLimit bounds the stderr a streamed command keeps for its error
+const streamStderrLimit = 4096
+
+// cappedBuffer keeps the first streamStderrLimit bytes written to it
+type cappedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := streamStderrLimit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
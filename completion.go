@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// subcommands lists the words accepted in place of options, for completion
+var subcommands = map[string]string{
+	"bench":      "Measure parsing and policy throughput on synthetic listings",
+	"completion": "Print a shell completion script",
+	"config":     "Show or roll back the running daemon's configuration history",
+	"export":     "Convert -output json logs to CSV",
+	"list":       "Show the connections that would be tracked",
+	"status":     "Summarize the connections that would be tracked",
+	"keepalive":  "Audit keepalive use on the monitored port",
+	"policy":     "Preview which tracked connections a proposed config would kill",
+	"sysctl":     "Suggest, and optionally apply, TCP sysctl values",
+}
+
+// flagChoices are the values offered after flags that take a fixed set of words
+var flagChoices = map[string][]string{
+	"kill-method": {"ss", "fd"},
+	"protocol":    {"tcp", "udp", "sctp", "unix"},
+	"color":       {"auto", "always", "never"},
+}
+
+// pathFlags complete their value as a file or directory name
+var pathFlags = map[string]bool{
+	"pin-file":      true,
+	"influx-file":   true,
+	"textfile-dir":  true,
+	"crash-dir":     true,
+	"log-file":      true,
+	"plugin-config": true,
+	"unix-path":     true,
+	"pidfile":       true,
+	"ss-path":       true,
+	"nsenter-path":  true,
+	"mqtt-ca":       true,
+	"mqtt-cert":     true,
+	"mqtt-key":      true,
+}
+
+// runCompletion prints the completion script for the shell named in args
+func runCompletion(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: completion bash|zsh|fish")
+	}
+
+	prog := filepath.Base(os.Args[0])
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion(prog))
+	case "zsh":
+		fmt.Print(zshCompletion(prog))
+	case "fish":
+		fmt.Print(fishCompletion(prog))
+	default:
+		return fmt.Errorf("unsupported shell %q: must be bash, zsh or fish", args[0])
+	}
+	return nil
+}
+
+// isBoolFlag reports whether the flag takes no value
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func sortedSubcommands() []string {
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func bashCompletion(prog string) string {
+	fn := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(prog)
+	var b strings.Builder
+	var names []string
+
+	fmt.Fprintf(&b, "# bash completion for %s\n%s() {\n", prog, fn)
+	b.WriteString("\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	b.WriteString("\tif [[ ${COMP_WORDS[1]} == completion ]]; then\n")
+	b.WriteString("\t\tCOMPREPLY=($(compgen -W \"bash zsh fish\" -- \"$cur\"))\n\t\treturn\n\tfi\n")
+	b.WriteString("\tcase \"$prev\" in\n")
+	flag.VisitAll(func(f *flag.Flag) {
+		names = append(names, "-"+f.Name)
+		switch {
+		case flagChoices[f.Name] != nil:
+			fmt.Fprintf(&b, "\t-%[1]s|--%[1]s)\n\t\tCOMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n\t\treturn ;;\n", f.Name, strings.Join(flagChoices[f.Name], " "))
+		case pathFlags[f.Name]:
+			fmt.Fprintf(&b, "\t-%[1]s|--%[1]s)\n\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n\t\treturn ;;\n", f.Name)
+		case !isBoolFlag(f):
+			fmt.Fprintf(&b, "\t-%[1]s|--%[1]s)\n\t\treturn ;;\n", f.Name)
+		}
+	})
+	b.WriteString("\tesac\n")
+	fmt.Fprintf(&b, "\tif [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then\n\t\tCOMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n\t\treturn\n\tfi\n", strings.Join(sortedSubcommands(), " "))
+	fmt.Fprintf(&b, "\tCOMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n}\n", strings.Join(names, " "))
+	fmt.Fprintf(&b, "complete -F %s %s\n", fn, prog)
+	return b.String()
+}
+
+func zshCompletion(prog string) string {
+	escape := strings.NewReplacer("'", "'\\''", "[", "\\[", "]", "\\]", ":", "\\:")
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "#compdef %s\n\n", prog)
+	b.WriteString("if [[ ${words[2]} == completion ]]; then\n\t_values 'shell' bash zsh fish\n\treturn\nfi\n\n")
+	b.WriteString("_arguments \\\n")
+	flag.VisitAll(func(f *flag.Flag) {
+		spec := fmt.Sprintf("-%s[%s]", f.Name, escape.Replace(f.Usage))
+		switch {
+		case flagChoices[f.Name] != nil:
+			spec += fmt.Sprintf(":%s:(%s)", f.Name, strings.Join(flagChoices[f.Name], " "))
+		case pathFlags[f.Name]:
+			spec += fmt.Sprintf(":%s:_files", f.Name)
+		case !isBoolFlag(f):
+			spec += fmt.Sprintf(":%s: ", f.Name)
+		}
+		fmt.Fprintf(&b, "\t'%s' \\\n", spec)
+	})
+	var cmds []string
+	for _, name := range sortedSubcommands() {
+		cmds = append(cmds, fmt.Sprintf("%s\\:%s", name, escape.Replace(strings.ReplaceAll(subcommands[name], " ", "\\ "))))
+	}
+	fmt.Fprintf(&b, "\t'1:command:((%s))'\n", strings.Join(cmds, " "))
+	return b.String()
+}
+
+func fishCompletion(prog string) string {
+	escape := strings.NewReplacer("\\", "\\\\", "'", "\\'")
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# fish completion for %s\n", prog)
+	for _, name := range sortedSubcommands() {
+		fmt.Fprintf(&b, "complete -c %s -n '__fish_use_subcommand' -a %s -d '%s'\n", prog, name, escape.Replace(subcommands[name]))
+	}
+	fmt.Fprintf(&b, "complete -c %s -n '__fish_seen_subcommand_from completion' -xa 'bash zsh fish'\n", prog)
+	flag.VisitAll(func(f *flag.Flag) {
+		line := fmt.Sprintf("complete -c %s -o %s -d '%s'", prog, f.Name, escape.Replace(f.Usage))
+		switch {
+		case flagChoices[f.Name] != nil:
+			line += fmt.Sprintf(" -xa '%s'", strings.Join(flagChoices[f.Name], " "))
+		case pathFlags[f.Name]:
+			line += " -rF"
+		case !isBoolFlag(f):
+			line += " -x"
+		}
+		b.WriteString(line + "\n")
+	})
+	return b.String()
+}
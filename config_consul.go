@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	consulAddr string
+	consulKey  string
+)
+
+func init() {
+	flag.StringVar(&consulAddr, "consul-addr", "", "Consul HTTP address (e.g. http://127.0.0.1:8500) to watch for live policy updates; token from CONSUL_HTTP_TOKEN")
+	flag.StringVar(&consulKey, "consul-key", "deadsocketdropper/config", "Consul KV key holding 'flag=value' lines that override the live-tunable flags")
+}
+
+// liveFlags are the flags that may be changed while running; all are read afresh every cycle
+var liveFlags = []string{
+	"max-active", "max-inactive", "max-persist", "max-zero-window",
+	"max-transfer", "max-throughput", "throughput-window", "warn-before",
+	"pressure-max-active", "dry-run",
+}
+
+// remoteConfig holds a fetched document until the monitor loop applies it
+var remoteConfig struct {
+	sync.Mutex
+	pending  map[string]string
+	source   string // where pending came from, for the config history
+	changed  bool
+	defaults map[string]string // command-line values, restored when a key is removed
+}
+
+// parseConfigDoc parses 'flag=value' lines; blank lines and '#' comments are ignored
+func parseConfigDoc(doc string) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(doc))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimPrefix(strings.TrimSpace(key), "-")
+		if !ok || !slices.Contains(liveFlags, key) {
+			return nil, fmt.Errorf("invalid line %q: want <flag>=<value> with one of %s", line, strings.Join(liveFlags, ", "))
+		}
+		values[key] = strings.TrimSpace(value)
+	}
+	return values, nil
+}
+
+// queueRemoteConfig hands a new document to the monitor loop
+func queueRemoteConfig(values map[string]string) {
+	queueConfig(values, "consul")
+}
+
+// queueConfig hands values from source to the monitor loop
+func queueConfig(values map[string]string, source string) {
+	remoteConfig.Lock()
+	defer remoteConfig.Unlock()
+	remoteConfig.pending = values
+	remoteConfig.source = source
+	remoteConfig.changed = true
+}
+
+// applyRemoteConfig sets the flags of the latest fetched document, restoring the
+// command-line value of every live flag it doesn't mention. Runs in the monitor
+// loop between cycles, so no cycle sees a half-applied policy.
+func applyRemoteConfig() {
+	remoteConfig.Lock()
+	values, source, changed := remoteConfig.pending, remoteConfig.source, remoteConfig.changed
+	remoteConfig.changed = false
+	remoteConfig.Unlock()
+	if !changed {
+		return
+	}
+
+	// Under mu, as API handlers read the thresholds
+	mu.Lock()
+	var applied []string
+	for _, name := range liveFlags {
+		value := targetValue(values, name)
+		before := flag.Lookup(name).Value.String()
+		if before == value {
+			continue
+		}
+		if name == "dry-run" {
+			if err := dryRunAllowed(value); err != nil {
+				log.Printf("Error applying remote config %s=%s: %v", name, value, err)
+				continue
+			}
+		}
+		if err := flag.Set(name, value); err != nil {
+			log.Printf("Error applying remote config %s=%s: %v", name, value, err)
+			continue
+		}
+		// "120" and "2h" set a minute-valued flag to the same thing
+		if flag.Lookup(name).Value.String() == before {
+			continue
+		}
+		applied = append(applied, name+"="+value)
+	}
+	mu.Unlock()
+	if len(applied) > 0 {
+		log.Printf("Config from %s applied: %s", source, strings.Join(applied, " "))
+		recordConfig(source)
+	}
+}
+
+// targetValue is the value a config document gives the live flag name: its
+// own, or the command-line value the flag falls back to when left out
+func targetValue(values map[string]string, name string) string {
+	if value, ok := values[name]; ok {
+		return value
+	}
+	if value, ok := remoteConfig.defaults[name]; ok {
+		return value
+	}
+	return flag.Lookup(name).Value.String()
+}
+
+// withLiveConfig runs fn with the live flags set as applying the config
+// document values would set them, and restores them afterwards. Must be
+// called with mu held.
+func withLiveConfig(values map[string]string, fn func()) error {
+	saved := liveConfig()
+	defer func() {
+		for name, value := range saved {
+			flag.Set(name, value)
+		}
+	}()
+	for _, name := range liveFlags {
+		if err := flag.Set(name, targetValue(values, name)); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	fn()
+	return nil
+}
+
+// dryRunAllowed rejects a dry-run value that would turn kills on where
+// observeOnly rules them out
+func dryRunAllowed(value string) error {
+	if on, err := strconv.ParseBool(value); observeOnly() && (err != nil || !on) {
+		return configErrorf("dry-run can't be turned off with -remote or -analyze")
+	}
+	return nil
+}
+
+// setupConsulConfig watches -consul-key with blocking queries, so changes
+// arrive within moments of being written
+func setupConsulConfig() error {
+	if consulAddr == "" {
+		return nil
+	}
+	if _, err := url.Parse(consulAddr); err != nil {
+		return fmt.Errorf("invalid -consul-addr: %w", err)
+	}
+
+	remoteConfig.defaults = make(map[string]string)
+	for _, name := range liveFlags {
+		remoteConfig.defaults[name] = flag.Lookup(name).Value.String()
+	}
+
+	go watchConsulKey()
+	return nil
+}
+
+func watchConsulKey() {
+	client := &http.Client{Timeout: 6 * time.Minute}
+	token := os.Getenv("CONSUL_HTTP_TOKEN")
+	var index uint64
+	lastDoc := ""
+
+	for {
+		endpoint := fmt.Sprintf("%s/v1/kv/%s?raw&wait=5m&index=%d", strings.TrimRight(consulAddr, "/"), consulKey, index)
+		req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+		if err != nil {
+			log.Printf("Error watching Consul key %s: %v", consulKey, err)
+			return
+		}
+		if token != "" {
+			req.Header.Set("X-Consul-Token", token)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Printf("Error watching Consul key %s: %v", consulKey, err)
+			time.Sleep(10 * time.Second)
+			continue
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		// Consul requires restarting from 0 when the index goes backwards
+		next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+		if next < index {
+			next = 0
+		}
+		index = next
+		if next == 0 {
+			// Not a blocking query response; avoid spinning
+			time.Sleep(10 * time.Second)
+		}
+
+		switch {
+		case err != nil:
+			log.Printf("Error reading Consul key %s: %v", consulKey, err)
+		case resp.StatusCode == http.StatusNotFound:
+			if lastDoc != "" {
+				log.Printf("Consul key %s removed, restoring command-line values", consulKey)
+				lastDoc = ""
+				queueRemoteConfig(nil)
+			}
+		case resp.StatusCode != http.StatusOK:
+			log.Printf("Error watching Consul key %s: %s", consulKey, resp.Status)
+			time.Sleep(10 * time.Second)
+		case string(body) != lastDoc:
+			values, err := parseConfigDoc(string(body))
+			if err != nil {
+				log.Printf("Ignoring Consul key %s: %v", consulKey, err)
+				break
+			}
+			lastDoc = string(body)
+			queueRemoteConfig(values)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// apiClient calls a running daemon's management API for the subcommands
+type apiClient struct {
+	api, token, caFile *string
+	client             *http.Client
+}
+
+// newAPIClient registers the options for reaching the daemon on fs; role
+// names what the token needs
+func newAPIClient(fs *flag.FlagSet, role string) *apiClient {
+	return &apiClient{
+		api:    fs.String("api", "http://127.0.0.1:9090", "Management API of the daemon (its -http-addr)"),
+		token:  fs.String("token", os.Getenv("DSD_API_TOKEN"), "API token (default $DSD_API_TOKEN); "+role),
+		caFile: fs.String("ca", "", "CA file for an https -api"),
+	}
+}
+
+// call sends a request once the options are parsed and returns the body of a
+// 2xx response
+func (c *apiClient) call(method, path string, body io.Reader) ([]byte, error) {
+	if c.client == nil {
+		c.client = &http.Client{Timeout: 30 * time.Second}
+		if *c.caFile != "" {
+			pem, err := os.ReadFile(*c.caFile)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in %s", *c.caFile)
+			}
+			c.client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(*c.api, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if *c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+*c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err == nil && resp.StatusCode/100 != 2 {
+		err = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return respBody, err
+}
+
+// runConfigCommand implements 'config history' and 'config rollback <version>'
+// against a running daemon's management API
+func runConfigCommand(args []string) error {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	client := newAPIClient(fs, "rollback needs the admin role")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: config [options] history|rollback <version>\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	call := func(method, path string) ([]byte, error) {
+		return client.call(method, path, nil)
+	}
+
+	switch {
+	case fs.NArg() == 1 && fs.Arg(0) == "history":
+		body, err := call(http.MethodGet, "/config/history")
+		if err != nil {
+			return err
+		}
+		var versions []ConfigVersion
+		if err := json.Unmarshal(body, &versions); err != nil {
+			return err
+		}
+		printConfigHistory(versions)
+		return nil
+	case fs.NArg() == 2 && fs.Arg(0) == "rollback":
+		body, err := call(http.MethodPost, "/config/rollback?version="+url.QueryEscape(fs.Arg(1)))
+		if err != nil {
+			return err
+		}
+		var v ConfigVersion
+		if err := json.Unmarshal(body, &v); err != nil {
+			return err
+		}
+		fmt.Printf("Rollback to version %d (%s) queued; it applies before the next cycle\n", v.Version, v.Hash)
+		return nil
+	}
+	fs.Usage()
+	return fmt.Errorf("want 'history' or 'rollback <version>'")
+}
+
+// runPolicyCommand implements 'policy diff <file>': it sends a proposed
+// config document, in the format of -consul-key, to a running daemon and
+// lists the tracked connections it would newly kill
+func runPolicyCommand(args []string) error {
+	fs := flag.NewFlagSet("policy", flag.ContinueOnError)
+	client := newAPIClient(fs, "needs the read role")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: policy [options] diff <file>\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 || fs.Arg(0) != "diff" {
+		fs.Usage()
+		return fmt.Errorf("want 'diff <file>'")
+	}
+
+	doc, err := os.ReadFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if _, err := parseConfigDoc(string(doc)); err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(1), err)
+	}
+	body, err := client.call(http.MethodPost, "/policy/diff", bytes.NewReader(doc))
+	if err != nil {
+		return err
+	}
+	var diff struct {
+		Current    map[string]string `json:"current"`
+		Proposed   map[string]string `json:"proposed"`
+		Tracked    int               `json:"tracked"`
+		Candidates []policyDiffEntry `json:"new_kill_candidates"`
+	}
+	if err := json.Unmarshal(body, &diff); err != nil {
+		return err
+	}
+	printPolicyDiff(diff.Current, diff.Proposed, diff.Tracked, diff.Candidates)
+	return nil
+}
+
+// printPolicyDiff shows the flags a proposed config changes and the
+// connections it would newly kill, oldest first
+func printPolicyDiff(current, proposed map[string]string, tracked int, candidates []policyDiffEntry) {
+	var changed []string
+	for _, name := range liveFlags {
+		if current[name] != proposed[name] {
+			changed = append(changed, fmt.Sprintf("%s %s -> %s", name, current[name], proposed[name]))
+		}
+	}
+	if len(changed) == 0 {
+		fmt.Println("No changes to the live configuration")
+	} else {
+		fmt.Printf("Changes: %s\n", strings.Join(changed, ", "))
+	}
+
+	slices.SortFunc(candidates, func(a, b policyDiffEntry) int { return a.TimeAdded.Compare(b.TimeAdded) })
+	for _, c := range candidates {
+		fmt.Printf("  %-10s %-50s %7s  %s\n", c.Inode, c.ConnectionID, humanDuration(time.Duration(c.AgeMinutes*float64(time.Minute))), c.Reason)
+	}
+	fmt.Printf("%d of %d tracked connections would newly be killed\n", len(candidates), tracked)
+}
+
+// printConfigHistory lists versions newest first, each with the flags it
+// changed from the version before
+func printConfigHistory(versions []ConfigVersion) {
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		fmt.Printf("%3d  %s  %s  %s\n", v.Version, v.Time.Local().Format(time.DateTime), v.Hash, v.Source)
+		var changed []string
+		for name, value := range v.Values {
+			if i == 0 || versions[i-1].Values[name] != value {
+				changed = append(changed, name+"="+value)
+			}
+		}
+		slices.Sort(changed)
+		if i > 0 && len(changed) > 0 {
+			fmt.Printf("     changed: %s\n", strings.Join(changed, " "))
+		}
+	}
+}
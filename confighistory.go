@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var configHistorySize int
+
+func init() {
+	flag.IntVar(&configHistorySize, "config-history", 10, "Number of applied configurations of the live-tunable flags kept for GET /config/history and rollback")
+}
+
+// ConfigVersion is one applied configuration of the live flags
+type ConfigVersion struct {
+	Version int               `json:"version"`
+	Time    time.Time         `json:"time"`
+	Hash    string            `json:"hash"`
+	Source  string            `json:"source"` // startup, consul or "rollback to N"
+	Values  map[string]string `json:"values"`
+}
+
+var configHistory struct {
+	sync.Mutex
+	versions []ConfigVersion
+	next     int
+}
+
+// liveConfig returns the current values of the live flags
+func liveConfig() map[string]string {
+	values := make(map[string]string, len(liveFlags))
+	for _, name := range liveFlags {
+		values[name] = flag.Lookup(name).Value.String()
+	}
+	return values
+}
+
+// liveConfigHash fingerprints values, in liveFlags order
+func liveConfigHash(values map[string]string) string {
+	h := sha256.New()
+	for _, name := range liveFlags {
+		fmt.Fprintf(h, "%s=%s\n", name, values[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// recordConfig adds the current live configuration to the history, unless it
+// is the latest version already
+func recordConfig(source string) {
+	if configHistorySize < 1 {
+		return
+	}
+	values := liveConfig()
+	hash := liveConfigHash(values)
+	configHistory.Lock()
+	defer configHistory.Unlock()
+	if n := len(configHistory.versions); n > 0 && configHistory.versions[n-1].Hash == hash {
+		return
+	}
+	configHistory.next++
+	configHistory.versions = append(configHistory.versions, ConfigVersion{
+		Version: configHistory.next,
+		Time:    clock.Now(),
+		Hash:    hash,
+		Source:  source,
+		Values:  values,
+	})
+	if drop := len(configHistory.versions) - configHistorySize; drop > 0 {
+		configHistory.versions = append(configHistory.versions[:0:0], configHistory.versions[drop:]...)
+	}
+}
+
+// snapshotConfigHistory returns the kept versions, oldest first
+func snapshotConfigHistory() []ConfigVersion {
+	configHistory.Lock()
+	defer configHistory.Unlock()
+	return append([]ConfigVersion(nil), configHistory.versions...)
+}
+
+// rollbackConfig queues the configuration of version for the monitor loop,
+// which applies it before the next cycle like a remote config. A later
+// change in Consul still wins over it.
+func rollbackConfig(version int) (ConfigVersion, error) {
+	for _, v := range snapshotConfigHistory() {
+		if v.Version == version {
+			if value, ok := v.Values["dry-run"]; ok {
+				if err := dryRunAllowed(value); err != nil {
+					return ConfigVersion{}, err
+				}
+			}
+			queueConfig(v.Values, fmt.Sprintf("rollback to %d", version))
+			return v, nil
+		}
+	}
+	var kept []string
+	for _, v := range snapshotConfigHistory() {
+		kept = append(kept, fmt.Sprint(v.Version))
+	}
+	return ConfigVersion{}, fmt.Errorf("no configuration version %d (kept: %s)", version, strings.Join(kept, ", "))
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// connFilterKeys are the filter options of 'list' (as flags) and of
+// GET /connections (as query parameters). The age range needs the tracker's
+// history, so 'list' has no -min-age or -max-age.
+var connFilterKeys = []struct{ name, usage string }{
+	{"peer", "Only connections whose peer is in this CIDR or IP, e.g. 10.0.0.0/8"},
+	{"min-age", "Only connections tracked at least this long, e.g. 30m or 2d"},
+	{"max-age", "Only connections tracked at most this long"},
+	{"state", "Only connections in this TCP state (ESTAB) or tracker state (KILL_RETRY)"},
+	{"process", "Only connections owned by this process name or PID"},
+	{"min-bytes", "Only connections that moved at least this many bytes, both ways together"},
+	{"sort", "Sort by age, peer, bytes, state or process; prefix with - to reverse (default age)"},
+	{"limit", "Return at most this many connections (0 means all)"},
+	{"offset", "Skip this many connections before -limit"},
+}
+
+// connFilter selects, orders and pages connections for 'list' and the API
+type connFilter struct {
+	peer     netip.Prefix
+	minAge   time.Duration
+	maxAge   time.Duration
+	state    string
+	process  string
+	minBytes int64
+	sortBy   string
+	reverse  bool
+	limit    int
+	offset   int
+}
+
+// parseConnFilter reads the filter from get, which returns "" for an option
+// that isn't set
+func parseConnFilter(get func(string) string) (connFilter, error) {
+	f := connFilter{sortBy: "age"}
+	if s := get("peer"); s != "" {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(s)
+			if addrErr != nil {
+				return f, fmt.Errorf("invalid peer %q: want a CIDR or IP", s)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		f.peer = prefix.Masked()
+	}
+	for _, age := range []struct {
+		key string
+		dst *time.Duration
+	}{{"min-age", &f.minAge}, {"max-age", &f.maxAge}} {
+		if s := get(age.key); s != "" {
+			d, err := parseDuration(s)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s: %w", age.key, err)
+			}
+			*age.dst = d
+		}
+	}
+	f.state = strings.ToUpper(get("state"))
+	f.process = get("process")
+	if s := get("min-bytes"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			return f, fmt.Errorf("invalid min-bytes %q", s)
+		}
+		f.minBytes = n
+	}
+	if s := get("sort"); s != "" {
+		f.sortBy, f.reverse = strings.TrimPrefix(s, "-"), strings.HasPrefix(s, "-")
+		switch f.sortBy {
+		case "age", "peer", "bytes", "state", "process":
+		default:
+			return f, fmt.Errorf("invalid sort %q: want age, peer, bytes, state or process", s)
+		}
+	}
+	for _, page := range []struct {
+		key string
+		dst *int
+	}{{"limit", &f.limit}, {"offset", &f.offset}} {
+		if s := get(page.key); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return f, fmt.Errorf("invalid %s %q", page.key, s)
+			}
+			*page.dst = n
+		}
+	}
+	return f, nil
+}
+
+// match reports whether conn passes the filter at now
+func (f connFilter) match(conn *ConnectionInfo, now time.Time) bool {
+	if f.peer.IsValid() {
+		ip, ok := peerAddr(conn)
+		if !ok || !f.peer.Contains(ip) {
+			return false
+		}
+	}
+	age := now.Sub(conn.TimeAdded)
+	if f.minAge > 0 && age < f.minAge || f.maxAge > 0 && age > f.maxAge {
+		return false
+	}
+	if f.state != "" && f.state != conn.TCPState && f.state != string(conn.State) {
+		return false
+	}
+	if f.process != "" && f.process != conn.Process && f.process != strconv.Itoa(conn.PID) {
+		return false
+	}
+	return conn.BytesSent+conn.BytesReceived >= f.minBytes
+}
+
+// apply returns the connections passing the filter, sorted and paged, and
+// how many passed before paging
+func (f connFilter) apply(conns []*ConnectionInfo, now time.Time) ([]*ConnectionInfo, int) {
+	var out []*ConnectionInfo
+	for _, conn := range conns {
+		if f.match(conn, now) {
+			out = append(out, conn)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b *ConnectionInfo) int {
+		var c int
+		switch f.sortBy {
+		case "peer":
+			c = comparePeers(a, b)
+		case "bytes":
+			c = cmp.Compare(a.BytesSent+a.BytesReceived, b.BytesSent+b.BytesReceived)
+		case "state":
+			c = cmp.Compare(a.TCPState, b.TCPState)
+		case "process":
+			c = cmp.Or(cmp.Compare(a.Process, b.Process), cmp.Compare(a.PID, b.PID))
+		}
+		// Oldest first, also as the tie-break
+		c = cmp.Or(c, a.TimeAdded.Compare(b.TimeAdded), cmp.Compare(a.origin(), b.origin()), comparePeers(a, b))
+		if f.reverse {
+			return -c
+		}
+		return c
+	})
+
+	total := len(out)
+	out = out[min(f.offset, total):]
+	if f.limit > 0 && len(out) > f.limit {
+		out = out[:f.limit]
+	}
+	return out, total
+}
+
+// comparePeers orders connections by peer address, numerically where it parses
+func comparePeers(a, b *ConnectionInfo) int {
+	ipA, okA := peerAddr(a)
+	ipB, okB := peerAddr(b)
+	if okA && okB {
+		if c := ipA.Compare(ipB); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(a.PeerAddr, b.PeerAddr)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+var crashDir string
+
+func init() {
+	flag.StringVar(&crashDir, "crash-dir", "", "Directory where crash reports are written when a cycle or hook panics (default: log only)")
+}
+
+// recentEventsSize is the number of events kept for crash reports
+const recentEventsSize = 50
+
+// recentEvents is a ring of the last emitted events
+var recentEvents struct {
+	sync.Mutex
+	buf  []Event
+	next int
+}
+
+// rememberEvent stores an event in the crash report ring
+func rememberEvent(ev Event) {
+	recentEvents.Lock()
+	defer recentEvents.Unlock()
+	if len(recentEvents.buf) < recentEventsSize {
+		recentEvents.buf = append(recentEvents.buf, ev)
+		return
+	}
+	recentEvents.buf[recentEvents.next] = ev
+	recentEvents.next = (recentEvents.next + 1) % recentEventsSize
+}
+
+// lastEvents returns the remembered events, oldest first
+func lastEvents() []Event {
+	recentEvents.Lock()
+	defer recentEvents.Unlock()
+	out := make([]Event, 0, len(recentEvents.buf))
+	out = append(out, recentEvents.buf[recentEvents.next:]...)
+	return append(out, recentEvents.buf[:recentEvents.next]...)
+}
+
+// configHash fingerprints the effective flag values, so crashes can be grouped by configuration
+func configHash() string {
+	h := sha256.New()
+	flag.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(h, "%s=%s\n", f.Name, f.Value)
+	})
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// crashReport is the content of a crash report file
+type crashReport struct {
+	Time       time.Time `json:"time"`
+	Where      string    `json:"where"`
+	Panic      string    `json:"panic"`
+	Stack      string    `json:"stack"`
+	ConfigHash string    `json:"config_hash"`
+	Events     []Event   `json:"last_events"`
+}
+
+// recoverPanic must be deferred directly. It stops a panic from taking the daemon
+// down and reports it; where names the code that panicked.
+func recoverPanic(where string) {
+	if r := recover(); r != nil {
+		reportPanic(where, r)
+	}
+}
+
+// reportPanic logs a recovered panic and writes a crash report when -crash-dir is set
+func reportPanic(where string, r any) {
+	report := crashReport{
+		Time:       clock.Now(),
+		Where:      where,
+		Panic:      fmt.Sprint(r),
+		Stack:      string(debug.Stack()),
+		ConfigHash: configHash(),
+		Events:     lastEvents(),
+	}
+	log.Printf("Recovered panic in %s: %s\n%s", where, report.Panic, report.Stack)
+
+	if crashDir == "" {
+		return
+	}
+	path, err := writeCrashReport(report)
+	if err != nil {
+		log.Printf("Error writing crash report: %v", err)
+		return
+	}
+	log.Printf("Crash report written to %s", path)
+}
+
+func writeCrashReport(report crashReport) (string, error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("crash-%s-%d.json", report.Time.UTC().Format("20060102T150405Z"), os.Getpid())
+	path := filepath.Join(crashDir, name)
+	return path, os.WriteFile(path, data, 0o600)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	daemonMode bool
+	pidFile    string
+	supervise  bool
+)
+
+func init() {
+	flag.BoolVar(&daemonMode, "daemon", false, "Detach into the background (for hosts without systemd); needs -log-file")
+	flag.StringVar(&pidFile, "pidfile", "", "Write the daemon's pid to this file, removed on exit")
+	flag.BoolVar(&supervise, "supervise", false, "With -daemon, keep a small supervisor process that restarts the daemon when it crashes")
+}
+
+// daemonRoleEnv tells a re-executed copy of the program which part it plays
+const daemonRoleEnv = "DEADSOCKETDROPPER_DAEMON_ROLE"
+
+// Daemon roles
+const (
+	roleSupervisor = "supervisor"
+	roleWorker     = "worker"
+)
+
+// Restart backoff of the supervised worker. It doubles after each crash and
+// starts over once the worker has stayed up for superviseStableAfter.
+const (
+	superviseMinBackoff  = time.Second
+	superviseMaxBackoff  = time.Minute
+	superviseStableAfter = time.Minute
+)
+
+// forwardedSignals are passed from the supervisor to the worker
+var forwardedSignals = []os.Signal{syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2}
+
+// daemonize implements -daemon. Go can't fork a running program, so the
+// command started by the user re-executes itself detached, in a new session,
+// and exits. That copy either supervises a worker copy (-supervise) or is the
+// worker. It returns in the process that goes on to monitor.
+func daemonize() error {
+	if !daemonMode {
+		return writePidFile()
+	}
+	switch os.Getenv(daemonRoleEnv) {
+	case "":
+		role := roleWorker
+		if supervise {
+			role = roleSupervisor
+		}
+		if err := checkPidFile(); err != nil {
+			return err
+		}
+		cmd, err := startSelf(role, true)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Running in the background (pid %d), logging to %s\n", cmd.Process.Pid, logFile)
+		os.Exit(0)
+	case roleSupervisor:
+		runSupervisor()
+	}
+	if supervise {
+		// The supervisor owns the pidfile
+		return nil
+	}
+	return writePidFile()
+}
+
+// startSelf starts a copy of this program with the same arguments in role.
+// A detached copy gets its own session and logs to -log-file.
+func startSelf(role string, detach bool) (*exec.Cmd, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonRoleEnv+"="+role)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if detach {
+		out, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+		if err != nil {
+			return nil, fmt.Errorf("opening -log-file: %w", err)
+		}
+		defer out.Close()
+		cmd.Stdout, cmd.Stderr = out, out
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// runSupervisor restarts the worker until it exits cleanly or the supervisor
+// is told to stop, then exits
+func runSupervisor() {
+	if err := writePidFile(); err != nil {
+		fatal(fmt.Errorf("Daemon error: %w", err))
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardedSignals...)
+
+	backoff := superviseMinBackoff
+	for {
+		started := time.Now()
+		cmd, err := startSelf(roleWorker, false)
+		if err != nil {
+			log.Printf("Supervisor: error starting daemon: %v", err)
+		} else {
+			log.Printf("Supervisor: daemon started (pid %d)", cmd.Process.Pid)
+			done := make(chan error, 1)
+			go func() { done <- cmd.Wait() }()
+
+			stopping := false
+		wait:
+			for {
+				select {
+				case sig := <-sigs:
+					cmd.Process.Signal(sig)
+					stopping = stopping || sig == syscall.SIGTERM || sig == syscall.SIGINT
+				case err = <-done:
+					break wait
+				}
+			}
+			if err == nil || stopping {
+				log.Printf("Supervisor: daemon exited (%v), stopping", exitDescription(err))
+				removePidFile()
+				os.Exit(0)
+			}
+			// Restarting can't fix a bad setting, it would only fail again every minute
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && exitErr.ExitCode() == exitCode(&ConfigError{}) {
+				log.Printf("Supervisor: daemon exited with a configuration error (%s), not restarting; fix the configuration and start it again", exitDescription(err))
+				removePidFile()
+				os.Exit(exitErr.ExitCode())
+			}
+			log.Printf("Supervisor: daemon crashed (%s)", exitDescription(err))
+		}
+
+		if time.Since(started) >= superviseStableAfter {
+			backoff = superviseMinBackoff
+		}
+		log.Printf("Supervisor: restarting daemon in %s", backoff)
+		select {
+		case <-time.After(backoff):
+		case sig := <-sigs:
+			if sig == syscall.SIGTERM || sig == syscall.SIGINT {
+				removePidFile()
+				os.Exit(0)
+			}
+		}
+		backoff = min(2*backoff, superviseMaxBackoff)
+	}
+}
+
+// exitDescription describes how a worker exited
+func exitDescription(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ProcessState.String()
+	}
+	return err.Error()
+}
+
+// checkPidFile refuses to start a second daemon while the pid in -pidfile is alive
+func checkPidFile() error {
+	if pidFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		return nil
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err == nil && pid > 0 && syscall.Kill(pid, 0) == nil {
+		return fmt.Errorf("already running with pid %d (%s)", pid, pidFile)
+	}
+	return nil
+}
+
+// writePidFile writes our pid to -pidfile and removes it again when we are
+// stopped by SIGTERM or SIGINT
+func writePidFile() error {
+	if pidFile == "" {
+		return nil
+	}
+	if err := checkPidFile(); err != nil && os.Getenv(daemonRoleEnv) == "" {
+		return err
+	}
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		return fmt.Errorf("writing -pidfile: %w", err)
+	}
+	if os.Getenv(daemonRoleEnv) == roleSupervisor {
+		return nil
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-stop
+		removePidFile()
+		// Die from the signal as we would have without the handler
+		signal.Reset(sig)
+		syscall.Kill(os.Getpid(), sig.(syscall.Signal))
+	}()
+	return nil
+}
+
+// removePidFile removes -pidfile if it still holds our pid
+func removePidFile() {
+	data, err := os.ReadFile(pidFile)
+	if err == nil && strings.TrimSpace(string(data)) == strconv.Itoa(os.Getpid()) {
+		os.Remove(pidFile)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+var onNoDestroy string
+
+func init() {
+	flag.StringVar(&onNoDestroy, "on-no-destroy", "fail", "What to do when the kernel can't destroy sockets (no CONFIG_INET_DIAG_DESTROY) and -kill-method is ss: 'fail' to exit, 'dry-run' to keep monitoring without killing, or 'fd' to kill through the owner's file descriptor")
+}
+
+// degraded is set when kills are suppressed because the kernel can't destroy
+// sockets; unlike -dry-run, remote config can't clear it
+var degraded bool
+
+// checkSockDestroy finds out at startup whether 'ss --kill' works, and acts
+// on -on-no-destroy when it doesn't. Only local TCP over the ss backend is
+// checked: other protocols already avoid it, and remote kernels aren't ours
+// to probe.
+func checkSockDestroy() error {
+	if killMethod != "ss" || killCmd != "" || protocol != "tcp" || remoteMode() {
+		return nil
+	}
+	switch onNoDestroy {
+	case "fail", "dry-run", "fd":
+	default:
+		return configErrorf("invalid -on-no-destroy %q: must be 'fail', 'dry-run' or 'fd'", onNoDestroy)
+	}
+
+	ok, err := sockDestroyWorks()
+	if err != nil {
+		// Can't tell; unconfirmed kills will show it soon enough
+		log.Printf("Warning: could not check for socket destroy support: %v", err)
+		return nil
+	}
+	if ok {
+		return nil
+	}
+
+	const why = "the kernel can't destroy sockets (built without CONFIG_INET_DIAG_DESTROY), so 'ss --kill' leaves them open"
+	switch onNoDestroy {
+	case "fd":
+		alertf(" ! Socket destroy unsupported: %s; using -kill-method fd\n", why)
+		killMethod = "fd"
+	case "dry-run":
+		degraded = true
+		alertf(" ! DEGRADED: %s. Nothing will be killed; connections are only reported\n", why)
+		emitEvent(Event{Type: EventDegraded, Message: why})
+	default:
+		return fmt.Errorf("%s; set -on-no-destroy dry-run or fd to run anyway", why)
+	}
+	return nil
+}
+
+// sockDestroyWorks connects to itself over loopback, destroys the accepted
+// socket with ss --kill and reports whether the socket noticed
+func sockDestroyWorks() (bool, error) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		return false, err
+	}
+	defer ln.Close()
+	client, err := net.Dial("tcp4", ln.Addr().String())
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+	server, err := ln.Accept()
+	if err != nil {
+		return false, err
+	}
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	argv := ssCommand("", "-K", "-tn", "src", server.LocalAddr().String(), "dst", server.RemoteAddr().String())
+	if out, err := runner.Run(ctx, argv[0], argv[1:]...); err != nil {
+		return false, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	// A destroyed socket fails reads with ECONNABORTED; a live one just waits
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = server.Read(make([]byte, 1))
+	if err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// boolToInt turns a flag into a 0/1 gauge value
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var digestSchedule string
+
+func init() {
+	flag.StringVar(&digestSchedule, "digest", "", "Scheduled summary reports: 'daily', 'weekly' or 'daily,weekly'. Each is logged and sent to every notifier as a digest event")
+}
+
+// digestPeriods are the -digest reports and the span each covers
+var digestPeriods = map[string]time.Duration{
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+// digestMaxEntries bounds the history kept for digests; -low-memory lowers it
+var digestMaxEntries = 100000
+
+// digestTopPeers is the number of peers listed in a digest
+const digestTopPeers = 5
+
+// DigestReport summarizes one -digest period
+type DigestReport struct {
+	Period   string         `json:"period"` // "daily" or "weekly"
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Kills    int            `json:"kills"`
+	Reasons  map[string]int `json:"reasons,omitempty"`
+	TopPeers []PeerKills    `json:"top_peers,omitempty"`
+	Ended    int            `json:"ended"` // connections killed or expired
+	P50      float64        `json:"lifetime_p50_seconds"`
+	P95      float64        `json:"lifetime_p95_seconds"`
+	P99      float64        `json:"lifetime_p99_seconds"`
+	Errors   int            `json:"monitor_errors"`
+}
+
+// PeerKills counts the kills of one peer
+type PeerKills struct {
+	Peer  string `json:"peer"`
+	Kills int    `json:"kills"`
+}
+
+// digestEntry is one fact kept for digests: a connection that ended, killed
+// or not, or a cycle's monitor errors
+type digestEntry struct {
+	time     time.Time
+	reason   string // kill reason code, empty when the connection expired
+	peer     string
+	lifetime time.Duration
+	errors   int
+}
+
+// digestHistory holds the entries of the longest -digest period, oldest first.
+// It lives in memory only, so a restart starts the periods over.
+var digestHistory struct {
+	sync.Mutex
+	entries []digestEntry
+	keep    time.Duration
+	next    map[string]time.Time // when each period is due
+}
+
+// setupDigests validates -digest and schedules the first reports
+func setupDigests() error {
+	if digestSchedule == "" {
+		return nil
+	}
+	digestHistory.next = make(map[string]time.Time)
+	for _, period := range splitList(digestSchedule) {
+		span, ok := digestPeriods[period]
+		if !ok {
+			return fmt.Errorf("unknown -digest period %q: use daily or weekly", period)
+		}
+		digestHistory.keep = max(digestHistory.keep, span)
+		digestHistory.next[period] = nextDigest(period, clock.Now())
+	}
+	return nil
+}
+
+// nextDigest returns when the period's next report is due: midnight for
+// daily reports and Monday midnight for weekly ones, in -timezone
+func nextDigest(period string, after time.Time) time.Time {
+	t := after.In(displayLocation)
+	midnight := time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, displayLocation)
+	if period == "weekly" {
+		midnight = midnight.AddDate(0, 0, (8-int(midnight.Weekday()))%7)
+	}
+	return midnight
+}
+
+// recordDigest appends an entry, dropping those older than the longest period
+func recordDigest(e digestEntry) {
+	if digestSchedule == "" {
+		return
+	}
+	digestHistory.Lock()
+	defer digestHistory.Unlock()
+	drop := 0
+	for drop < len(digestHistory.entries) && e.time.Sub(digestHistory.entries[drop].time) > digestHistory.keep {
+		drop++
+	}
+	drop = max(drop, len(digestHistory.entries)+1-digestMaxEntries)
+	digestHistory.entries = append(digestHistory.entries[drop:], e)
+}
+
+// digestKill records a successful kill
+func digestKill(conn *ConnectionInfo, reason string, now time.Time) {
+	recordDigest(digestEntry{time: now, reason: reason, peer: strings.Clone(peerIP(conn)), lifetime: now.Sub(conn.TimeAdded)})
+}
+
+// digestExpired records a connection that ended without being killed
+func digestExpired(lifetime time.Duration, now time.Time) {
+	recordDigest(digestEntry{time: now, lifetime: lifetime})
+}
+
+// digestCycle records the monitor errors of a cycle
+func digestCycle(stats CycleStats) {
+	if stats.Errors > 0 {
+		recordDigest(digestEntry{time: stats.Start, errors: stats.Errors})
+	}
+}
+
+// buildDigest summarizes the entries of the span ending at to
+func buildDigest(period string, to time.Time) DigestReport {
+	to = to.UTC()
+	r := DigestReport{Period: period, From: to.Add(-digestPeriods[period]), To: to, Reasons: map[string]int{}}
+	peers := make(map[string]int)
+	var ages []time.Duration
+
+	digestHistory.Lock()
+	for _, e := range digestHistory.entries {
+		if e.time.Before(r.From) || e.time.After(to) {
+			continue
+		}
+		r.Errors += e.errors
+		if e.errors > 0 {
+			continue
+		}
+		r.Ended++
+		ages = append(ages, e.lifetime)
+		if e.reason != "" {
+			r.Kills++
+			r.Reasons[e.reason]++
+			peers[e.peer]++
+		}
+	}
+	digestHistory.Unlock()
+
+	for peer, n := range peers {
+		r.TopPeers = append(r.TopPeers, PeerKills{peer, n})
+	}
+	sort.Slice(r.TopPeers, func(i, j int) bool {
+		a, b := r.TopPeers[i], r.TopPeers[j]
+		if a.Kills != b.Kills {
+			return a.Kills > b.Kills
+		}
+		ipA, errA := netip.ParseAddr(a.Peer)
+		ipB, errB := netip.ParseAddr(b.Peer)
+		if errA == nil && errB == nil {
+			return ipA.Less(ipB)
+		}
+		return a.Peer < b.Peer
+	})
+	r.TopPeers = r.TopPeers[:min(len(r.TopPeers), digestTopPeers)]
+
+	if len(ages) > 0 {
+		sort.Slice(ages, func(i, j int) bool { return ages[i] < ages[j] })
+		pct := func(p float64) float64 {
+			return ages[int(p/100*float64(len(ages)-1))].Seconds()
+		}
+		r.P50, r.P95, r.P99 = pct(50), pct(95), pct(99)
+	}
+	return r
+}
+
+// String renders the report for the log and email
+func (r DigestReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s digest for port %s, %s to %s\n", strings.ToUpper(r.Period[:1])+r.Period[1:], sourcePort, formatTime(r.From), formatTime(r.To))
+
+	codes := make([]string, 0, len(r.Reasons))
+	for code := range r.Reasons {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return r.Reasons[codes[i]] > r.Reasons[codes[j]] })
+	var reasons []string
+	for _, code := range codes {
+		reasons = append(reasons, fmt.Sprintf("%s %d", code, r.Reasons[code]))
+	}
+	fmt.Fprintf(&b, "  Kills: %d", r.Kills)
+	if len(reasons) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(reasons, ", "))
+	}
+	b.WriteString("\n")
+
+	if len(r.TopPeers) > 0 {
+		var peers []string
+		for _, p := range r.TopPeers {
+			peers = append(peers, fmt.Sprintf("%s (%d)", p.Peer, p.Kills))
+		}
+		fmt.Fprintf(&b, "  Top peers: %s\n", strings.Join(peers, ", "))
+	}
+	if r.Ended > 0 {
+		seconds := func(s float64) string { return humanDuration(time.Duration(s * float64(time.Second))) }
+		fmt.Fprintf(&b, "  Lifetimes: p50 %s, p95 %s, p99 %s (n=%d)\n", seconds(r.P50), seconds(r.P95), seconds(r.P99), r.Ended)
+	}
+	fmt.Fprintf(&b, "  Monitor errors: %d\n", r.Errors)
+	return b.String()
+}
+
+// sendDueDigests reports every period whose time has come. A period the
+// daemon slept through is reported once, covering the span up to now.
+func sendDueDigests(now time.Time) {
+	if digestSchedule == "" {
+		return
+	}
+	for _, period := range splitList(digestSchedule) {
+		if now.Before(digestHistory.next[period]) {
+			continue
+		}
+		digestHistory.next[period] = nextDigest(period, now)
+
+		r := buildDigest(period, now)
+		infof("\n%s", r)
+		emitEvent(Event{Type: EventDigest, Message: fmt.Sprintf("%s digest: %d kills, %d monitor errors", period, r.Kills, r.Errors), Digest: &r})
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	discoverProcesses   string
+	discoverUnits       string
+	discoverIntervalMin int
+)
+
+func init() {
+	flag.StringVar(&discoverProcesses, "discover-process", "", "Monitor every port these processes listen on instead of -port, e.g. 'nginx,haproxy'")
+	flag.StringVar(&discoverUnits, "discover-unit", "", "Monitor every port the processes of these systemd units listen on instead of -port, e.g. 'nginx.service'")
+	minutesVar(&discoverIntervalMin, "discover-interval", 5, "Minutes between looks for the listening ports of -discover-process and -discover-unit")
+}
+
+// discoveredPorts holds the ports found by discovery; nil means -port
+var discoveredPorts atomic.Pointer[[]string]
+
+// discovering reports whether the monitored ports are discovered
+func discovering() bool {
+	return discoverProcesses != "" || discoverUnits != ""
+}
+
+// monitoredPorts returns the ports being monitored
+func monitoredPorts() []string {
+	if ports := discoveredPorts.Load(); ports != nil {
+		return *ports
+	}
+	return []string{sourcePort}
+}
+
+// portFilter returns the ss filter selecting sockets on the monitored ports;
+// under -all-ports there is none
+func portFilter() []string {
+	if allPorts {
+		return nil
+	}
+	ports := monitoredPorts()
+	if len(ports) == 1 {
+		return []string{"src", ":" + ports[0]}
+	}
+	filter := []string{"("}
+	for i, port := range ports {
+		if i > 0 {
+			filter = append(filter, "or")
+		}
+		filter = append(filter, "src", ":"+port)
+	}
+	return append(filter, ")")
+}
+
+// setupDiscovery finds the ports to monitor and keeps looking for changes.
+// sourcePort then only names the ports found at startup, for display and
+// metric labels.
+func setupDiscovery() error {
+	if !discovering() {
+		return nil
+	}
+	if remoteMode() || allNetns || protocol == "unix" {
+		return fmt.Errorf("port discovery only works on local ports (no -remote, -all-netns or -protocol unix)")
+	}
+	if discoverIntervalMin < 1 {
+		return fmt.Errorf("-discover-interval must be at least 1 minute")
+	}
+	ports, err := discoverPorts()
+	if err != nil {
+		return err
+	}
+	if len(ports) == 0 {
+		return fmt.Errorf("nothing matching %s is listening", discoveryTargets())
+	}
+	discoveredPorts.Store(&ports)
+	sourcePort = strings.Join(ports, ",")
+
+	go func() {
+		for range time.Tick(minutes(discoverIntervalMin)) {
+			refreshDiscovery()
+		}
+	}()
+	return nil
+}
+
+// refreshDiscovery looks for the listening ports again. When nothing listens
+// any more the previous ports are kept: the service may only be restarting,
+// and its connections still need watching.
+func refreshDiscovery() {
+	ports, err := discoverPorts()
+	if err != nil {
+		log.Printf("Error discovering ports: %v", err)
+		return
+	}
+	previous := monitoredPorts()
+	if len(ports) == 0 || slices.Equal(ports, previous) {
+		return
+	}
+	discoveredPorts.Store(&ports)
+	msg := fmt.Sprintf("monitored ports of %s changed from %s to %s", discoveryTargets(), strings.Join(previous, ","), strings.Join(ports, ","))
+	infof(" = %s\n", strings.ToUpper(msg[:1])+msg[1:])
+	emitEvent(Event{Type: EventPortsChanged, Message: msg})
+}
+
+// discoveryTargets describes what discovery looks for
+func discoveryTargets() string {
+	var targets []string
+	for _, name := range splitList(discoverProcesses) {
+		targets = append(targets, "process "+name)
+	}
+	for _, unit := range splitList(discoverUnits) {
+		targets = append(targets, "unit "+unitName(unit))
+	}
+	return strings.Join(targets, ", ")
+}
+
+// discoverPorts lists the listening sockets and returns, sorted, the ports
+// owned by a -discover-process or by a process of a -discover-unit
+func discoverPorts() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	argv := ssCommand("", protocolFlag()+"lnpH")
+	out, err := runner.Run(ctx, argv[0], argv[1:]...)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	names := splitList(discoverProcesses)
+	var units []string
+	for _, unit := range splitList(discoverUnits) {
+		units = append(units, unitName(unit))
+	}
+	var ports []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		process, pid, _, ok := parseUsers(line)
+		if len(fields) < 4 || !ok {
+			continue
+		}
+		if !slices.Contains(names, process) && !inUnits(pid, units) {
+			continue
+		}
+		port := fields[3][strings.LastIndexByte(fields[3], ':')+1:]
+		if _, err := strconv.Atoi(port); err == nil && !slices.Contains(ports, port) {
+			ports = append(ports, port)
+		}
+	}
+	slices.SortFunc(ports, func(a, b string) int {
+		x, _ := strconv.Atoi(a)
+		y, _ := strconv.Atoi(b)
+		return x - y
+	})
+	return ports, scanner.Err()
+}
+
+// unitName adds the .service suffix systemd assumes for a bare unit name
+func unitName(unit string) string {
+	if !strings.Contains(unit, ".") {
+		return unit + ".service"
+	}
+	return unit
+}
+
+// inUnits reports whether pid runs in the cgroup of one of units, going by
+// /proc/<pid>/cgroup (e.g. "0::/system.slice/nginx.service")
+func inUnits(pid int, units []string) bool {
+	if len(units) == 0 {
+		return false
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, dir := range strings.Split(parts[2], "/") {
+			if slices.Contains(units, dir) {
+				return true
+			}
+		}
+	}
+	return false
+}
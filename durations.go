@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationUnits are the unit spellings parseDuration understands
+var durationUnits = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "wk": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+}
+
+// parseDuration parses a human-ish duration: "2h", "90 min", "1.5h",
+// "1,5 h", "2h05m", "1d12h" or "3 days". Every number needs a unit.
+func parseDuration(s string) (time.Duration, error) {
+	rest := strings.ToLower(strings.TrimSpace(s))
+	if rest == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	var total time.Duration
+	for rest != "" {
+		num := rest[:len(rest)-len(strings.TrimLeft(rest, "0123456789.,"))]
+		rest = strings.TrimLeft(rest[len(num):], " ")
+		unit := rest[:len(rest)-len(strings.TrimLeft(rest, "abcdefghijklmnopqrstuvwxyz"))]
+		rest = strings.TrimLeft(rest[len(unit):], " ")
+		f, err := strconv.ParseFloat(strings.Replace(num, ",", ".", 1), 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad number in duration %q", s)
+		}
+		d, ok := durationUnits[unit]
+		if !ok {
+			return 0, fmt.Errorf("missing or unknown unit in duration %q", s)
+		}
+		total += time.Duration(f * float64(d))
+	}
+	return total, nil
+}
+
+// parseMinutes parses a minute-valued setting. A bare integer counts as
+// minutes, as it always has; anything else goes through parseDuration and
+// must come out at a whole number of minutes.
+func parseMinutes(s string) (int, error) {
+	if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("negative duration %q", s)
+		}
+		return n, nil
+	}
+	d, err := parseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d%time.Minute != 0 {
+		return 0, fmt.Errorf("duration %q is not a whole number of minutes", s)
+	}
+	return int(d / time.Minute), nil
+}
+
+// minutes converts a minute-valued setting to a time.Duration
+func minutes(n int) time.Duration {
+	return time.Duration(n) * time.Minute
+}
+
+// humanDuration formats a duration compactly: "45s", "2m", "1h05m", "2d03h"
+func humanDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dd%02dh", int(d.Hours())/24, int(d.Hours())%24)
+	}
+}
+
+// humanMinutes formats a minute-valued setting; 0 stays "0" since it
+// usually means disabled. Days are only used when no minutes would be lost.
+func humanMinutes(n int) string {
+	if n == 0 {
+		return "0"
+	}
+	if n >= 24*60 && n%60 != 0 {
+		return fmt.Sprintf("%dd%s", n/(24*60), humanDuration(minutes(n%(24*60))))
+	}
+	return humanDuration(minutes(n))
+}
+
+// minutesFlag is a flag.Value for minute-valued flags that also accepts
+// the forms parseDuration understands
+type minutesFlag struct{ p *int }
+
+// minutesVar registers a minute-valued flag
+func minutesVar(p *int, name string, value int, usage string) {
+	*p = value
+	flag.Var(minutesFlag{p}, name, usage)
+}
+
+func (m minutesFlag) String() string {
+	if m.p == nil {
+		return "0"
+	}
+	return humanMinutes(*m.p)
+}
+
+func (m minutesFlag) Set(value string) error {
+	n, err := parseMinutes(value)
+	if err != nil {
+		return err
+	}
+	*m.p = n
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+var (
+	emptyGuardMin      int
+	emptyConfirmations int
+
+	emptyStreak int
+)
+
+func init() {
+	flag.IntVar(&emptyGuardMin, "empty-guard-min", 10, "Distrust a listing that drops to zero while at least this many connections are tracked (0 disables the guard)")
+	flag.IntVar(&emptyConfirmations, "empty-confirmations", 2, "Further empty listings needed to confirm such a drop before the tracked connections are expired")
+}
+
+// suspectEmptyListing reports whether this cycle's listing of listed
+// connections should be distrusted: an empty listing right after a large one
+// more likely means ss or its filter broke than that every client left at
+// once. Suspect cycles hold all tracked connections as they are, until
+// -empty-confirmations more empty listings in a row confirm the drop. Must
+// be called with mu held.
+func suspectEmptyListing(listed int) bool {
+	if emptyGuardMin <= 0 || listed > 0 {
+		emptyStreak = 0
+		return false
+	}
+	alive := 0
+	for _, conn := range connections {
+		if conn.Alive() {
+			alive++
+		}
+	}
+	if alive < emptyGuardMin {
+		emptyStreak = 0
+		return false
+	}
+
+	emptyStreak++
+	if emptyStreak > emptyConfirmations {
+		alertf(" ! Listing still empty after %d checks, marking %d tracked connections missing\n", emptyStreak, alive)
+		emptyStreak = 0
+		return false
+	}
+	msg := fmt.Sprintf("listing returned no connections while %d are tracked, holding them (check %d of %d)", alive, emptyStreak, emptyConfirmations+1)
+	alertf(" ! Suspect listing on port %s: %s\n", sourcePort, msg)
+	emitEvent(Event{Type: EventSuspect, Message: msg})
+	return true
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+)
+
+// Error classes tell a supervisor or an alert what went wrong: a bad setting
+// is fixed by the operator, a kernel refusing a kill is not. Each class has
+// its own exit code, from sysexits.h, and labels the error metrics.
+//
+// Untyped errors are "internal" and exit with 1.
+
+// ConfigError is a flag, file or remote setting that can't be used
+type ConfigError struct{ Err error }
+
+// EnvError is something missing from the host: ss, root, kernel support
+type EnvError struct{ Err error }
+
+// ListError is a socket listing that failed or was cut short
+type ListError struct{ Err error }
+
+// ParseError is a listing line that couldn't be read
+type ParseError struct{ Err error }
+
+// KillError is a kill the kernel or the kill backend refused
+type KillError struct{ Err error }
+
+func (e *ConfigError) Error() string { return e.Err.Error() }
+func (e *EnvError) Error() string    { return e.Err.Error() }
+func (e *ListError) Error() string   { return e.Err.Error() }
+func (e *ParseError) Error() string  { return e.Err.Error() }
+func (e *KillError) Error() string   { return e.Err.Error() }
+
+func (e *ConfigError) Unwrap() error { return e.Err }
+func (e *EnvError) Unwrap() error    { return e.Err }
+func (e *ListError) Unwrap() error   { return e.Err }
+func (e *ParseError) Unwrap() error  { return e.Err }
+func (e *KillError) Unwrap() error   { return e.Err }
+
+// errorClasses are the class labels, in metric order, with their exit codes
+var errorClasses = []struct {
+	name string
+	exit int
+}{
+	{"config", 78}, // EX_CONFIG
+	{"env", 69},    // EX_UNAVAILABLE
+	{"list", 74},   // EX_IOERR
+	{"parse", 65},  // EX_DATAERR
+	{"kill", 71},   // EX_OSERR
+	{"internal", 1},
+}
+
+// errorClass returns the class label of err: that of the outermost typed
+// error in its chain, or "internal"
+func errorClass(err error) string {
+	for err != nil {
+		switch err.(type) {
+		case *ConfigError:
+			return "config"
+		case *EnvError:
+			return "env"
+		case *ListError:
+			return "list"
+		case *ParseError:
+			return "parse"
+		case *KillError:
+			return "kill"
+		}
+		err = errors.Unwrap(err)
+	}
+	return "internal"
+}
+
+// exitCode returns the process exit code for err
+func exitCode(err error) int {
+	class := errorClass(err)
+	for _, c := range errorClasses {
+		if c.name == class {
+			return c.exit
+		}
+	}
+	return 1
+}
+
+// configErrorf formats a ConfigError
+func configErrorf(format string, args ...any) error {
+	return &ConfigError{fmt.Errorf(format, args...)}
+}
+
+// asConfig prefixes err and makes it a ConfigError, unless it already has a
+// class of its own
+func asConfig(prefix string, err error) error {
+	if errorClass(err) != "internal" {
+		return fmt.Errorf("%s: %w", prefix, err)
+	}
+	return &ConfigError{fmt.Errorf("%s: %w", prefix, err)}
+}
+
+// asEnv prefixes err and makes it an EnvError, unless it already has a class
+// of its own
+func asEnv(prefix string, err error) error {
+	if errorClass(err) != "internal" {
+		return fmt.Errorf("%s: %w", prefix, err)
+	}
+	return &EnvError{fmt.Errorf("%s: %w", prefix, err)}
+}
+
+// fatal logs err and exits with the code of its class
+func fatal(err error) {
+	log.Print(err)
+	os.Exit(exitCode(err))
+}
+
+// parseErrors counts the listing lines skipped since the last cycle took them
+var parseErrors atomic.Int64
+
+// countError tallies err by class in the cycle stats
+func (s *CycleStats) countError(err error) {
+	s.countErrors(errorClass(err), 1)
+}
+
+// countErrors tallies n errors of class
+func (s *CycleStats) countErrors(class string, n int) {
+	s.Errors += n
+	if s.ErrorClasses == nil {
+		s.ErrorClasses = make(map[string]int)
+	}
+	s.ErrorClasses[class] += n
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	escalateWindowMin  int
+	escalateSignal     string
+	escalateBanCmd     string
+	escalateUnbanCmd   string
+	escalateBanMinutes int
+)
+
+func init() {
+	minutesVar(&escalateWindowMin, "escalate-window", 0, "Escalate against peers killed repeatedly within this many minutes (0 disables the ladder)")
+	flag.StringVar(&escalateSignal, "escalate-signal", "", "Second offense: also send this signal (e.g. HUP, TERM, USR1) to the socket's owning process (empty skips the rung)")
+	flag.StringVar(&escalateBanCmd, "escalate-ban-cmd", "", "Third offense: ban the peer with this command; {peer_ip} and the -probe-cmd placeholders are filled in (empty skips the rung)")
+	flag.StringVar(&escalateUnbanCmd, "escalate-unban-cmd", "", "Command lifting a ban after -escalate-ban-minutes, with the same placeholders")
+	minutesVar(&escalateBanMinutes, "escalate-ban-minutes", 60, "How long an -escalate-ban-cmd ban lasts before -escalate-unban-cmd runs")
+}
+
+// Rungs of the escalation ladder
+const (
+	RungKill   = 1 // the socket is killed
+	RungSignal = 2 // ... and its owning process signalled
+	RungBan    = 3 // ... and the peer banned
+)
+
+// escalationTimeout bounds one ban or unban command
+const escalationTimeout = 30 * time.Second
+
+// signalNames are the signals -escalate-signal accepts
+var signalNames = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"TERM": syscall.SIGTERM,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// PeerRecord is a peer's standing on the escalation ladder
+type PeerRecord struct {
+	Peer        string      `json:"peer"`
+	Offenses    []time.Time `json:"offenses"` // kills within -escalate-window
+	Rung        int         `json:"rung"`
+	BannedUntil time.Time   `json:"banned_until,omitzero"`
+
+	unban []string // expanded -escalate-unban-cmd
+}
+
+var (
+	peerRecords   = make(map[string]*PeerRecord)
+	peerRecordsMu sync.Mutex
+)
+
+// escalationSignal validates -escalate-signal
+func escalationSignal() (syscall.Signal, error) {
+	name := strings.TrimPrefix(strings.ToUpper(escalateSignal), "SIG")
+	sig, ok := signalNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown -escalate-signal %q", escalateSignal)
+	}
+	return sig, nil
+}
+
+// peerIP returns the IP of a connection's peer, or of the client behind it
+// with -client-map
+func peerIP(conn *ConnectionInfo) string {
+	ip, ok := peerAddr(conn)
+	if !ok {
+		return conn.PeerAddr
+	}
+	// ss mostly prints peers in canonical form already; reusing that text
+	// saves an allocation per connection every cycle
+	listed := conn.ClientIP
+	if listed == "" {
+		listed, _, _ = net.SplitHostPort(conn.PeerAddr)
+	}
+	var buf [64]byte
+	if string(ip.AppendTo(buf[:0])) == listed {
+		return listed
+	}
+	return ip.String()
+}
+
+// escalate records a successful kill against the connection's peer and applies
+// the rung it reaches. Several kills of one peer in the same cycle are a
+// single offense. Called without mu held.
+func escalate(conn *ConnectionInfo, now time.Time) {
+	if escalateWindowMin <= 0 {
+		return
+	}
+	window := minutes(escalateWindowMin)
+
+	peerRecordsMu.Lock()
+	rec, ok := peerRecords[peerIP(conn)]
+	if !ok {
+		rec = &PeerRecord{Peer: strings.Clone(peerIP(conn))}
+		peerRecords[rec.Peer] = rec
+	}
+	if n := len(rec.Offenses); n > 0 && rec.Offenses[n-1].Equal(now) {
+		peerRecordsMu.Unlock()
+		return
+	}
+	kept := rec.Offenses[:0]
+	for _, t := range rec.Offenses {
+		if now.Sub(t) < window {
+			kept = append(kept, t)
+		}
+	}
+	rec.Offenses = append(kept, now)
+	rec.Rung = min(len(rec.Offenses), RungBan)
+	rung, banned := rec.Rung, rec.BannedUntil.After(now)
+	peerRecordsMu.Unlock()
+
+	if rung >= RungSignal && escalateSignal != "" {
+		escalateToSignal(conn)
+	}
+	if rung >= RungBan && escalateBanCmd != "" && !banned {
+		escalateToBan(conn, rec, now, "repeat offender")
+	}
+}
+
+// banFeedPeer bans the peer of a connection killed for being on a block feed,
+// straight away rather than on the third offense. Called without mu held.
+func banFeedPeer(conn *ConnectionInfo, now time.Time) {
+	name, ok := feedMatch(conn, FeedBlock)
+	if escalateBanCmd == "" || !ok {
+		return
+	}
+	peerRecordsMu.Lock()
+	rec, ok := peerRecords[peerIP(conn)]
+	if !ok {
+		rec = &PeerRecord{Peer: strings.Clone(peerIP(conn))}
+		peerRecords[rec.Peer] = rec
+	}
+	banned := rec.BannedUntil.After(now)
+	peerRecordsMu.Unlock()
+	if !banned {
+		escalateToBan(conn, rec, now, "feed "+name+" peer")
+	}
+}
+
+// escalateToSignal signals the process owning the killed socket
+func escalateToSignal(conn *ConnectionInfo) {
+	if conn.PID <= 0 {
+		log.Printf("No owner process for %s (Inode %s), cannot escalate with a signal", conn.ConnectionID, conn.Inode)
+		return
+	}
+	sig, _ := escalationSignal()
+	if err := syscall.Kill(conn.PID, sig); err != nil {
+		log.Printf("Error sending %s to %s (pid %d): %v", sig, conn.Process, conn.PID, err)
+		return
+	}
+	msg := fmt.Sprintf("repeat offender %s: sent %s to %s (pid %d)", peerIP(conn), sig, conn.Process, conn.PID)
+	alertf(" ! Escalation: %s\n", msg)
+	emitEvent(connEvent(EventEscalation, conn, msg))
+}
+
+// escalateToBan runs -escalate-ban-cmd against the connection's peer; why
+// says what earned the ban
+func escalateToBan(conn *ConnectionInfo, rec *PeerRecord, now time.Time, why string) {
+	args := expandProbeArgs(escalateBanCmd, conn)
+	ctx, cancel := context.WithTimeout(context.Background(), escalationTimeout)
+	defer cancel()
+	if out, err := runner.Run(ctx, args[0], args[1:]...); err != nil {
+		log.Printf("Error banning %s: %v: %s", rec.Peer, err, strings.TrimSpace(string(out)))
+		return
+	}
+
+	until := now.Add(minutes(escalateBanMinutes))
+	peerRecordsMu.Lock()
+	rec.BannedUntil = until
+	if escalateUnbanCmd != "" {
+		rec.unban = expandProbeArgs(escalateUnbanCmd, conn)
+	}
+	peerRecordsMu.Unlock()
+
+	msg := fmt.Sprintf("%s %s banned until %s", why, rec.Peer, formatTime(until))
+	alertf(" ! Escalation: %s\n", msg)
+	emitEvent(connEvent(EventEscalation, conn, msg))
+}
+
+// liftBans runs the unban command of every expired ban, retrying failed ones
+// next cycle, and steps peers down the ladder as their offenses age out of
+// the window. Called once per cycle without mu held.
+func liftBans(now time.Time) {
+	if escalateWindowMin <= 0 && escalateBanCmd == "" {
+		return
+	}
+	window := minutes(escalateWindowMin)
+
+	var lift []*PeerRecord
+	peerRecordsMu.Lock()
+	for peer, rec := range peerRecords {
+		kept := rec.Offenses[:0]
+		for _, t := range rec.Offenses {
+			if now.Sub(t) < window {
+				kept = append(kept, t)
+			}
+		}
+		rec.Offenses = kept
+		rec.Rung = min(len(kept), RungBan)
+
+		switch {
+		case !rec.BannedUntil.IsZero() && !now.Before(rec.BannedUntil):
+			lift = append(lift, rec)
+		case rec.BannedUntil.IsZero() && len(kept) == 0:
+			delete(peerRecords, peer)
+		}
+	}
+	peerRecordsMu.Unlock()
+
+	for _, rec := range lift {
+		if len(rec.unban) > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), escalationTimeout)
+			out, err := runner.Run(ctx, rec.unban[0], rec.unban[1:]...)
+			cancel()
+			if err != nil {
+				log.Printf("Error lifting ban on %s, retrying next cycle: %v: %s", rec.Peer, err, strings.TrimSpace(string(out)))
+				continue
+			}
+		}
+		peerRecordsMu.Lock()
+		rec.BannedUntil = time.Time{}
+		peerRecordsMu.Unlock()
+		infof(" = Ban lifted for %s\n", rec.Peer)
+		emitEvent(Event{Type: EventEscalation, Message: fmt.Sprintf("ban on %s lifted", rec.Peer)})
+	}
+}
+
+// snapshotPeers copies the escalation records for the API
+func snapshotPeers() []PeerRecord {
+	peerRecordsMu.Lock()
+	defer peerRecordsMu.Unlock()
+	out := make([]PeerRecord, 0, len(peerRecords))
+	for _, rec := range peerRecords {
+		r := *rec
+		r.Offenses = append([]time.Time(nil), rec.Offenses...)
+		out = append(out, r)
+	}
+	return out
+}
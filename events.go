@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Event types emitted by the monitor
+const (
+	EventNew           = "new"
+	EventWarned        = "warned"
+	EventKill          = "kill"
+	EventKillFailed    = "kill_failed"
+	EventKillAbandoned = "kill_abandoned"
+	EventExpired       = "expired"
+	EventMonitorError  = "monitor_error"
+	EventServiceDown   = "service_down"
+	EventServiceUp     = "service_up"
+	EventWatchdog      = "watchdog"
+	EventLeader        = "leader"
+	EventFlood         = "flood"
+	EventFloodEnd      = "flood_end"
+	EventScan          = "scan"
+	EventEscalation    = "escalation"
+	EventSuspect       = "suspect_listing"
+	EventDigest        = "digest"
+	EventChaos         = "chaos"
+	EventCanary        = "canary"
+	EventPortsChanged  = "ports_changed"
+	EventRestart       = "restart"
+	EventDegraded      = "degraded"
+)
+
+// Event describes something that happened to a tracked connection or to the monitor itself
+type Event struct {
+	Type         string    `json:"type"`
+	Time         time.Time `json:"time"`
+	Inode        string    `json:"inode,omitempty"`
+	ConnectionID string    `json:"connection,omitempty"`
+	State        ConnState `json:"state,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+	Message      string    `json:"message,omitempty"`
+	Marker       string    `json:"marker,omitempty"`      // correlation marker of a kill, with -kill-marker
+	ErrorClass   string    `json:"error_class,omitempty"` // of a failure, see errorClass
+
+	// Final byte counts of a killed connection
+	BytesSent     int64 `json:"bytes_sent,omitempty"`
+	BytesReceived int64 `json:"bytes_received,omitempty"`
+
+	// Peer IPs behind a probable port scan
+	Peers []string `json:"peers,omitempty"`
+
+	// Summary carried by a digest event
+	Digest *DigestReport `json:"digest,omitempty"`
+}
+
+// IsFailure reports whether the event signals a problem with the monitor itself
+func (e Event) IsFailure() bool {
+	return e.Type == EventKillFailed || e.Type == EventKillAbandoned || e.Type == EventMonitorError || e.Type == EventServiceDown ||
+		e.Type == EventWatchdog || e.Type == EventDegraded
+}
+
+// eventSchemaVersion is bumped whenever a field of the published event JSON changes meaning or is removed
+const eventSchemaVersion = 1
+
+// eventEnvelope is the stable wire format for events published to external systems
+type eventEnvelope struct {
+	Schema  string `json:"schema"`
+	Version int    `json:"version"`
+	Host    string `json:"host"`
+	Event
+}
+
+var eventHost, _ = os.Hostname()
+
+// marshalEvent encodes an event in the versioned wire format
+func marshalEvent(ev Event) ([]byte, error) {
+	return json.Marshal(eventEnvelope{
+		Schema:  "deadsocketdropper.event",
+		Version: eventSchemaVersion,
+		Host:    eventHost,
+		Event:   ev,
+	})
+}
+
+// EventSink receives every emitted event. Send must not block the monitor cycle.
+type EventSink interface {
+	Send(Event)
+}
+
+var sinks []EventSink
+
+// emitEvent fans an event out to all configured sinks
+func emitEvent(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = clock.Now()
+	}
+	ev.Time = ev.Time.UTC()
+	rememberEvent(ev)
+	for _, sink := range sinks {
+		sendEvent(sink, ev)
+	}
+}
+
+// sendEvent delivers one event, so a panicking sink cannot stop the others
+func sendEvent(sink EventSink, ev Event) {
+	defer recoverPanic(fmt.Sprintf("event sink %T", sink))
+	sink.Send(ev)
+}
+
+// connEvent builds an event for a tracked connection
+func connEvent(eventType string, conn *ConnectionInfo, message string) Event {
+	return Event{
+		Type:         eventType,
+		Inode:        conn.Inode,
+		ConnectionID: conn.ConnectionID,
+		State:        conn.State,
+		Message:      message,
+	}
+}
+
+// setupNotifiers registers the sinks enabled by command-line flags
+func setupNotifiers() error {
+	if smtpAddr != "" {
+		sink, err := newSMTPNotifier()
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	if mqttBroker != "" {
+		sink, err := newMQTTPublisher()
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	if natsURL != "" {
+		sink, err := newNATSPublisher()
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	if incidentsEnabled() {
+		if incidentKillFailLimit < 1 {
+			return fmt.Errorf("-incident-kill-failures must be at least 1")
+		}
+		sinks = append(sinks, newIncidentNotifier())
+	}
+	return nil
+}
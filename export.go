@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportColumns is the CSV header written by 'export'
+var exportColumns = []string{"time", "type", "inode", "connection", "state", "reason", "message", "bytes_sent", "bytes_received", "peers"}
+
+// runExport implements 'export': it reads the lines of one or more -output
+// json logs (stdin without arguments) and writes their events as CSV. The
+// daemon keeps no history of its own, so these logs are what there is to
+// export.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "csv", "Output format; only csv is supported")
+	since := fs.String("since", "", "Only export events newer than this, e.g. 7d, 12h or 30m (default all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "csv" {
+		return fmt.Errorf("unsupported -format %q: only csv is available", *format)
+	}
+	var cutoff time.Time
+	if *since != "" {
+		d, err := parseDuration(*since)
+		if err != nil {
+			return fmt.Errorf("invalid -since: %w", err)
+		}
+		cutoff = time.Now().Add(-d)
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	w.Write(exportColumns)
+	if fs.NArg() == 0 {
+		if err := exportEvents(w, os.Stdin, cutoff); err != nil {
+			return err
+		}
+	}
+	for _, name := range fs.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		err = exportEvents(w, f, cutoff)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// exportEvents writes the events read from r that are newer than cutoff. Lines
+// that aren't -output json, such as log messages, are skipped.
+func exportEvents(w *csv.Writer, r io.Reader, cutoff time.Time) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var line outputLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil || line.Type != "event" || line.Event == nil {
+			continue
+		}
+		ev := line.Event
+		if ev.Time.Before(cutoff) {
+			continue
+		}
+		w.Write([]string{
+			ev.Time.UTC().Format(time.RFC3339), ev.Type, ev.Inode, ev.ConnectionID, string(ev.State), ev.Reason, ev.Message,
+			strconv.FormatInt(ev.BytesSent, 10), strconv.FormatInt(ev.BytesReceived, 10), strings.Join(ev.Peers, " "),
+		})
+	}
+	return scanner.Err()
+}
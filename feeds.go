@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Feed actions
+const (
+	FeedBlock = "block" // kill connections from listed peers, and ban them with -escalate-ban-cmd
+	FeedAllow = "allow" // never touch listed peers
+)
+
+// feedTimeout bounds one download of an HTTP feed
+const feedTimeout = 30 * time.Second
+
+// ipFeed is one -feed: a list of IPs and prefixes loaded from a file or URL
+type ipFeed struct {
+	name   string
+	action string
+	source string
+
+	// Guarded by feedsMu
+	prefixes map[netip.Prefix]bool
+	lengths  []int // prefix lengths present, to look an address up one length at a time
+	loaded   time.Time
+	err      error
+}
+
+// feedList is the -feed flag: "<name>,<block|allow>,<file|http(s) URL>", repeatable
+type feedList []*ipFeed
+
+var (
+	feeds          feedList
+	feedsMu        sync.Mutex
+	feedRefreshMin int
+)
+
+func init() {
+	flag.Var(&feeds, "feed", "IP feed, one IP or CIDR per line: '<name>,block,<file|url>' kills (and with -escalate-ban-cmd bans) its peers on sight, '<name>,allow,<file|url>' never touches them (repeatable)")
+	minutesVar(&feedRefreshMin, "feed-refresh", 60, "Minutes between reloads of every -feed")
+}
+
+func (l *feedList) String() string {
+	var parts []string
+	for _, f := range *l {
+		parts = append(parts, f.name)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (l *feedList) Set(value string) error {
+	parts := strings.SplitN(value, ",", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return fmt.Errorf("invalid feed %q: want <name>,<block|allow>,<file|url>", value)
+	}
+	if parts[1] != FeedBlock && parts[1] != FeedAllow {
+		return fmt.Errorf("invalid feed action %q: want block or allow", parts[1])
+	}
+	for _, f := range *l {
+		if f.name == parts[0] {
+			return fmt.Errorf("duplicate feed name %q", parts[0])
+		}
+	}
+	*l = append(*l, &ipFeed{name: parts[0], action: parts[1], source: parts[2]})
+	return nil
+}
+
+// setupFeeds loads every feed and keeps them fresh. A feed that can't be
+// loaded at startup is fatal: an empty allow list would expose the very
+// peers it is meant to protect.
+func setupFeeds() error {
+	if len(feeds) == 0 {
+		return nil
+	}
+	if feedRefreshMin < 1 {
+		return fmt.Errorf("-feed-refresh must be at least 1 minute")
+	}
+	for _, f := range feeds {
+		if err := f.refresh(); err != nil {
+			return fmt.Errorf("feed %s: %w", f.name, err)
+		}
+	}
+	go func() {
+		for range time.Tick(minutes(feedRefreshMin)) {
+			for _, f := range feeds {
+				if err := f.refresh(); err != nil {
+					log.Printf("Error refreshing feed %s, keeping the previous list: %v", f.name, err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// refresh reloads the feed from its source. On error the previous entries stay.
+func (f *ipFeed) refresh() error {
+	prefixes, err := f.fetch()
+	feedsMu.Lock()
+	defer feedsMu.Unlock()
+	f.err = err
+	if err != nil {
+		return err
+	}
+	f.prefixes = prefixes
+	f.lengths = f.lengths[:0]
+	for p := range prefixes {
+		if !slices.Contains(f.lengths, p.Bits()) {
+			f.lengths = append(f.lengths, p.Bits())
+		}
+	}
+	f.loaded = clock.Now()
+	return nil
+}
+
+// fetch downloads or reads the feed and parses it
+func (f *ipFeed) fetch() (map[netip.Prefix]bool, error) {
+	if !strings.HasPrefix(f.source, "http://") && !strings.HasPrefix(f.source, "https://") {
+		file, err := os.Open(f.source)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return parseFeed(file)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), feedTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", f.source, resp.Status)
+	}
+	return parseFeed(resp.Body)
+}
+
+// parseFeed reads one IP or CIDR per line. Anything after the address, like
+// the "; SBL123" of Spamhaus DROP, and lines starting with '#' or ';' are
+// ignored; so are lines that don't start with an address.
+func parseFeed(r io.Reader) (map[netip.Prefix]bool, error) {
+	prefixes := make(map[netip.Prefix]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.FieldsFunc(scanner.Text(), func(c rune) bool {
+			return c == ' ' || c == '\t' || c == ';' || c == '#' || c == ','
+		})
+		if len(fields) == 0 {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(fields[0]); err == nil {
+			if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+				prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+			}
+			prefixes[prefix.Masked()] = true
+		} else if addr, err := netip.ParseAddr(fields[0]); err == nil {
+			prefixes[netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())] = true
+		}
+	}
+	return prefixes, scanner.Err()
+}
+
+// contains reports whether ip is on the feed. Must be called with feedsMu held.
+func (f *ipFeed) contains(ip netip.Addr) bool {
+	for _, bits := range f.lengths {
+		if p, err := ip.Prefix(bits); err == nil && f.prefixes[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// feedMatch returns the first feed with the given action listing conn's peer
+func feedMatch(conn *ConnectionInfo, action string) (string, bool) {
+	if len(feeds) == 0 {
+		return "", false
+	}
+	ip, ok := peerAddr(conn)
+	if !ok {
+		return "", false
+	}
+	feedsMu.Lock()
+	defer feedsMu.Unlock()
+	for _, f := range feeds {
+		if f.action == action && f.contains(ip) {
+			return f.name, true
+		}
+	}
+	return "", false
+}
+
+// feedBlockReason returns the kill reason for a peer on a block feed
+func feedBlockReason(conn *ConnectionInfo) (KillReason, bool) {
+	name, ok := feedMatch(conn, FeedBlock)
+	if !ok {
+		return KillReason{}, false
+	}
+	return KillReason{ReasonFeed, fmt.Sprintf("peer %s is on feed %s", peerIP(conn), name)}, true
+}
+
+// FeedStatus is the freshness of one feed, for metrics
+type FeedStatus struct {
+	Name    string
+	Action  string
+	Entries int
+	Loaded  time.Time
+	OK      bool // the last refresh succeeded
+}
+
+// snapshotFeeds returns the status of every feed
+func snapshotFeeds() []FeedStatus {
+	feedsMu.Lock()
+	defer feedsMu.Unlock()
+	out := make([]FeedStatus, 0, len(feeds))
+	for _, f := range feeds {
+		out = append(out, FeedStatus{f.name, f.action, len(f.prefixes), f.loaded, f.err == nil})
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+var (
+	floodRate         float64
+	floodFactor       float64
+	floodMaxActiveMin int
+
+	flooding      bool
+	newRateEWMA   float64
+	lastFloodScan time.Time
+	floodScans    int
+)
+
+func init() {
+	flag.Float64Var(&floodRate, "flood-rate", 0, "Raise a flood alarm when new connections arrive faster than this many per minute (0 disables)")
+	flag.Float64Var(&floodFactor, "flood-factor", 0, "Raise a flood alarm when the new connection rate exceeds this multiple of its moving average (0 disables)")
+	minutesVar(&floodMaxActiveMin, "flood-max-active", 0, "Max active duration in minutes used while a flood alarm is raised (0 keeps the normal thresholds)")
+}
+
+// floodEWMAAlpha weighs the latest cycle in the moving average of the new connection rate
+const floodEWMAAlpha = 0.2
+
+// floodMinRate keeps -flood-factor from firing on a near-idle port, in connections per minute
+const floodMinRate = 1.0
+
+// floodWarmup is the number of cycles averaged before -flood-factor can fire;
+// the first cycle also counts every pre-existing connection as new
+const floodWarmup = 3
+
+// checkFlood compares this cycle's new connections with the flood thresholds,
+// raising or clearing the alarm. Must be called with mu held, before the
+// cycle's decisions, so a flood policy applies right away.
+func checkFlood(newConns int, now time.Time) {
+	if floodRate <= 0 && floodFactor <= 0 {
+		return
+	}
+	defer func() { lastFloodScan = now }()
+	if lastFloodScan.IsZero() {
+		return
+	}
+	elapsed := now.Sub(lastFloodScan).Minutes()
+	if elapsed <= 0 {
+		return
+	}
+	rate := float64(newConns) / elapsed
+	floodScans++
+
+	over := floodRate > 0 && rate >= floodRate
+	if floodFactor > 0 && floodScans > floodWarmup && rate >= floodMinRate && rate >= floodFactor*newRateEWMA {
+		over = true
+	}
+
+	switch {
+	case over && !flooding:
+		flooding = true
+		msg := fmt.Sprintf("%d new connections in %s (%.1f/min, average %.1f/min)", newConns, humanDuration(now.Sub(lastFloodScan)), rate, newRateEWMA)
+		if floodMaxActiveMin > 0 {
+			msg += fmt.Sprintf(", max-active tightened to %s", humanMinutes(floodMaxActiveMin))
+		}
+		alertf(" ! Connection flood on port %s: %s\n", sourcePort, msg)
+		emitEvent(Event{Type: EventFlood, Message: msg})
+	case !over && flooding:
+		flooding = false
+		msg := fmt.Sprintf("new connection rate back to %.1f/min", rate)
+		alertf(" ! Connection flood on port %s over: %s\n", sourcePort, msg)
+		emitEvent(Event{Type: EventFloodEnd, Message: msg})
+	}
+
+	// The average tracks normal traffic only
+	if !flooding {
+		if floodScans == 1 {
+			newRateEWMA = rate
+		} else {
+			newRateEWMA += floodEWMAAlpha * (rate - newRateEWMA)
+		}
+	}
+}
+
+// tightenMaxActive applies the pressure and flood limits to a max-active
+// threshold, in minutes
+func tightenMaxActive(maxActive int) int {
+	if underPressure {
+		maxActive = min(maxActive, pressureMaxActiveMin)
+	}
+	if flooding && floodMaxActiveMin > 0 {
+		maxActive = min(maxActive, floodMaxActiveMin)
+	}
+	return maxActive
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	guardianEnabled   bool
+	guardianThreshold int
+	guardianReap      int
+)
+
+func init() {
+	flag.BoolVar(&guardianEnabled, "guardian", false, "Reap the idlest connections when the owning process nears its fd limit or ephemeral ports near exhaustion")
+	flag.IntVar(&guardianThreshold, "guardian-threshold", 90, "Usage, in percent, of the owner's fd limit or the ephemeral port range that triggers reaping")
+	flag.IntVar(&guardianReap, "guardian-reap", 10, "Maximum connections reaped per cycle by the guardian")
+}
+
+// guardianReapCount checks the owning processes' fd usage and the ephemeral port
+// usage, returning how many connections to reap this cycle (0 when all is well)
+func guardianReapCount(current []*ConnectionInfo) int {
+	// Resource usage is read from this machine, which is meaningless for -remote hosts
+	if !guardianEnabled || remoteMode() {
+		return 0
+	}
+
+	if ports, err := ephemeralPortUsage(); err != nil {
+		log.Printf("Warning: Guardian could not read ephemeral port usage: %v", err)
+	} else if ports >= float64(guardianThreshold) {
+		log.Printf("Guardian: ephemeral port usage at %.0f%%, reaping up to %d connections", ports, guardianReap)
+		return guardianReap
+	}
+
+	checked := make(map[int]bool)
+	for _, conn := range current {
+		if conn.PID <= 0 || checked[conn.PID] {
+			continue
+		}
+		checked[conn.PID] = true
+
+		open, limit, err := processFDUsage(conn.PID)
+		if err != nil {
+			continue // the process may have exited since the listing
+		}
+		if limit > 0 && open*100 >= limit*guardianThreshold {
+			log.Printf("Guardian: %s (pid %d) has %d of %d fds open, reaping up to %d connections", conn.Process, conn.PID, open, limit, guardianReap)
+			return guardianReap
+		}
+	}
+	return 0
+}
+
+// guardianVictims picks the n idlest alive connections not already scheduled
+// for killing, those without traffic for longest first and the oldest among
+// equally idle ones. Pinned and protected connections are left out, as
+// schedule would only keep them. Must be called with mu held.
+func guardianVictims(scheduled []*ConnectionInfo, n int, now time.Time) []*ConnectionInfo {
+	skip := make(map[*ConnectionInfo]bool, len(scheduled))
+	for _, conn := range scheduled {
+		skip[conn] = true
+	}
+
+	var candidates []*ConnectionInfo
+	for _, conn := range connections {
+		if !conn.Alive() || conn.Pinned || skip[conn] {
+			continue
+		}
+		if _, ok := protected.protects(conn); ok {
+			continue
+		}
+		candidates = append(candidates, conn)
+	}
+	sort.Slice(candidates, func(a, b int) bool {
+		idleA, idleB := now.Sub(candidates[a].LastTraffic), now.Sub(candidates[b].LastTraffic)
+		if idleA != idleB {
+			return idleA > idleB
+		}
+		return candidates[a].TimeAdded.Before(candidates[b].TimeAdded)
+	})
+
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
+
+// processFDUsage returns the number of open fds of pid and its soft RLIMIT_NOFILE
+func processFDUsage(pid int) (open, limit int, err error) {
+	entries, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	f, err := os.Open(fmt.Sprintf("/proc/%d/limits", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Max open files") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+		if len(fields) > 0 {
+			limit, _ = strconv.Atoi(fields[0]) // "unlimited" leaves 0
+		}
+		break
+	}
+
+	return len(entries), limit, nil
+}
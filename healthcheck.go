@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"time"
+)
+
+var (
+	healthCheck   bool
+	healthAddr    string
+	healthTimeout int
+)
+
+func init() {
+	flag.BoolVar(&healthCheck, "health-check", false, "Before killing, verify the listener on the monitored port accepts connections; suppress kills if it doesn't")
+	flag.StringVar(&healthAddr, "health-addr", "", "TCP address dialed by the health check (default 127.0.0.1:<port>; required with -protocol udp or sctp)")
+	flag.IntVar(&healthTimeout, "health-timeout", 3, "Health check connect timeout in seconds")
+}
+
+// serviceDown tracks the last health check result so transitions are reported once
+var serviceDown bool
+
+// validateHealthCheck rejects -health-check where dialing the monitored port
+// can't tell whether the service is up
+func validateHealthCheck() error {
+	switch {
+	case !healthCheck:
+		return nil
+	case remoteMode():
+		return fmt.Errorf("-health-check can't be combined with -remote, it would dial this host")
+	case (protocol == "udp" || protocol == "sctp") && healthAddr == "":
+		return fmt.Errorf("-health-check with -protocol %s needs a TCP -health-addr, a %s listener can't be dialed to check it", protocol, protocol)
+	}
+	return nil
+}
+
+// listenerAlive dials the monitored service; an error means it is not accepting connections
+func listenerAlive() error {
+	network, addr := "tcp", healthAddr
+	switch {
+	case addr != "":
+	case protocol == "unix":
+		network, addr = "unix", unixPath
+	default:
+		addr = net.JoinHostPort("127.0.0.1", monitoredPorts()[0])
+	}
+
+	conn, err := net.DialTimeout(network, addr, time.Duration(healthTimeout)*time.Second)
+	if err != nil {
+		return fmt.Errorf("listener %s not accepting connections: %w", addr, err)
+	}
+	conn.Close()
+	return nil
+}
+
+// killsAllowed runs the health check (when enabled) and reports whether kills may proceed.
+// A dead service raises a single service_down event until it comes back.
+func killsAllowed() bool {
+	if !healthCheck {
+		return true
+	}
+
+	err := listenerAlive()
+	switch {
+	case err != nil && !serviceDown:
+		serviceDown = true
+		emitEvent(Event{Type: EventServiceDown, Message: err.Error()})
+	case err == nil && serviceDown:
+		serviceDown = false
+		emitEvent(Event{Type: EventServiceUp, Message: "listener accepting connections again"})
+	}
+	return err == nil
+}
@@ -0,0 +1,102 @@
+//go:build integration
+
+package main
+
+import (
+	"maps"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestMonitorKillsLoopbackConnections runs the monitor against the real ss
+// on connections to a loopback listener. It needs root for 'ss -K' and -p:
+//
+//	sudo go test -tags integration -run Loopback .
+func TestMonitorKillsLoopbackConnections(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to list owners and kill sockets")
+	}
+	if _, err := exec.LookPath("ss"); err != nil {
+		t.Skip("ss not installed")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	const clients = 3
+	accepted := make(chan net.Conn, clients)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	var dialed []net.Conn
+	for range clients {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		dialed = append(dialed, conn)
+		defer (<-accepted).Close()
+	}
+
+	useTestPolicy(t)
+	setFor(t, &warnBeforeMin, 0)
+	setFor(t, &maxInactiveDurMin, 0)
+	setFor(t, &killRootOwned, true)
+	setFor(t, &protocol, "tcp")
+	setFor(t, &sourcePort, strconv.Itoa(ln.Addr().(*net.TCPAddr).Port))
+	setFor[CommandRunner](t, &runner, execRunner{})
+	format, err := probeSSFormat("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	useSSFormat(t, format)
+	manual := useManualClock(t)
+	useEmptyTracker(t)
+
+	// Tracked on the first cycle, killed on the first one past max-active
+	// and confirmed gone on the next, when the tracker drops them
+	tracked := make(map[string]*ConnectionInfo)
+	for range maxActiveDurMin/checkIntervalMin + 3 {
+		monitorConnections()
+		mu.Lock()
+		maps.Copy(tracked, connections)
+		mu.Unlock()
+		manual.Advance(minutes(checkIntervalMin))
+	}
+
+	if len(tracked) != clients {
+		t.Fatalf("tracked %d sockets, want %d", len(tracked), clients)
+	}
+	want := []ConnState{StateNew, StateActive, StateKillPending, StateKilled}
+	for _, conn := range tracked {
+		var got []ConnState
+		for _, change := range conn.Transitions {
+			got = append(got, change.State)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s -> %s: transitions = %v, want %v", conn.LocalAddr, conn.PeerAddr, got, want)
+		}
+	}
+
+	// The clients see their connections cut
+	for _, conn := range dialed {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err == nil || os.IsTimeout(err) {
+			t.Errorf("client %s still connected (%v)", conn.LocalAddr(), err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// keepaliveSysctls are the kernel defaults applied to sockets with
+// SO_KEEPALIVE that don't set their own TCP_KEEPIDLE/INTVL/CNT
+var keepaliveSysctls = []string{"tcp_keepalive_time", "tcp_keepalive_intvl", "tcp_keepalive_probes"}
+
+// keepaliveOwner is the audit of the connections of one owning process
+type keepaliveOwner struct {
+	owner     string
+	total     int
+	keepalive int
+	busy      int // another timer is armed, hiding whether keepalive is set
+	longest   time.Duration
+	shortest  time.Duration
+}
+
+// runKeepaliveAudit implements 'keepalive': it lists the monitored port once
+// and reports, per owning process, how many connections have a keepalive
+// timer armed (ss -o) and when it next fires, flagging the processes whose
+// sockets have none. Those are the listeners that would benefit from
+// SO_KEEPALIVE, letting the kernel drop dead peers on its own.
+func runKeepaliveAudit(args []string) error {
+	// Owners are only visible to root; without it everything is one group
+	if err := prepareOneShot(oneShotFlags("keepalive"), args, os.Geteuid() == 0); err != nil {
+		return err
+	}
+	if protocol != "tcp" {
+		return fmt.Errorf("keepalive only applies to -protocol tcp")
+	}
+	conns, _, err := listCurrentConnections(context.Background())
+	if err != nil {
+		return err
+	}
+
+	var defaults []string
+	for _, name := range keepaliveSysctls {
+		data, err := os.ReadFile("/proc/sys/net/ipv4/" + name)
+		if err == nil {
+			defaults = append(defaults, fmt.Sprintf("%s=%s", name, strings.TrimSpace(string(data))))
+		}
+	}
+	if len(defaults) > 0 && !remoteMode() {
+		fmt.Printf("Kernel keepalive defaults: %s\n", strings.Join(defaults, ", "))
+	}
+
+	owners := make(map[string]*keepaliveOwner)
+	for _, conn := range conns {
+		name := "unknown owner (run as root to see owners)"
+		if conn.PID > 0 {
+			name = fmt.Sprintf("%s/%d", conn.Process, conn.PID)
+		}
+		if origin := conn.origin(); origin != "" {
+			name = origin + ": " + name
+		}
+		o, ok := owners[name]
+		if !ok {
+			o = &keepaliveOwner{owner: name}
+			owners[name] = o
+		}
+		o.total++
+		switch conn.Timer {
+		case "keepalive":
+			o.keepalive++
+			if d, ok := parseSSExpire(conn.TimerExpire); ok {
+				if o.keepalive == 1 || d < o.shortest {
+					o.shortest = d
+				}
+				o.longest = max(o.longest, d)
+			}
+		case "":
+		default:
+			o.busy++
+		}
+	}
+
+	list := make([]*keepaliveOwner, 0, len(owners))
+	for _, o := range owners {
+		list = append(list, o)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].owner < list[b].owner })
+
+	fmt.Printf("Port %s: %d connections\n", sourcePort, len(conns))
+	flagged := 0
+	for _, o := range list {
+		fmt.Printf("  %s: %d of %d with keepalive", o.owner, o.keepalive, o.total)
+		if o.keepalive > 0 {
+			fmt.Printf(", next probe in %s to %s", humanDuration(o.shortest), humanDuration(o.longest))
+		}
+		if o.busy > 0 {
+			fmt.Printf(", %d undetermined (another timer armed)", o.busy)
+		}
+		fmt.Println()
+		if o.keepalive == 0 && o.total > o.busy {
+			fmt.Printf("    ! No keepalive: set SO_KEEPALIVE on this listener (and TCP_KEEPIDLE below the kernel default) so dead peers are dropped by the kernel\n")
+			flagged++
+		}
+	}
+	if flagged == 0 && len(list) > 0 {
+		fmt.Println("Every owner uses keepalive")
+	}
+	return nil
+}
+
+// parseSSExpire parses a timer expiry as ss prints it, e.g. "119min",
+// "1min29sec" or "200ms"
+func parseSSExpire(s string) (time.Duration, bool) {
+	units := []struct {
+		suffix string
+		unit   time.Duration
+	}{{"ms", time.Millisecond}, {"sec", time.Second}, {"min", time.Minute}, {"h", time.Hour}}
+
+	var total time.Duration
+	for s != "" {
+		digits := leadingDigits(s)
+		if digits == "" {
+			return 0, false
+		}
+		n, _ := strconv.Atoi(digits)
+		s = s[len(digits):]
+		found := false
+		for _, u := range units {
+			if rest, ok := strings.CutPrefix(s, u.suffix); ok {
+				total += time.Duration(n) * u.unit
+				s, found = rest, true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return total, true
+}
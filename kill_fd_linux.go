@@ -0,0 +1,47 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"syscall"
+)
+
+// Syscall numbers shared by all non-MIPS Linux architectures (kernel >= 5.6)
+const (
+	sysPidfdOpen  = 434
+	sysPidfdGetfd = 438
+)
+
+// shutdownOwnerSocket duplicates the target's socket descriptor with
+// pidfd_getfd and shuts it down. Closing our copy alone would not affect the
+// owner, but shutdown acts on the shared socket, so the peer gets a FIN and
+// the owning process sees EOF on its next read.
+func shutdownOwnerSocket(pid, fd int, inode string) error {
+	pidfd, _, errno := syscall.Syscall(sysPidfdOpen, uintptr(pid), 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("pidfd_open(%d): %w", pid, errno)
+	}
+	defer syscall.Close(int(pidfd))
+
+	sockfd, _, errno := syscall.Syscall(sysPidfdGetfd, pidfd, uintptr(fd), 0)
+	if errno != 0 {
+		return fmt.Errorf("pidfd_getfd(%d, %d): %w", pid, fd, errno)
+	}
+	defer syscall.Close(int(sockfd))
+
+	// The fd may have been reused since the listing; make sure it is still our socket
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(sockfd), &st); err != nil {
+		return fmt.Errorf("fstat: %w", err)
+	}
+	if strconv.FormatUint(st.Ino, 10) != inode {
+		return fmt.Errorf("fd %d of pid %d now refers to inode %d, not %s", fd, pid, st.Ino, inode)
+	}
+
+	if err := syscall.Shutdown(int(sockfd), syscall.SHUT_RDWR); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux || mips || mipsle || mips64 || mips64le
+
+package main
+
+import "fmt"
+
+// shutdownOwnerSocket is not available without pidfd_getfd
+func shutdownOwnerSocket(pid, fd int, inode string) error {
+	return fmt.Errorf("kill by fd is not supported on this platform")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// killDurationBuckets are the kill latency histogram upper bounds, in seconds
+var killDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// BackendStats are the cumulative kill outcomes of one backend. A kill the
+// backend reported as done but that the next listing still shows established
+// is unconfirmed: the kernel ignored it, and a climbing count is the sign to
+// switch -kill-method.
+type BackendStats struct {
+	Backend     string  `json:"backend"`
+	Attempts    uint64  `json:"attempts"`    // connections the backend was asked to kill
+	Errors      uint64  `json:"errors"`      // attempts the backend itself reported failing
+	Confirmed   uint64  `json:"confirmed"`   // kills the next listing confirmed
+	Unconfirmed uint64  `json:"unconfirmed"` // kills reported done but still established
+	SuccessRate float64 `json:"success_rate"`
+
+	Calls           uint64   `json:"calls"` // commands or syscalls run; a batch is one call
+	DurationSeconds float64  `json:"duration_seconds_sum"`
+	counts          []uint64 // per bucket, non-cumulative; last slot is +Inf
+}
+
+var killStats = struct {
+	sync.Mutex
+	backends map[string]*BackendStats
+}{backends: make(map[string]*BackendStats)}
+
+// backendStats returns the entry of backend, creating it. Must be called with
+// killStats held.
+func backendStats(backend string) *BackendStats {
+	s, ok := killStats.backends[backend]
+	if !ok {
+		s = &BackendStats{Backend: backend, counts: make([]uint64, len(killDurationBuckets)+1)}
+		killStats.backends[backend] = s
+	}
+	return s
+}
+
+// observeKill records one kill call on backend covering n connections
+func observeKill(backend string, n int, took time.Duration, err error) {
+	killStats.Lock()
+	defer killStats.Unlock()
+	s := backendStats(backend)
+	s.Attempts += uint64(n)
+	if err != nil {
+		s.Errors += uint64(n)
+	}
+	seconds := took.Seconds()
+	s.Calls++
+	s.DurationSeconds += seconds
+	s.counts[sort.SearchFloat64s(killDurationBuckets, seconds)]++
+}
+
+// observeConfirmation records whether a kill made by backend took effect
+func observeConfirmation(backend string, confirmed bool) {
+	killStats.Lock()
+	defer killStats.Unlock()
+	s := backendStats(backend)
+	if confirmed {
+		s.Confirmed++
+	} else {
+		s.Unconfirmed++
+	}
+}
+
+// snapshotKillStats copies the per-backend stats, sorted by backend, with the
+// success rate (confirmed kills per attempt) filled in
+func snapshotKillStats() []BackendStats {
+	killStats.Lock()
+	defer killStats.Unlock()
+	out := make([]BackendStats, 0, len(killStats.backends))
+	for _, s := range killStats.backends {
+		c := *s
+		c.counts = append([]uint64(nil), s.counts...)
+		if c.Attempts > 0 {
+			c.SuccessRate = float64(c.Confirmed) / float64(c.Attempts)
+		}
+		out = append(out, c)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Backend < out[b].Backend })
+	return out
+}
+
+// Histogram returns the cumulative latency bucket counts (the last one is +Inf)
+func (s BackendStats) Histogram() []uint64 {
+	cumulative := make([]uint64, len(s.counts))
+	var running uint64
+	for i, c := range s.counts {
+		running += c
+		cumulative[i] = running
+	}
+	return cumulative
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+)
+
+var leaderLock string
+
+func init() {
+	flag.StringVar(&leaderLock, "leader-lock", "", "Lock file on storage shared by an HA pair; only the instance holding it kills, the other tracks in standby")
+}
+
+// leader is true while this instance holds the lock
+var leader atomic.Bool
+
+// leaderFile keeps the locked file open (and the lock held) for the life of the process
+var leaderFile *os.File
+
+// isLeader reports whether this instance may kill
+func isLeader() bool {
+	return leaderLock == "" || leader.Load()
+}
+
+// setupLeaderElection starts competing for -leader-lock. A goroutine blocks on
+// the lock, so a standby takes over as soon as the leader exits and the kernel
+// releases it; the lock is never given up while the process lives.
+func setupLeaderElection() error {
+	if leaderLock == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(leaderLock, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening -leader-lock: %w", err)
+	}
+	leaderFile = f
+
+	if err := lockFile(f, false); err == nil {
+		becomeLeader(f)
+		return nil
+	}
+
+	infof("Standby: %s is held by another instance, tracking without killing\n", leaderLock)
+	go func() {
+		if err := lockFile(f, true); err != nil {
+			log.Printf("Error waiting for leader lock %s: %v", leaderLock, err)
+			return
+		}
+		becomeLeader(f)
+	}()
+	return nil
+}
+
+// becomeLeader records leadership and writes the holder's identity into the lock file
+func becomeLeader(f *os.File) {
+	leader.Store(true)
+	f.Truncate(0)
+	f.WriteAt([]byte(fmt.Sprintf("%s %d\n", eventHost, os.Getpid())), 0)
+
+	msg := fmt.Sprintf("acquired leader lock %s", leaderLock)
+	log.Printf("Leader: %s", msg)
+	emitEvent(Event{Type: EventLeader, Message: msg})
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// lockFile is only implemented on Linux
+func lockFile(f *os.File, block bool) error {
+	return fmt.Errorf("-leader-lock is not supported on this platform")
+}
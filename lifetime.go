@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var lifetimeReportMin int
+
+func init() {
+	minutesVar(&lifetimeReportMin, "lifetime-report-interval", 60, "Minutes between connection lifetime percentile summaries (0 disables)")
+}
+
+// lifetimeBuckets are the histogram upper bounds, in seconds
+var lifetimeBuckets = []float64{60, 300, 900, 1800, 3600, 7200, 14400, 28800, 86400}
+
+// lifetimeSampleSize bounds the reservoir used for percentile estimates;
+// -low-memory lowers it
+var lifetimeSampleSize = 10000
+
+// LifetimeStats records how long tracked connections lived, whether they ended
+// naturally (expired) or were killed, as a histogram plus a sample ring for percentiles
+type LifetimeStats struct {
+	mu      sync.Mutex
+	counts  []uint64 // per bucket, non-cumulative; last slot is +Inf
+	count   uint64
+	sum     float64
+	samples []time.Duration
+	next    int
+}
+
+var lifetimes = &LifetimeStats{counts: make([]uint64, len(lifetimeBuckets)+1)}
+
+// Observe records one connection lifetime
+func (l *LifetimeStats) Observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(lifetimeBuckets, seconds)
+	l.counts[i]++
+	l.count++
+	l.sum += seconds
+
+	if len(l.samples) < lifetimeSampleSize {
+		l.samples = append(l.samples, d)
+	} else {
+		l.samples[l.next] = d
+		l.next = (l.next + 1) % lifetimeSampleSize
+	}
+}
+
+// Percentiles returns the requested percentiles (0-100) of the sampled lifetimes
+func (l *LifetimeStats) Percentiles(ps ...float64) ([]time.Duration, int) {
+	l.mu.Lock()
+	sorted := append([]time.Duration(nil), l.samples...)
+	l.mu.Unlock()
+
+	if len(sorted) == 0 {
+		return nil, 0
+	}
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+
+	out := make([]time.Duration, len(ps))
+	for i, p := range ps {
+		idx := int(p / 100 * float64(len(sorted)-1))
+		out[i] = sorted[idx]
+	}
+	return out, len(sorted)
+}
+
+// Histogram returns cumulative bucket counts (the last one is +Inf), the total count and the sum in seconds
+func (l *LifetimeStats) Histogram() ([]uint64, uint64, float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cumulative := make([]uint64, len(l.counts))
+	var running uint64
+	for i, c := range l.counts {
+		running += c
+		cumulative[i] = running
+	}
+	return cumulative, l.count, l.sum
+}
+
+// Summary renders a one-line percentile report, e.g. "p50 2m, p95 40m, p99 1h58m (n=120)"
+func (l *LifetimeStats) Summary() string {
+	values, n := l.Percentiles(50, 95, 99)
+	if n == 0 {
+		return "no connections have ended yet"
+	}
+	return fmt.Sprintf("p50 %s, p95 %s, p99 %s (n=%d)", humanDuration(values[0]), humanDuration(values[1]), humanDuration(values[2]), n)
+}
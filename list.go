@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// listOwners adds -p to the ss listing. Reading other users' sockets' owners
+// needs root, so 'list' and 'status' leave it out.
+var listOwners = true
+
+// oneShotFlags returns a flag set for subcommand name holding every global
+// flag, to which the subcommand may add its own
+func oneShotFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	flag.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	return fs
+}
+
+// prepareOneShot parses the usual flags, with fs, for a subcommand that lists
+// the monitored port once. owners keeps -p in the listing.
+func prepareOneShot(fs *flag.FlagSet, args []string, owners bool) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if _, ok := protocolFlags[protocol]; !ok {
+		return fmt.Errorf("invalid -protocol %q: must be 'tcp', 'udp', 'sctp' or 'unix'", protocol)
+	}
+	if err := validateRouting(); err != nil {
+		return err
+	}
+	if err := validateTools(); err != nil {
+		return err
+	}
+	if err := setupAllPorts(fs); err != nil {
+		return err
+	}
+	var err error
+	if protected, err = parseNeverTouch(neverTouch); err != nil {
+		return err
+	}
+	if !remoteMode() {
+		if _, err := exec.LookPath(ssPath); err != nil {
+			return fmt.Errorf("ss utility not found (%s). Install iproute2 package or set -ss-path", ssPath)
+		}
+	}
+	listOwners = owners
+	if err := setupSSFormat(); err != nil {
+		return err
+	}
+	return setupDiscovery()
+}
+
+// runList implements 'list' and 'status': one listing of the monitored port
+// under the usual flags, showing what the daemon would track. It runs ss
+// without -p, so it needs no root, and never kills anything. 'list' prints
+// every connection that passes its filter flags, 'status' only the totals.
+func runList(name string, args []string) error {
+	fs := oneShotFlags(name)
+	options := make(map[string]*string)
+	if name == "list" {
+		for _, key := range connFilterKeys {
+			if key.name != "min-age" && key.name != "max-age" {
+				options[key.name] = fs.String(key.name, "", key.usage)
+			}
+		}
+	}
+	if err := prepareOneShot(fs, args, false); err != nil {
+		return err
+	}
+	filter, err := parseConnFilter(func(key string) string {
+		if s, ok := options[key]; ok {
+			return *s
+		}
+		return ""
+	})
+	if err != nil {
+		return err
+	}
+	// Owners need -p, and with it root
+	listOwners = filter.process != "" || filter.sortBy == "process"
+
+	conns, unlisted, err := listCurrentConnections(context.Background())
+	if err != nil {
+		return err
+	}
+
+	states := make(map[string]int)
+	protectedCount := 0
+	for _, conn := range conns {
+		conn.ConnectionID = conn.connectionID()
+		states[conn.TCPState]++
+		if _, ok := protected.protects(conn); ok {
+			protectedCount++
+		}
+	}
+	ownerUnknown := !listOwners && protected.ownerRules()
+	shown, matched := filter.apply(conns, time.Now())
+	if name == "list" {
+		for _, conn := range shown {
+			p := policyFor(conn, maxActiveDurMin)
+			note := ""
+			if why, ok := protected.protects(conn); ok {
+				note = " [never-touch: " + why + "]"
+			} else if ownerUnknown {
+				note = " [owner unknown (run as root for -p)]"
+			}
+			fmt.Printf("%-11s %-50s inode %-9s uid %-5d max-active %s%s\n",
+				conn.TCPState, conn.ConnectionID, conn.Inode, conn.UID, humanMinutes(p.MaxActive), note)
+		}
+	}
+
+	var byState []string
+	for state, n := range states {
+		byState = append(byState, fmt.Sprintf("%s %d", state, n))
+	}
+	sort.Strings(byState)
+	fmt.Printf("Port %s (%s): %d connections would be tracked", sourcePort, protocol, len(conns))
+	if len(byState) > 0 {
+		fmt.Printf(" (%s)", strings.Join(byState, ", "))
+	}
+	fmt.Printf(", %d never-touch", protectedCount)
+	if ownerUnknown {
+		fmt.Printf(" (process and pid rules unchecked: owner unknown, run as root for -p)")
+	}
+	fmt.Println()
+	if name == "list" && len(shown) != len(conns) {
+		fmt.Printf("Showing %d of them (%d match the filter)\n", len(shown), matched)
+	}
+	for origin := range unlisted {
+		fmt.Printf("Could not list %s\n", origin)
+	}
+	if name == "status" {
+		fmt.Printf("Max active %s, max inactive %s, check every %s, kill method %s\n",
+			humanMinutes(maxActiveDurMin), humanMinutes(maxInactiveDurMin), humanMinutes(checkIntervalMin), killMethod)
+	}
+	return nil
+}
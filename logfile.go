@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var (
+	logFile      string
+	logMaxSizeMB int
+	logMaxFiles  int
+)
+
+func init() {
+	flag.StringVar(&logFile, "log-file", "", "Write all output to this file instead of stdout/stderr; SIGUSR2 reopens it (for logrotate)")
+	flag.IntVar(&logMaxSizeMB, "log-max-size", 100, "Rotate -log-file once it exceeds this many MB (0 disables built-in rotation)")
+	flag.IntVar(&logMaxFiles, "log-max-files", 5, "Number of rotated log files kept (<file>.1 is the newest)")
+}
+
+// logSizeCheckInterval is how often the log file size is compared to -log-max-size
+const logSizeCheckInterval = 30 * time.Second
+
+// openLogFile opens -log-file and points stdout and stderr at it. Redirecting the
+// descriptors themselves keeps every writer, including the runtime's own panic
+// output, in the file and synchronous.
+func openLogFile() (*os.File, error) {
+	f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	if err := redirectStdio(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// rotateLogFile shifts <file>.N to <file>.N+1, dropping the oldest, and moves the
+// current file to <file>.1
+func rotateLogFile() {
+	os.Remove(fmt.Sprintf("%s.%d", logFile, logMaxFiles))
+	for i := logMaxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", logFile, i), fmt.Sprintf("%s.%d", logFile, i+1))
+	}
+	if logMaxFiles > 0 {
+		os.Rename(logFile, logFile+".1")
+	} else {
+		os.Remove(logFile)
+	}
+}
+
+// setupLogFile redirects all output to -log-file, rotating it by size and
+// reopening it on SIGUSR2 after an external tool has moved it away
+func setupLogFile() error {
+	if logFile == "" {
+		return nil
+	}
+
+	current, err := openLogFile()
+	if err != nil {
+		return fmt.Errorf("opening -log-file: %w", err)
+	}
+
+	reopen := make(chan os.Signal, 1)
+	signal.Notify(reopen, syscall.SIGUSR2)
+
+	go func() {
+		ticker := clock.NewTicker(logSizeCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-reopen:
+			case <-ticker.C():
+				info, err := current.Stat()
+				if logMaxSizeMB <= 0 || err != nil || info.Size() < int64(logMaxSizeMB)<<20 {
+					continue
+				}
+				rotateLogFile()
+			}
+
+			f, err := openLogFile()
+			if err != nil {
+				log.Printf("Error reopening log file: %v", err)
+				continue
+			}
+			current.Close()
+			current = f
+			log.Printf("Log file %s reopened", logFile)
+		}
+	}()
+	return nil
+}
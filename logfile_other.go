@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// redirectStdio is only implemented on Linux
+func redirectStdio(f *os.File) error {
+	return fmt.Errorf("-log-file is not supported on this platform")
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"runtime/debug"
+)
+
+var lowMemory bool
+
+func init() {
+	flag.BoolVar(&lowMemory, "low-memory", lowMemoryDefault, "Trade CPU for memory on small routers: collect garbage sooner, cap the heap and keep shorter histories")
+}
+
+// Limits applied by -low-memory
+const (
+	lowMemoryGCPercent   = 50
+	lowMemoryLimit       = 24 << 20 // soft; the GC works harder above it
+	lowMemoryLifetimes   = 1000
+	lowMemoryDigestLimit = 10000
+)
+
+// setupLowMemory applies the -low-memory profile. GOGC and GOMEMLIMIT, when
+// set, still win.
+func setupLowMemory() {
+	if !lowMemory {
+		return
+	}
+	if os.Getenv("GOGC") == "" {
+		debug.SetGCPercent(lowMemoryGCPercent)
+	}
+	if os.Getenv("GOMEMLIMIT") == "" {
+		debug.SetMemoryLimit(lowMemoryLimit)
+	}
+	lifetimeSampleSize = lowMemoryLifetimes
+	digestMaxEntries = lowMemoryDigestLimit
+	infof("Low memory profile: GC at %d%%, %d MiB soft heap limit, %d lifetime samples\n", lowMemoryGCPercent, lowMemoryLimit>>20, lowMemoryLifetimes)
+}
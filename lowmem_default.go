@@ -0,0 +1,7 @@
+//go:build !lowmem
+
+package main
+
+// lowMemoryDefault is the -low-memory default; build with -tags lowmem to
+// turn it on for constrained targets
+const lowMemoryDefault = false
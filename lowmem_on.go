@@ -0,0 +1,6 @@
+//go:build lowmem
+
+package main
+
+// lowMemoryDefault is the -low-memory default of a -tags lowmem build
+const lowMemoryDefault = true
@@ -2,14 +2,18 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
-	"os/user"
-	"regexp"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -21,31 +25,91 @@ var (
 	checkIntervalMin  int
 	maxActiveDurMin   int
 	maxInactiveDurMin int
-	
+	killMethod        string
+	killBatchSize     int
+	dryRun            bool
+	maxPersistMin     int
+	maxZeroWindowMin  int
+	pinFile           string
+	maxLineKB         int
+
 	connections = make(map[string]*ConnectionInfo)
 	mu          sync.Mutex
-	inodeRegex = regexp.MustCompile(`ino:([0-9]+)`)
 )
 
 // ConnectionInfo stores the state of a tracked connection
 type ConnectionInfo struct {
-	Inode        string    
-	TimeAdded    time.Time
-	LastSeen     time.Time
-	IsActive     bool      
-	ConnectionID string    
+	Inode           string        `json:"inode"`
+	Host            string        `json:"host,omitempty"` // remote host the connection was listed on
+	TimeAdded       time.Time     `json:"time_added"`
+	LastSeen        time.Time     `json:"last_seen"`
+	State           ConnState     `json:"state"`
+	StateSince      time.Time     `json:"state_since"`
+	Transitions     []StateChange `json:"transitions"`
+	ConnectionID    string        `json:"connection"`
+	LocalAddr       string        `json:"local_addr"`
+	PeerAddr        string        `json:"peer_addr"`
+	ClientIP        string        `json:"client_ip,omitempty"` // real client behind a proxy, from -client-map
+	Process         string        `json:"process,omitempty"`
+	PID             int           `json:"pid"`
+	FD              int           `json:"fd"`
+	UID             int           `json:"uid"`                    // socket owner's uid from 'ss -e', -1 if unknown
+	Netns           string        `json:"netns,omitempty"`        // network namespace, with -all-netns
+	PeerProcess     string        `json:"peer_process,omitempty"` // other end of a unix socket
+	PeerPID         int           `json:"peer_pid,omitempty"`
+	Pinned          bool          `json:"pinned"`
+	PinReason       string        `json:"pin_reason,omitempty"`
+	Timer           string        `json:"timer,omitempty"`            // ss -o timer name: on, keepalive, timewait, persist
+	TimerExpire     string        `json:"timer_expire,omitempty"`     // time until the timer fires, as printed by ss
+	TimerRetrans    int           `json:"timer_retrans,omitempty"`    // retransmissions/probes sent by the timer
+	PersistSince    time.Time     `json:"persist_since,omitzero"`     // first cycle the persist (zero-window) timer was seen
+	SndWnd          int           `json:"snd_wnd"`                    // peer's advertised receive window from tcp_info, -1 if unknown
+	ZeroWindowSince time.Time     `json:"zero_window_since,omitzero"` // first cycle the peer's window was seen at zero
+	TCPState        string        `json:"tcp_state"`
+	BytesSent       int64         `json:"bytes_sent"`                // cumulative, from tcp_info
+	BytesReceived   int64         `json:"bytes_received"`            // cumulative, from tcp_info
+	SegsOut         int64         `json:"segs_out"`                  // cumulative, from tcp_info
+	SegsIn          int64         `json:"segs_in"`                   // cumulative, from tcp_info
+	SendRate        float64       `json:"send_rate"`                 // bytes/s sent since the previous cycle
+	RecvRate        float64       `json:"recv_rate"`                 // bytes/s received since the previous cycle
+	RTTMs           float64       `json:"rtt_ms"`                    // smoothed RTT from tcp_info
+	RTTVarMs        float64       `json:"rtt_var_ms"`                // RTT variance from tcp_info
+	Retrans         int64         `json:"retrans"`                   // total retransmitted segments
+	RetransRate     float64       `json:"retrans_rate"`              // retransmitted segments per segment sent
+	ThroughputSince time.Time     `json:"throughput_since,omitzero"` // first cycle throughput was above -max-throughput
+	LastTraffic     time.Time     `json:"last_traffic,omitzero"`     // last cycle the byte counters moved, or the first one seen
+	trafficSampled  time.Time
+	KillFailures    int        `json:"kill_failures,omitempty"`
+	NextKillAttempt time.Time  `json:"next_kill_attempt,omitzero"`
+	Raw             string     `json:"-"` // latest ss line, for -debug
+	PendingReason   KillReason `json:"-"`
 }
 
 func init() {
 	// Configure command-line flags and help messages in English
 	flag.StringVar(&sourcePort, "port", "50090", "Source port to be monitored (e.g., 50090)")
-	flag.IntVar(&checkIntervalMin, "check-interval", 30, "Check interval in minutes (e.g., 30)")
-	flag.IntVar(&maxActiveDurMin, "max-active", 120, "Maximum allowed active duration in minutes (e.g., 120 for 2h)")
-	flag.IntVar(&maxInactiveDurMin, "max-inactive", 60, "Time unused before being removed from list, in minutes (e.g., 60 for 1h)")
+	minutesVar(&checkIntervalMin, "check-interval", 30, "Check interval in minutes or as a duration (e.g., 30, '90 min' or 1.5h)")
+	minutesVar(&maxActiveDurMin, "max-active", 120, "Maximum allowed active duration in minutes or as a duration (e.g., 120 or 2h)")
+	minutesVar(&maxInactiveDurMin, "max-inactive", 60, "Time unused before being removed from list, in minutes or as a duration (e.g., 60 or 1h)")
+	minutesVar(&maxPersistMin, "max-persist", 0, "Kill connections whose persist (zero-window probe) timer has run for longer than this many minutes (0 disables)")
+	minutesVar(&maxZeroWindowMin, "max-zero-window", 0, "Kill connections whose peer has advertised a zero receive window for longer than this many minutes (0 disables)")
+	flag.StringVar(&pinFile, "pin-file", "", "File listing pinned connections ('<inode|peer-ip|peer-ip:port> <reason>' per line), re-read every cycle")
+	flag.BoolVar(&dryRun, "dry-run", false, "Track and report connections but never kill any")
+	flag.IntVar(&killBatchSize, "kill-batch-size", 50, "Maximum connections destroyed by a single 'ss --kill' invocation (1 disables batching)")
+	flag.StringVar(&killMethod, "kill-method", "ss", "Kill backend: 'ss' (socket destroy via ss --kill) or 'fd' (shutdown through the owner's file descriptor)")
+	flag.IntVar(&maxLineKB, "max-line-size", 1024, "Longest ss output line accepted, in KB; sockets shared by many processes have long 'users:' lists")
 
 	// Define a custom usage function for clear help output
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args)
+		fmt.Fprintf(os.Stderr, "       %s completion bash|zsh|fish\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s export [-format csv] [-since 7d] [json-log...]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s list|status [options]   (no root needed)\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s keepalive [options]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s sysctl [-apply -yes] [options]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s config [-api URL] history|rollback <version>\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s policy [-api URL] diff <file>\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s bench [-lines 100000] [-cycles 10] [-churn 5]\n", filepath.Base(os.Args[0]))
 		fmt.Fprintf(os.Stderr, "Monitors, tracks, and kills TCP connections on a specific source port.\n\nOptions:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nNOTE: This program MUST be run as root (sudo).\n")
@@ -53,25 +117,296 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "completion" {
+		if err := runCompletion(os.Args[2:]); err != nil {
+			fatal(fmt.Errorf("Completion error: %w", err))
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := runExport(os.Args[2:]); err != nil {
+			fatal(fmt.Errorf("Export error: %w", err))
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "sysctl" {
+		if err := runSysctlAdvisor(os.Args[2:]); err != nil {
+			fatal(fmt.Errorf("Sysctl advisor error: %w", err))
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := runBench(os.Args[2:]); err != nil {
+			fatal(fmt.Errorf("Bench error: %w", err))
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfigCommand(os.Args[2:]); err != nil {
+			fatal(fmt.Errorf("Config error: %w", err))
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "policy" {
+		if err := runPolicyCommand(os.Args[2:]); err != nil {
+			fatal(fmt.Errorf("Policy error: %w", err))
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "keepalive" {
+		if err := runKeepaliveAudit(os.Args[2:]); err != nil {
+			fatal(fmt.Errorf("Keepalive audit error: %w", err))
+		}
+		return
+	}
+	if len(os.Args) > 1 && (os.Args[1] == "list" || os.Args[1] == "status") {
+		if err := runList(os.Args[1], os.Args[2:]); err != nil {
+			fatal(fmt.Errorf("List error: %w", err))
+		}
+		return
+	}
+
 	flag.Parse()
 
+	if observeOnly() {
+		dryRun = true
+	}
+
+	if killMethod != "ss" && killMethod != "fd" {
+		fatal(configErrorf("Invalid -kill-method %q: must be 'ss' or 'fd'", killMethod))
+	}
+	if _, ok := protocolFlags[protocol]; !ok {
+		fatal(configErrorf("Invalid -protocol %q: must be 'tcp', 'udp', 'sctp' or 'unix'", protocol))
+	}
+	if protocol == "unix" && (unixPath == "" || strings.ContainsAny(unixPath, " \t")) {
+		fatal(configErrorf("-protocol unix needs a -unix-path without whitespace"))
+	}
+	if allNetns && remoteMode() {
+		fatal(configErrorf("-all-netns can't be combined with -remote"))
+	}
+	if err := validateHealthCheck(); err != nil {
+		fatal(asConfig("Invalid health check", err))
+	}
+	if err := validateRouting(); err != nil {
+		fatal(asConfig("Invalid routing scope", err))
+	}
+	if err := validateTools(); err != nil {
+		fatal(asConfig("Invalid tool configuration", err))
+	}
+	if !destroySupported() && killMethod == "ss" {
+		log.Printf("Warning: ss cannot destroy %s sockets, using -kill-method fd", protocol)
+		killMethod = "fd"
+	}
+	if err := setupAllPorts(flag.CommandLine); err != nil {
+		fatal(asConfig("Invalid -all-ports settings", err))
+	}
+	var err error
+	if protected, err = parseNeverTouch(neverTouch); err != nil {
+		fatal(&ConfigError{err})
+	}
+	if escalateSignal != "" {
+		if _, err := escalationSignal(); err != nil {
+			fatal(asConfig("Invalid escalation settings", err))
+		}
+	}
+	if escalateWindowMin < 0 || escalateBanMinutes < 1 {
+		fatal(configErrorf("Invalid escalation settings: -escalate-window must not be negative and -escalate-ban-minutes must be at least 1"))
+	}
+	if floodRate < 0 || floodFactor < 0 || floodMaxActiveMin < 0 {
+		fatal(configErrorf("Invalid flood settings: -flood-rate, -flood-factor and -flood-max-active must not be negative"))
+	}
+	if maxLineKB < 1 {
+		fatal(configErrorf("Invalid -max-line-size %d: must be at least 1", maxLineKB))
+	}
+	if killBatchSize < 1 {
+		fatal(configErrorf("Invalid -kill-batch-size %d: must be at least 1", killBatchSize))
+	}
+	if collectIntervalMin < 0 || collectIntervalMin > 0 && collectIntervalMin >= maxInactiveDurMin {
+		fatal(configErrorf("Invalid -collect-interval %d: must be below -max-inactive %d, or connections would expire between listings", collectIntervalMin, maxInactiveDurMin))
+	}
+	if killRetries < 1 {
+		fatal(configErrorf("Invalid -kill-retries %d: must be at least 1", killRetries))
+	}
+	if crashDir != "" {
+		if info, err := os.Stat(crashDir); err != nil || !info.IsDir() {
+			fatal(configErrorf("Invalid -crash-dir %s: not a directory", crashDir))
+		}
+	}
+	if quietOutput && (verboseOutput || debugOutput) {
+		fatal(configErrorf("-quiet cannot be combined with -verbose or -debug"))
+	}
+	if pressureLowPct > pressureHighPct {
+		fatal(configErrorf("Invalid -pressure-low %d: must not exceed -pressure-high %d", pressureLowPct, pressureHighPct))
+	}
+
+	if err := setupTimeFormat(); err != nil {
+		fatal(asConfig("Invalid time settings", err))
+	}
+
+	if daemonMode && logFile == "" {
+		fatal(configErrorf("-daemon needs -log-file, as a detached daemon has no terminal"))
+	}
+	if supervise && !daemonMode {
+		fatal(configErrorf("-supervise needs -daemon"))
+	}
+	if err := daemonize(); err != nil {
+		fatal(asConfig("Daemon error", err))
+	}
+
+	if err := setupLogFile(); err != nil {
+		fatal(asConfig("Log file error", err))
+	}
+
+	if err := setupOutputFormat(); err != nil {
+		fatal(asConfig("Output error", err))
+	}
+
+	if err := setupPrettyOutput(); err != nil {
+		fatal(asConfig("Output error", err))
+	}
+
+	if err := setupDigests(); err != nil {
+		fatal(asConfig("Digest error", err))
+	}
+
+	if err := validateReputation(); err != nil {
+		fatal(asConfig("Reputation error", err))
+	}
+	if err := validateRestart(); err != nil {
+		fatal(asConfig("Restart error", err))
+	}
+	if err := setupChaos(); err != nil {
+		fatal(asConfig("Chaos error", err))
+	}
+	if err := setupCanary(); err != nil {
+		fatal(asConfig("Canary error", err))
+	}
+
+	setupLowMemory()
+
+	if err := setupNotifiers(); err != nil {
+		fatal(asConfig("Notifier error", err))
+	}
+	if err := setupPlugins(); err != nil {
+		fatal(asConfig("Plugin error", err))
+	}
+
+	if err := setupMetricsWriters(); err != nil {
+		fatal(asConfig("Metrics error", err))
+	}
+
+	if err := setupAPI(); err != nil {
+		fatal(asConfig("Management API error", err))
+	}
+
 	// 1. Check environment (Linux, ss in PATH, root UID)
 	if err := checkEnvironment(); err != nil {
-		log.Fatalf("Environment error: %v", err)
+		fatal(asEnv("Environment error", err))
+	}
+	if err := setupSSFormat(); err != nil {
+		fatal(asEnv("Environment error", err))
+	}
+	if err := setupDiscovery(); err != nil {
+		fatal(asConfig("Port discovery error", err))
+	}
+	if err := checkSockDestroy(); err != nil {
+		fatal(asEnv("Environment error", err))
 	}
 
-	fmt.Printf("Monitoring started on port: %s\n", sourcePort)
-	fmt.Printf("Check Interval: %d min\n", checkIntervalMin)
-	fmt.Printf("Max Active Duration: %d min\n", maxActiveDurMin)
-	fmt.Printf("Max Inactive Duration: %d min\n", maxInactiveDurMin)
+	infof("Monitoring started on port: %s\n", sourcePort)
+	if restartThreshold > 0 {
+		infof("Leak Restart: %d kills of one process within %s runs: %s\n", restartThreshold, humanMinutes(restartWindowMin), restartCmd)
+	}
+	if discovering() {
+		infof("Port Discovery: %s, every %s\n", discoveryTargets(), humanMinutes(discoverIntervalMin))
+	}
+	infof("Check Interval: %s\n", humanMinutes(checkIntervalMin))
+	if collectIntervalMin > 0 {
+		infof("Collect Interval: %s\n", humanMinutes(collectIntervalMin))
+	}
+	if reputationThreshold > 0 {
+		infof("Reputation: peers scoring below %d get max-active %s (half-life %s)\n", reputationThreshold, humanMinutes(reputationMaxActiveMin), humanMinutes(reputationHalfLifeMin))
+	}
+	if canarySettings != "" {
+		infof("Canary: %s for %d%% of peers during %s\n", canarySettings, canaryPercent, humanMinutes(canaryMinutes))
+	}
+	if chaosPercent > 0 {
+		infof("Chaos: killing %g%% of connections every %s (window: %s)\n", chaosPercent, humanMinutes(chaosIntervalMin), cmp.Or(chaosWindows, "any time"))
+	}
+	if len(policyIntervals) > 0 {
+		infof("Policy Intervals: %s (min)\n", policyIntervals.String())
+	}
+	infof("Max Active Duration: %s\n", humanMinutes(maxActiveDurMin))
+	infof("Max Inactive Duration: %s\n", humanMinutes(maxInactiveDurMin))
+	infof("Kill Method: %s\n", killMethod)
+	if !killRootOwned {
+		infof("Root and kernel-owned sockets: left alone (-kill-root-owned to allow)\n")
+	}
+	if killCmd != "" {
+		infof("Kill Command: %s\n", killCmd)
+	}
+	if remoteMode() {
+		infof("Remote Hosts (read-only, over SSH): %s\n", remoteHosts)
+	} else if dryRun {
+		infof("Dry Run: connections will not be killed\n")
+	}
+	if pinFile != "" {
+		infof("Pin File: %s\n", pinFile)
+	}
+	reportListenerGroup()
+	for _, sc := range scopes {
+		infof("Scope %s: %+v\n", sc.label(), policyFor(sc.example(), maxActiveDurMin))
+	}
+
+	if jsonOutput {
+		printJSONStart()
+	}
+
+	if err := setupFeeds(); err != nil {
+		fatal(asConfig("Feed error", err))
+	}
+	for _, f := range snapshotFeeds() {
+		infof("Feed %s (%s): %d entries, refreshed every %s\n", f.Name, f.Action, f.Entries, humanMinutes(feedRefreshMin))
+	}
+	recordConfig("startup")
+	if err := setupConsulConfig(); err != nil {
+		fatal(asConfig("Consul config error", err))
+	}
+
+	if err := setupLeaderElection(); err != nil {
+		fatal(asConfig("Leader election error", err))
+	}
+
+	startWatchdog()
+	startCollector()
 
 	// Start the loop immediately and then every interval
-	ticker := time.NewTicker(time.Duration(checkIntervalMin) * time.Minute)
+	ticker := clock.NewTicker(minutes(checkIntervalMin))
 	defer ticker.Stop()
 
+	lastLifetimeReport := clock.Now()
+	analyzeUntil := clock.Now().Add(minutes(analyzeMin))
 	for {
-		monitorConnections()
-		<-ticker.C
+		applyRemoteConfig()
+		stats := monitorConnections()
+		writeCycleMetrics(stats)
+		digestCycle(stats)
+		sendDueDigests(clock.Now())
+		reportCanary(clock.Now())
+
+		if analyzeMin > 0 && !clock.Now().Before(analyzeUntil) {
+			printThresholdSuggestion()
+			return
+		}
+
+		if lifetimeReportMin > 0 && clock.Now().Sub(lastLifetimeReport) >= minutes(lifetimeReportMin) {
+			infof("Connection lifetimes: %s\n", lifetimes.Summary())
+			if jsonOutput {
+				printJSON(outputLine{Type: "lifetimes", Message: lifetimes.Summary()})
+			}
+			lastLifetimeReport = clock.Now()
+		}
+		<-ticker.C()
 	}
 }
 
@@ -81,149 +416,750 @@ func checkEnvironment() error {
 		return fmt.Errorf("this script only works on Linux. Current OS: %s", runtime.GOOS)
 	}
 
-	// Check if 'ss' is in PATH
-	if _, err := exec.LookPath("ss"); err != nil {
-		return fmt.Errorf("ss utility not found in PATH. Install iproute2 package")
+	// Remote mode only needs ssh, and no privileges on this machine
+	if remoteMode() {
+		if _, err := exec.LookPath(strings.Fields(sshCommand)[0]); err != nil {
+			return fmt.Errorf("ssh client not found in PATH: %w", err)
+		}
+		return nil
 	}
 
-	// Check if user is root
-	currentUser, err := user.Current()
-	if err != nil {
-		return fmt.Errorf("could not determine current user: %w", err)
+	// Check if 'ss' is in PATH, or at -ss-path
+	if _, err := exec.LookPath(ssPath); err != nil {
+		return fmt.Errorf("ss utility not found (%s). Install iproute2 package or set -ss-path", ssPath)
+	}
+	if allNetns {
+		if _, err := exec.LookPath(nsenterPath); err != nil {
+			return fmt.Errorf("-all-netns needs nsenter (%s). Install util-linux package or set -nsenter-path", nsenterPath)
+		}
 	}
 
-	// UID 0 is root on Linux
-	if currentUser.Uid != "0" {
-		return fmt.Errorf("this program must be run as root (sudo). Current UID: %s", currentUser.Uid)
+	// Check if user is root. Geteuid is a plain syscall, unlike user.Current,
+	// which goes through libc when cgo is on and misbehaves on musl.
+	if uid := os.Geteuid(); uid != 0 {
+		return fmt.Errorf("this program must be run as root (sudo). Current UID: %d", uid)
 	}
 
 	return nil
 }
 
-func monitorConnections() {
-	mu.Lock()
-	defer mu.Unlock()
+// CycleStats summarizes one monitoring cycle for the metrics writers
+type CycleStats struct {
+	Start        time.Time
+	Duration     time.Duration
+	Tracked      int
+	New          int
+	Killed       int
+	Expired      int
+	Errors       int
+	ErrorClasses map[string]int // errors by class, see errorClass
+	Reasons      map[string]int // kills and removals by reason code
+	Quality      QualitySnapshot
+	RSSBytes     int64         // the daemon's resident memory after the cycle
+	CPUTime      time.Duration // the daemon's total CPU time since start
+	ScanPeers    int           // peers of a probable port scan seen this cycle
+}
 
-	fmt.Println("\n--- Executing monitoring cycle:", time.Now().Format(time.RFC1123), "---")
+// countReason tallies a kill or removal under its reason code
+func (s *CycleStats) countReason(code string) {
+	if s.Reasons == nil {
+		s.Reasons = make(map[string]int)
+	}
+	s.Reasons[code]++
+}
 
-	currentConnsList, err := listCurrentConnections()
+// monitorConnections runs one cycle. mu is only held while the tracked map is
+// read or updated, never across the ss listing or kill commands, so API
+// readers are not blocked behind external processes.
+func monitorConnections() (stats CycleStats) {
+	stats.Start = clock.Now()
+	beginCycle()
+	defer func() {
+		stats.Duration = clock.Now().Sub(stats.Start)
+		mu.Lock()
+		stats.Tracked = len(connections)
+		stats.Quality = takeQualitySnapshot()
+		recordChanges()
+		mu.Unlock()
+		stats.RSSBytes, stats.CPUTime = selfUsage()
+		endCycle()
+	}()
+
+	// A panicking cycle is reported and counted as an error instead of stopping
+	// the daemon, and must not leave the tracker locked
+	locked := false
+	defer func() {
+		if r := recover(); r != nil {
+			if locked {
+				mu.Unlock()
+			}
+			reportPanic("monitoring cycle", r)
+			emitEvent(Event{Type: EventMonitorError, Message: fmt.Sprintf("monitoring cycle panicked: %v", r)})
+			stats.countError(fmt.Errorf("monitoring cycle panicked: %v", r))
+		}
+	}()
+
+	printCycleHeader(stats.Start)
+
+	// 1. List current connections (or take the collector's snapshot) and read
+	// pins without holding the lock
+	currentConnsList, unlisted, listedAt, err := takeListing()
+	fresh := !listedAt.IsZero()
 	if err != nil {
 		log.Printf("Error listing connections: %v", err)
-		return
+		emitEvent(Event{Type: EventMonitorError, Message: fmt.Sprintf("listing connections: %v", err), ErrorClass: errorClass(err)})
+		stats.countError(err)
+		return stats
+	}
+	if n := parseErrors.Swap(0); n > 0 {
+		stats.countErrors("parse", int(n))
 	}
+	pins := readPins()
+	reloadClientMap(clock.Now())
+	liftBans(clock.Now())
+	decayReputations(clock.Now())
+	reapCount := guardianReapCount(currentConnsList)
+	due := duePolicies(clock.Now())
+	var pluginVerdicts map[string]KillReason
+	if due["plugin"] {
+		pluginVerdicts = evaluatePolicyPlugins(currentConnsList, clock.Now())
+	}
+
+	mu.Lock()
+	locked = true
+
+	now := clock.Now()
+	activeLimitMin := currentMaxActiveMin()
 
-	for _, conn := range connections {
-		conn.IsActive = false
+	// held reports connections whose absence from this listing proves nothing:
+	// those of a host or namespace whose listing failed, or all of them while
+	// a sudden empty listing is unconfirmed. Only a listing started after a
+	// kill can confirm it.
+	suspect := fresh && suspectEmptyListing(len(currentConnsList))
+	held := func(conn *ConnectionInfo) bool {
+		return suspect || len(unlisted) > 0 && unlisted[conn.origin()] ||
+			conn.State == StateKillPending && !listedAt.After(conn.StateSince)
 	}
 
-	now := time.Now()
+	// Without a new listing, seen still holds the last one
+	seen := seenBuf
+	if fresh {
+		clear(seen)
+	} else {
+		verbosef("No new listing since the last check, evaluating tracked connections\n")
+	}
+	merged := currentConnsList[:0] // entries already read are overwritten in place
 	for _, currentConn := range currentConnsList {
-		if connInfo, exists := connections[currentConn.Inode]; exists {
+		seen[currentConn.key()] = true
+		if connInfo, exists := connections[currentConn.key()]; exists {
 			connInfo.LastSeen = now
-			connInfo.IsActive = true
+			connInfo.TCPState = currentConn.TCPState
+			connInfo.Raw = currentConn.Raw
+			connInfo.updateTimer(currentConn, now)
+			connInfo.updateWindow(currentConn, now)
+			connInfo.updateTraffic(currentConn, now)
+			connInfo.mapClient()
+			reputationSample(connInfo, now)
+			connInfo.updateThroughputSince(now, policyFor(connInfo, activeLimitMin).MaxThroughput)
+			connInfo.updateQuality(currentConn)
+			if connInfo.State == StateNew || connInfo.State == StateMissing {
+				connInfo.setState(StateActive, now)
+			}
+			merged = append(merged, currentConn)
 		} else {
-			connections[currentConn.Inode] = currentConn
+			currentConn.ConnectionID = currentConn.connectionID()
+			connections[currentConn.key()] = currentConn
 			currentConn.TimeAdded = now
 			currentConn.LastSeen = now
-			fmt.Printf(" + New connection tracked (Inode %s): %s\n", currentConn.Inode, currentConn.ConnectionID)
+			currentConn.setState(StateNew, now)
+			currentConn.updateTimer(currentConn, now)
+			currentConn.updateWindow(currentConn, now)
+			currentConn.updateTraffic(currentConn, now)
+			currentConn.mapClient()
+			reportConn(rowNew, currentConn, "", " + New connection tracked (Inode %s): %s\n", currentConn.Inode, currentConn.ConnectionID)
+			emitEvent(connEvent(EventNew, currentConn, ""))
+			stats.New++
 		}
 	}
+	releaseConns(merged)
+
+	// Live connections absent from the listing are missing; kill states are kept
+	for inode, conn := range connections {
+		if fresh && !seen[inode] && conn.Alive() && !held(conn) {
+			conn.setState(StateMissing, now)
+		}
+	}
+
+	stats.ScanPeers = len(detectScan(now))
+
+	// A burst of new connections may switch to the flood thresholds
+	if fresh {
+		checkFlood(stats.New, now)
+	}
+	activeLimitMin = tightenMaxActive(activeLimitMin)
+
+	// 2. Refresh operator pins
+	applyPins(pins)
 
 	// 3. Process connections to kill or remove
+	var toKill []*ConnectionInfo
+	var killReasons []KillReason
+
+	// schedule queues a kill, honouring pins, standby and dry-run
+	schedule := func(conn *ConnectionInfo, reason KillReason) {
+		traceDecision(conn, now, "kill: "+reason.String())
+		if why, ok := protected.protects(conn); ok {
+			reportConn(rowPinned, conn, fmt.Sprintf("%s [never-touch: %s]", reason, why),
+				" = Keeping protected connection (%s, Inode %s): %s [never-touch: %s]\n", reason, conn.Inode, conn.ConnectionID, why)
+			return
+		}
+		if conn.Pinned {
+			reportConn(rowPinned, conn, fmt.Sprintf("%s [%s]", reason, conn.PinReason),
+				" = Keeping pinned connection (%s, Inode %s): %s [%s]\n", reason, conn.Inode, conn.ConnectionID, conn.PinReason)
+			return
+		}
+		if !isLeader() {
+			reportConn(rowWouldKill, conn, "standby: "+reason.String(), " ? Standby, would kill connection (%s, Inode %s): %s\n", reason, conn.Inode, conn.ConnectionID)
+			return
+		}
+		if degraded {
+			reportConn(rowWouldKill, conn, "degraded: "+reason.String(), " ? Degraded, would kill connection (%s, Inode %s): %s\n", reason, conn.Inode, conn.ConnectionID)
+			return
+		}
+		if dryRun || observeOnly() {
+			reportConn(rowWouldKill, conn, reason.String(), " ? Would kill connection (%s, Inode %s): %s\n", reason, conn.Inode, conn.ConnectionID)
+			return
+		}
+		toKill = append(toKill, conn)
+		killReasons = append(killReasons, reason)
+	}
+
 	for inode, conn := range connections {
-		// A. Kill active connections older than maxActiveDurMin
-		maxActiveDuration := time.Duration(maxActiveDurMin) * time.Minute
-		if now.Sub(conn.TimeAdded) > maxActiveDuration && conn.IsActive {
-			fmt.Printf(" x Killing active connection (>%d min, Inode %s): %s\n", maxActiveDurMin, inode, conn.ConnectionID)
-			killConnection(inode) 
-			delete(connections, inode) 
+		if held(conn) {
+			traceDecision(conn, now, "no listing to judge it by this cycle, kept as is")
+			continue
+		}
+
+		// Killed connections are only dropped once a listing confirms they are gone
+		if conn.State == StateKillPending {
+			traceDecision(conn, now, "checking kill confirmation")
+			confirmKill(conn, seen[inode], now)
 			continue
 		}
 
-		// B. Remove connections inactive for longer than maxInactiveDurMin
-		maxInactiveDuration := time.Duration(maxInactiveDurMin) * time.Minute
+		// A. Remove connections inactive for longer than maxInactiveDurMin
+		maxInactiveDuration := minutes(maxInactiveDurMin)
 		if now.Sub(conn.LastSeen) > maxInactiveDuration {
-			fmt.Printf(" - Removing inactive connection (>%d min, Inode %s): %s\n", maxInactiveDurMin, inode, conn.ConnectionID)
+			reason := KillReason{ReasonInactive, fmt.Sprintf("not seen for more than %s", humanMinutes(maxInactiveDurMin))}
+			traceDecision(conn, now, "remove: "+reason.String())
+			conn.setState(StateExpired, now)
+			reportConn(rowExpired, conn, reason.String(), " - Removing inactive connection (%s, Inode %s): %s\n", reason, conn.Inode, conn.ConnectionID)
+			emitEvent(reasonEvent(EventExpired, conn, reason))
+			stats.Expired++
+			stats.countReason(reason.Code)
+			lifetimes.Observe(conn.LastSeen.Sub(conn.TimeAdded))
+			reputationLifetime(conn, conn.LastSeen.Sub(conn.TimeAdded), now)
+			digestExpired(conn.LastSeen.Sub(conn.TimeAdded), now)
+			forgetCanary(conn)
 			delete(connections, inode)
 			continue
 		}
+
+		switch conn.State {
+		case StateKillRetry:
+			// Failed kills are retried on their own backoff schedule, not re-evaluated
+			if seen[inode] && !now.Before(conn.NextKillAttempt) {
+				schedule(conn, conn.PendingReason)
+			} else {
+				traceDecision(conn, now, "kill retry not due yet")
+			}
+			continue
+		case StateKillAbandoned:
+			traceDecision(conn, now, "kill abandoned, left alone")
+			continue
+		}
+
+		// Thresholds of the scope the connection falls in
+		policy := policyFor(conn, activeLimitMin)
+		maxActiveDuration := minutes(policy.MaxActive)
+
+		// Kill connections from peers on a block -feed
+		if reason, ok := feedBlockReason(conn); ok && conn.Alive() {
+			schedule(conn, reason)
+			continue
+		}
+
+		// B-E. Kill connections past the age, persist, zero-window or bandwidth limits
+		if reason, ok := thresholdReason(conn, now, policy, due); ok {
+			schedule(conn, reason)
+			continue
+		}
+
+		// The -canary policy kills within its share of peers and is only logged for the rest
+		if reason, ok := canaryDecision(conn, now, policy, due); ok {
+			schedule(conn, reason)
+			continue
+		}
+
+		// F. Kill connections a policy plugin asked for
+		if reason, ok := pluginVerdicts[inode]; ok && conn.Alive() {
+			schedule(conn, reason)
+			continue
+		}
+
+		// G. Warn about connections approaching the active limit
+		if due["max-active"] && warnBeforeMin > 0 && conn.State == StateActive &&
+			isKillCandidate(conn, now, maxActiveDuration-minutes(warnBeforeMin)) {
+			conn.setState(StateWarned, now)
+			traceDecision(conn, now, "warn: nearing max-active")
+			reportConn(rowWarned, conn, fmt.Sprintf("nearing max-active of %s", humanMinutes(policy.MaxActive)),
+				" ~ Connection nearing max-active (%s, Inode %s): %s\n", humanMinutes(policy.MaxActive), conn.Inode, conn.ConnectionID)
+			emitEvent(connEvent(EventWarned, conn, fmt.Sprintf("will exceed max-active of %s within %s", humanMinutes(policy.MaxActive), humanMinutes(warnBeforeMin))))
+			continue
+		}
+
+		if len(due) < len(intervalPolicies) {
+			traceDecision(conn, now, "within limits of the policies due this cycle")
+			continue
+		}
+		traceDecision(conn, now, "within limits")
+	}
+
+	// H. Reap the idlest connections when the guardian sees exhaustion approaching
+	if reapCount > 0 {
+		for _, conn := range guardianVictims(toKill, reapCount, now) {
+			schedule(conn, KillReason{ReasonExhaustion, "reaped by guardian under resource exhaustion"})
+		}
 	}
 
-	fmt.Printf("Total tracked connections: %d\n", len(connections))
+	// I. Kill a random share of the connections in a chaos round
+	for _, conn := range chaosVictims(toKill, now) {
+		schedule(conn, KillReason{ReasonChaos, fmt.Sprintf("picked by a %g%% chaos round", chaosPercent)})
+	}
+
+	locked = false
+	mu.Unlock()
+
+	// Killing clients of a dead service only hides the real problem
+	if len(toKill) > 0 && !killsAllowed() {
+		alertf(" ! Service on port %s is down, suppressing %d kill(s)\n", sourcePort, len(toKill))
+		toKill, killReasons = nil, nil
+	}
+
+	// Give slow-but-alive clients a chance to prove themselves
+	toKill, killReasons = filterProbed(toKill, killReasons)
+
+	// Make sure every candidate is still the socket we decided to kill
+	toKill, killReasons = verifyCandidates(toKill, killReasons)
+
+	// 4. Kill outside the lock, then drop the killed entries
+	markers := killMarkersFor(toKill)
+	for i, conn := range toKill {
+		if markers != nil {
+			plainf(" x Killing connection (%s, Inode %s): %s [marker %s]\n", killReasons[i], conn.Inode, conn.ConnectionID, markers[i])
+			continue
+		}
+		plainf(" x Killing connection (%s, Inode %s): %s\n", killReasons[i], conn.Inode, conn.ConnectionID)
+	}
+	killErrs := killConnections(toKill)
+	killedAt := clock.Now() // a listing must start after this to confirm the kills
+	for i, conn := range toKill {
+		if killErrs[i] == nil {
+			escalate(conn, now)
+			reputationKill(conn, now)
+			countLeak(conn, now)
+			if killReasons[i].Code == ReasonFeed {
+				banFeedPeer(conn, now)
+			}
+			if markers != nil {
+				injectMarker(conn, markers[i], killReasons[i])
+			}
+		}
+	}
+	for i, conn := range toKill {
+		if err := killErrs[i]; err != nil {
+			ev := connEvent(EventKillFailed, conn, err.Error())
+			ev.Reason = killReasons[i].Code
+			ev.ErrorClass = errorClass(err)
+			if markers != nil {
+				ev.Marker = markers[i]
+			}
+			emitEvent(ev)
+			tableRow(rowKillFailed, conn, err.Error())
+			stats.countError(err)
+		} else {
+			ev := reasonEvent(EventKill, conn, killReasons[i])
+			ev.BytesSent, ev.BytesReceived = conn.BytesSent, conn.BytesReceived
+			if markers != nil {
+				ev.Marker = markers[i]
+			}
+			emitEvent(ev)
+			tableRow(rowKilled, conn, fmt.Sprintf("%s (sent %s, received %s)", killReasons[i], humanBytes(conn.BytesSent), humanBytes(conn.BytesReceived)))
+			stats.Killed++
+			stats.countReason(killReasons[i].Code)
+			lifetimes.Observe(now.Sub(conn.TimeAdded))
+			reputationLifetime(conn, now.Sub(conn.TimeAdded), now)
+			digestKill(conn, killReasons[i].Code, now)
+		}
+	}
+
+	// Killed entries wait for confirmation; failed ones stay tracked and are queued for retry
+	var abandoned []int
+	mu.Lock()
+	locked = true
+	for i, conn := range toKill {
+		if killErrs[i] != nil {
+			if recordKillFailure(conn, killReasons[i], now) {
+				abandoned = append(abandoned, i)
+			}
+			continue
+		}
+		conn.setState(StateKillPending, killedAt)
+		conn.PendingReason = killReasons[i]
+	}
+	printCycleSummary(len(connections), countPinned(), stats.ScanPeers)
+	locked = false
+	mu.Unlock()
+
+	for _, i := range abandoned {
+		reportAbandoned(toKill[i], killErrs[i])
+	}
+
+	return stats
 }
 
+// updateTimer copies the timer columns of the latest listing and tracks how long
+// the persist timer has been running continuously
+func (c *ConnectionInfo) updateTimer(listed *ConnectionInfo, now time.Time) {
+	c.Timer = listed.Timer
+	c.TimerExpire = listed.TimerExpire
+	c.TimerRetrans = listed.TimerRetrans
 
-func listCurrentConnections() ([]*ConnectionInfo, error) {
-	cmd := exec.Command("ss", "-tnpeH", "src", ":"+sourcePort)
-	stdout, err := cmd.StdoutPipe()
+	switch {
+	case c.Timer != "persist":
+		c.PersistSince = time.Time{}
+	case c.PersistSince.IsZero():
+		c.PersistSince = now
+	}
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("StdoutPipe error: %w", err)
+// updateWindow records the peer's advertised window and how long it has stayed at zero
+func (c *ConnectionInfo) updateWindow(listed *ConnectionInfo, now time.Time) {
+	c.SndWnd = listed.SndWnd
+
+	switch {
+	case c.SndWnd != 0:
+		c.ZeroWindowSince = time.Time{}
+	case c.ZeroWindowSince.IsZero():
+		c.ZeroWindowSince = now
+	}
+}
+
+// key identifies the connection in the tracked map; inodes are only unique per host
+func (c *ConnectionInfo) key() string {
+	if c.Host == "" {
+		return c.Inode
+	}
+	return c.Host + "/" + c.Inode
+}
+
+// connectionID formats the "local -> peer" label of a connection
+func (c *ConnectionInfo) connectionID() string {
+	id := c.LocalAddr + " -> " + c.PeerAddr
+	if c.PeerPID > 0 {
+		id += fmt.Sprintf(" (%s/%d)", c.PeerProcess, c.PeerPID)
+	}
+	if origin := c.origin(); origin != "" {
+		return origin + ": " + id
+	}
+	return id
+}
+
+// origin names where a connection was listed: its -remote host or network
+// namespace, empty for this machine's own namespace
+func (c *ConnectionInfo) origin() string {
+	if c.Netns != "" {
+		return netnsOrigin(c.Netns)
+	}
+	return c.Host
+}
+
+// thresholdReason applies the thresholds of policy that are due this cycle to
+// conn and returns the reason to kill it, if any
+func thresholdReason(conn *ConnectionInfo, now time.Time, policy Policy, due map[string]bool) (KillReason, bool) {
+	// B. Kill active connections older than the active limit
+	if due["max-active"] && isKillCandidate(conn, now, minutes(policy.MaxActive)) {
+		return KillReason{ReasonMaxActive, fmt.Sprintf("active for more than %s", humanMinutes(policy.MaxActive))}, true
 	}
 
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("cmd Start error: %w", err)
+	// C. Kill connections stuck in the persist (zero-window probe) timer
+	if due["max-persist"] && policy.MaxPersist > 0 && conn.Alive() && !conn.PersistSince.IsZero() &&
+		now.Sub(conn.PersistSince) > minutes(policy.MaxPersist) {
+		return KillReason{ReasonPersistTimer, fmt.Sprintf("persist timer for more than %s", humanMinutes(policy.MaxPersist))}, true
+	}
+
+	// D. Kill connections whose peer has advertised a zero window for too long
+	if due["max-zero-window"] && policy.MaxZeroWindow > 0 && conn.Alive() && !conn.ZeroWindowSince.IsZero() &&
+		now.Sub(conn.ZeroWindowSince) > minutes(policy.MaxZeroWindow) {
+		return KillReason{ReasonZeroWindow, fmt.Sprintf("zero receive window for more than %s", humanMinutes(policy.MaxZeroWindow))}, true
+	}
+
+	// E. Kill connections over their transfer quota or throughput limit
+	if reason, ok := bandwidthReason(conn, now, policy); ok && due["bandwidth"] && conn.Alive() {
+		return reason, true
+	}
+	return KillReason{}, false
+}
+
+// observeOnly reports whether kills are ruled out whatever -dry-run is set
+// to later: remote hosts are only observed, and -analyze only measures
+func observeOnly() bool {
+	return remoteMode() || analyzeMin > 0
+}
+
+// isKillCandidate reports whether a connection is alive and older than maxActive
+func isKillCandidate(conn *ConnectionInfo, now time.Time, maxActive time.Duration) bool {
+	return conn.Alive() && now.Sub(conn.TimeAdded) > maxActive
+}
+
+// listConnectionsFrom parses the ss listing of host, or of this machine when
+// host is empty. netns names a network namespace of this machine to list
+// instead of our own (see -all-netns).
+func listConnectionsFrom(ctx context.Context, host, netns string) ([]*ConnectionInfo, error) {
+	format, err := ssFormatFor(host)
+	if err != nil {
+		return nil, &ListError{err}
+	}
+	// Cancelling ctx stops ss when its output is abandoned halfway
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	argv := nsCommand(netns, listCommand(host, format))
+	stdout, wait, err := runner.Stream(ctx, argv[0], argv[1:]...)
+	if err != nil {
+		return nil, &ListError{fmt.Errorf("cmd Start error: %w", err)}
 	}
 
+	// The line buffer starts small and grows up to -max-line-size. bufio
+	// takes the larger of the two as the limit, so the start can't exceed it.
 	scanner := bufio.NewScanner(stdout)
-	var currentConnections []*ConnectionInfo
+	scanner.Buffer(make([]byte, 0, min(64, maxLineKB)*1024), maxLineKB*1024)
+	currentConnections := make([]*ConnectionInfo, 0, listingSizeHint.Load())
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.Fields(line)
+	// Records are parsed as they arrive rather than after the dump, so only
+	// the one being read is held as text: the parsed entries keep copies of
+	// the fields they need. While parsing lags (or -parse-chunk pauses), ss
+	// blocks on the full pipe instead of piling up output.
+	var throttle parseThrottle
+	parse := func(line string) {
+		throttle.tick()
 
-		matches := inodeRegex.FindStringSubmatch(line)
-		if len(matches) < 2 {
-			log.Printf("Warning: Could not extract inode from line: %s", line)
-			continue
+		// ConnectionID is only built once the entry turns out to be a new connection
+		connInfo := acquireConn()
+		connInfo.Host, connInfo.Netns = host, netns
+		if err := parseSSRecord(line, format, connInfo); err != nil {
+			releaseConns([]*ConnectionInfo{connInfo})
+			parseErrors.Add(1)
+			if errors.Is(err, errNoInode) {
+				log.Printf("Warning: Could not extract inode from line: %s", line)
+			} else {
+				verbosef("   - Skipped line: %v\n", err)
+				debugf("       ss: %s\n", line)
+			}
+			return
+		}
+		if debugOutput {
+			connInfo.Raw = line
 		}
-		inode := matches[1] // Use index 1 for the captured group
 
-		if len(fields) >= 5 {
-			// Extracting local and peer addresses from fields
-            // Assuming fields[3] is local address and fields[4] is peer address based on typical ss output
-			localAddr := fields[3] 
-			peerAddr := fields[4] 
-			connID := fmt.Sprintf("%s -> %s", localAddr, peerAddr)
+		if verboseEnabled() {
+			verbosef("   + Parsed Inode %s: %s %s -> %s (timer %q, snd_wnd %d, owner %s/%d)\n",
+				connInfo.Inode, connInfo.TCPState, connInfo.LocalAddr, connInfo.PeerAddr, connInfo.Timer, connInfo.SndWnd, connInfo.Process, connInfo.PID)
+		}
+		currentConnections = append(currentConnections, connInfo)
+	}
 
-			currentConnections = append(currentConnections, &ConnectionInfo{
-				Inode:        inode,
-				ConnectionID: connID,
-				IsActive:     true,
-			})
+	// With -i, ss prints tcp_info on an indented continuation line; join it to
+	// its socket line in buf so each record is parsed in one piece
+	var buf []byte
+	skipHeader := !format.NoHeader
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if skipHeader {
+			skipHeader = false
+			continue
 		}
+		if len(buf) > 0 && len(line) > 0 && isSpace(line[0]) {
+			buf = append(buf, ' ')
+			buf = append(buf, bytes.TrimSpace(line)...)
+			continue
+		}
+		if len(buf) > 0 {
+			parse(string(buf))
+		}
+		buf = append(buf[:0], line...)
+	}
+	if len(buf) > 0 {
+		parse(string(buf))
+	}
+	if err := scanner.Err(); err != nil {
+		// A partial listing would make every connection after the bad line look closed
+		cancel()
+		wait()
+		releaseConns(currentConnections)
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, &ConfigError{fmt.Errorf("ss printed a line longer than -max-line-size (%d KB), raise it: %w", maxLineKB, err)}
+		}
+		return nil, &ListError{fmt.Errorf("reading ss output: %w", err)}
 	}
 
-	cmd.Wait()
+	// A failing ss (bad filter, missing privileges, lost ssh link) may have
+	// printed nothing at all, which must not read as "no connections"
+	if err := wait(); err != nil {
+		releaseConns(currentConnections)
+		return nil, &ListError{fmt.Errorf("ss listing failed: %w", err)}
+	}
+	listingSizeHint.Store(int64(len(currentConnections)))
 
+	if protocol == "unix" {
+		if err := attributeUnixPeers(ctx, host, netns, format, currentConnections); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
 	return currentConnections, nil
 }
 
+// killConnections kills every given connection and returns one error slot per input.
+// With the ss backend, connections are grouped by peer and destroyed with combined
+// filters of up to killBatchSize entries; a failed batch is retried one by one.
+// Every error is a KillError.
+func killConnections(conns []*ConnectionInfo) (errs []error) {
+	errs = make([]error, len(conns))
+	defer func() {
+		for i, err := range errs {
+			if err != nil {
+				errs[i] = &KillError{err}
+			}
+		}
+	}()
 
-func killConnection(inode string) error {
-	connInfo, exists := connections[inode]
-	if !exists {
-		return fmt.Errorf("connection info not found for inode %s", inode)
+	// Only connections on the ss backend in our own namespace can share a filter
+	var order []int
+	for i, conn := range conns {
+		// Last line of defense; schedule() already skips protected connections
+		if why, ok := protected.protects(conn); ok {
+			errs[i] = fmt.Errorf("refusing to kill never-touch connection (%s)", why)
+			continue
+		}
+		if backendFor(conn) == "ss" && killBatchSize > 1 && conn.Netns == "" && killCmd == "" {
+			order = append(order, i)
+		} else {
+			errs[i] = killConnection(conn)
+		}
+	}
+	if len(order) == 1 {
+		errs[order[0]] = killConnection(conns[order[0]])
+		return errs
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return conns[order[a]].PeerAddr < conns[order[b]].PeerAddr
+	})
+
+	for start := 0; start < len(order); start += killBatchSize {
+		end := min(start+killBatchSize, len(order))
+		batch := order[start:end]
+
+		if err := killBatchBySS(conns, batch); err != nil {
+			log.Printf("Batch kill of %d connections failed, retrying individually: %v", len(batch), err)
+			for _, i := range batch {
+				errs[i] = killConnection(conns[i])
+			}
+		}
+	}
+	return errs
+}
+
+// killBatchBySS destroys the selected connections with one 'ss --kill' call
+// using a filter of the form ( ( dst P1 and src L1 ) or ( dst P2 and src L2 ) ... ),
+// followed by the -vrf and -fwmark conditions
+func killBatchBySS(conns []*ConnectionInfo, batch []int) error {
+	args := []string{protocolFlag(), "--kill", "("}
+	for n, i := range batch {
+		conn := conns[i]
+		if conn.LocalAddr == "" || conn.PeerAddr == "" {
+			return fmt.Errorf("invalid connection ID format: %s", conn.ConnectionID)
+		}
+		if n > 0 {
+			args = append(args, "or")
+		}
+		args = append(args, "(", "dst", conn.PeerAddr, "and", "src", conn.LocalAddr, ")")
+	}
+	args = append(append(args, ")"), routingFilter()...)
+
+	start := time.Now()
+	output, err := runner.Run(cycleContext(), ssPath, args...)
+	observeKill("ss", len(batch), time.Since(start), err)
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	plainf(" -> Kill command executed for %d connections in one batch\n", len(batch))
+	return nil
+}
+
+// killConnection kills one connection with its current backend, timing the attempt
+func killConnection(connInfo *ConnectionInfo) error {
+	backend := backendFor(connInfo)
+	start := time.Now()
+	var err error
+	if backend == "fd" {
+		err = killByOwnerFD(connInfo)
+	} else {
+		err = killBySS(connInfo)
 	}
-	
-	parts := strings.Split(connInfo.ConnectionID, " -> ")
-	if len(parts) != 2 {
+	observeKill(backend, 1, time.Since(start), err)
+	return err
+}
+
+// killBySS destroys the socket through 'ss --kill' using its address pair
+func killBySS(connInfo *ConnectionInfo) error {
+	inode := connInfo.Inode
+
+	localAddr := connInfo.LocalAddr
+	peerAddr := connInfo.PeerAddr
+	if localAddr == "" || peerAddr == "" {
 		log.Printf("Invalid ID format for killing: %s\n", connInfo.ConnectionID)
 		return fmt.Errorf("invalid connection ID format")
 	}
 
-	localAddr := parts[0]
-	peerAddr := parts[1]
-
-	// We use 'ss --kill' with src/dst filters
-	cmd := exec.Command("ss", "--kill", "dst", peerAddr, "src", localAddr)
-	
-	output, err := cmd.CombinedOutput()
+	// We use 'ss --kill' with src/dst filters, unless -kill-cmd replaces it
+	argv := append([]string{ssPath, protocolFlag(), "--kill", "dst", peerAddr, "src", localAddr}, routingFilter()...)
+	if killCmd != "" {
+		argv = expandProbeArgs(killCmd, connInfo)
+	}
+	argv = nsCommand(connInfo.Netns, argv)
+	output, err := runner.Run(cycleContext(), argv[0], argv[1:]...)
 	if err != nil {
 		log.Printf("Error executing kill for %s (Inode %s): %v\nOutput: %s", connInfo.ConnectionID, inode, err, string(output))
 		return err
 	}
 
-	fmt.Printf(" -> Kill command executed for %s (Inode %s)\n", connInfo.ConnectionID, inode)
+	plainf(" -> Kill command executed for %s (Inode %s)\n", connInfo.ConnectionID, inode)
+	return nil
+}
+
+// killByOwnerFD shuts the socket down through a duplicate of the owning process's descriptor
+func killByOwnerFD(connInfo *ConnectionInfo) error {
+	if connInfo.PID <= 0 || connInfo.FD < 0 {
+		log.Printf("No owner process info for %s (Inode %s), cannot kill by fd", connInfo.ConnectionID, connInfo.Inode)
+		return fmt.Errorf("owner pid/fd unknown for inode %s", connInfo.Inode)
+	}
+
+	if err := shutdownOwnerSocket(connInfo.PID, connInfo.FD, connInfo.Inode); err != nil {
+		log.Printf("Error closing fd %d of %s (pid %d) for %s (Inode %s): %v", connInfo.FD, connInfo.Process, connInfo.PID, connInfo.ConnectionID, connInfo.Inode, err)
+		return err
+	}
+
+	plainf(" -> Socket shut down via fd %d of %s (pid %d) for %s (Inode %s)\n", connInfo.FD, connInfo.Process, connInfo.PID, connInfo.ConnectionID, connInfo.Inode)
 	return nil
 }
@@ -0,0 +1,594 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setFor assigns v to *p until the test ends
+func setFor[T any](t testing.TB, p *T, v T) {
+	t.Helper()
+	old := *p
+	*p = v
+	t.Cleanup(func() { *p = old })
+}
+
+// useManualClock makes the monitor run on a ManualClock until the test ends
+func useManualClock(t testing.TB) *ManualClock {
+	t.Helper()
+	manual := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	setFor[Clock](t, &clock, manual)
+	return manual
+}
+
+// useEmptyTracker starts the test with no tracked connections
+func useEmptyTracker(t testing.TB) {
+	t.Helper()
+	mu.Lock()
+	old := connections
+	connections = make(map[string]*ConnectionInfo)
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		connections = old
+		mu.Unlock()
+	})
+}
+
+// useSSFormat sets the layout of the local ss, skipping the probe
+func useSSFormat(t testing.TB, f *ssFormat) {
+	t.Helper()
+	ssFormatsMu.Lock()
+	old, had := ssFormats[""]
+	ssFormats[""] = f
+	ssFormatsMu.Unlock()
+	t.Cleanup(func() {
+		ssFormatsMu.Lock()
+		defer ssFormatsMu.Unlock()
+		if had {
+			ssFormats[""] = old
+		} else {
+			delete(ssFormats, "")
+		}
+	})
+}
+
+// testFormat is the layout of 'ss -tnpeoiH' on current iproute2
+var testFormat = &ssFormat{Version: "iproute2-test", NoHeader: true, StateCol: 0, LocalCol: 3, PeerCol: 4}
+
+// ssRecord is the 'ss -tnpeoiH' record of an established socket
+func ssRecord(inode int, local, peer string) string {
+	return fmt.Sprintf("ESTAB 0 0 %s %s users:((\"svc\",pid=4242,fd=%d)) timer:(keepalive,52sec,0) uid:1000 ino:%d sk:1 cgroup:/ <->\n"+
+		"\t ts sack cubic wscale:7,7 rto:204 rtt:0.52/0.11 mss:1448 cwnd:10 bytes_sent:4096 bytes_acked:4096 bytes_received:2048 segs_out:4 segs_in:3 lastsnd:1000 lastrcv:1000 lastack:1000 snd_wnd:65536",
+		local, peer, inode%1000, inode)
+}
+
+// fakeSS stands in for ss: listings come from its socket table, and
+// 'ss --kill' removes the sockets it names, unless refuse is set
+type fakeSS struct {
+	mu      sync.Mutex
+	sockets map[string]string // "local peer" -> record
+	refuse  bool
+	kills   int
+}
+
+// useFakeSS routes every command through a fakeSS until the test ends
+func useFakeSS(t *testing.T) *fakeSS {
+	t.Helper()
+	f := &fakeSS{sockets: make(map[string]string)}
+	setFor[CommandRunner](t, &runner, f)
+	useSSFormat(t, testFormat)
+	return f
+}
+
+func (f *fakeSS) add(inode int, local, peer string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sockets[local+" "+peer] = ssRecord(inode, local, peer)
+}
+
+func (f *fakeSS) addRecord(local, peer, record string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sockets[local+" "+peer] = record
+}
+
+func (f *fakeSS) remove(local, peer string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.sockets, local+" "+peer)
+}
+
+func (f *fakeSS) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if slices.Contains(args, "-V") {
+		return []byte("ss utility, iproute2-test\n"), nil
+	}
+	if !slices.Contains(args, "--kill") {
+		return nil, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.kills++
+	if f.refuse {
+		return []byte("SOCK_DESTROY answers: Operation not permitted\n"), errors.New("exit status 1")
+	}
+	// Filters read "dst <peer> src <local>", once per socket in a batch
+	var peer string
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "dst":
+			peer = args[i+1]
+		case "src":
+			delete(f.sockets, args[i+1]+" "+peer)
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeSS) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return nil, nil
+}
+
+func (f *fakeSS) Exchange(ctx context.Context, input []byte, name string, args ...string) ([]byte, error) {
+	return nil, nil
+}
+
+func (f *fakeSS) Stream(ctx context.Context, name string, args ...string) (io.Reader, func() error, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, 0, len(f.sockets))
+	for key := range f.sockets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b bytes.Buffer
+	for _, key := range keys {
+		b.WriteString(f.sockets[key])
+		b.WriteByte('\n')
+	}
+	return &b, func() error { return nil }, nil
+}
+
+// useTestPolicy sets the thresholds the monitor tests reason about
+func useTestPolicy(t testing.TB) {
+	t.Helper()
+	setFor(t, &checkIntervalMin, 30)
+	setFor(t, &maxActiveDurMin, 120)
+	setFor(t, &maxInactiveDurMin, 60)
+	setFor(t, &warnBeforeMin, 10)
+	setFor(t, &dryRun, false)
+	setFor(t, &quietOutput, true)
+	setFor(t, &killMethod, "ss")
+	setFor(t, &listOwners, true)
+}
+
+func TestThresholdReason(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ago := func(m int) time.Time { return now.Add(-minutes(m)) }
+	policy := Policy{MaxActive: 120, MaxPersist: 5, MaxZeroWindow: 10}
+	allDue := map[string]bool{"max-active": true, "max-persist": true, "max-zero-window": true, "bandwidth": true}
+
+	tests := []struct {
+		name string
+		conn ConnectionInfo
+		due  map[string]bool
+		want string // reason code, "" for none
+	}{
+		{"young", ConnectionInfo{State: StateActive, TimeAdded: ago(60)}, allDue, ""},
+		{"at max-active", ConnectionInfo{State: StateActive, TimeAdded: ago(120)}, allDue, ""},
+		{"past max-active", ConnectionInfo{State: StateActive, TimeAdded: ago(121)}, allDue, ReasonMaxActive},
+		{"warned past max-active", ConnectionInfo{State: StateWarned, TimeAdded: ago(121)}, allDue, ReasonMaxActive},
+		{"max-active not due", ConnectionInfo{State: StateActive, TimeAdded: ago(121)}, map[string]bool{"max-persist": true}, ""},
+		{"already being killed", ConnectionInfo{State: StateKillPending, TimeAdded: ago(121)}, allDue, ""},
+		{"missing", ConnectionInfo{State: StateMissing, TimeAdded: ago(121)}, allDue, ""},
+		{"persist timer", ConnectionInfo{State: StateActive, TimeAdded: ago(30), PersistSince: ago(6)}, allDue, ReasonPersistTimer},
+		{"short persist timer", ConnectionInfo{State: StateActive, TimeAdded: ago(30), PersistSince: ago(4)}, allDue, ""},
+		{"zero window", ConnectionInfo{State: StateActive, TimeAdded: ago(30), ZeroWindowSince: ago(11)}, allDue, ReasonZeroWindow},
+		{"max-active first", ConnectionInfo{State: StateActive, TimeAdded: ago(121), PersistSince: ago(6)}, allDue, ReasonMaxActive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, ok := thresholdReason(&tt.conn, now, policy, tt.due)
+			if got := reason.Code; ok != (tt.want != "") || got != tt.want {
+				t.Errorf("thresholdReason() = %q, %v; want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestMonitorStateTransitions(t *testing.T) {
+	const local, peer = "10.0.0.1:50090", "192.0.2.7:40000"
+	tests := []struct {
+		name       string
+		refuse     bool
+		closeAfter int // cycle after which the peer closes the socket; 0 never
+		cycles     int
+		want       []ConnState
+	}{
+		{"killed past max-active", false, 0, 7,
+			[]ConnState{StateNew, StateActive, StateWarned, StateKillPending, StateKilled}},
+		{"kill refused", true, 0, 6,
+			[]ConnState{StateNew, StateActive, StateWarned, StateKillRetry}},
+		{"closed by the peer", false, 2, 6,
+			[]ConnState{StateNew, StateActive, StateMissing, StateExpired}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestPolicy(t)
+			manual := useManualClock(t)
+			useEmptyTracker(t)
+			fake := useFakeSS(t)
+			fake.refuse = tt.refuse
+			fake.add(1001, local, peer)
+
+			var conn *ConnectionInfo
+			for cycle := 1; cycle <= tt.cycles; cycle++ {
+				monitorConnections()
+				if conn == nil {
+					mu.Lock()
+					conn = connections["1001"]
+					mu.Unlock()
+					if conn == nil {
+						t.Fatalf("socket not tracked after the first cycle")
+					}
+				}
+				if cycle == tt.closeAfter {
+					fake.remove(local, peer)
+				}
+				manual.Advance(minutes(checkIntervalMin))
+			}
+
+			var got []ConnState
+			for _, change := range conn.Transitions {
+				got = append(got, change.State)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("transitions = %v, want %v", got, tt.want)
+			}
+			if wantKills := tt.closeAfter == 0; (fake.kills > 0) != wantKills {
+				t.Errorf("%d kill commands run, want kills: %v", fake.kills, wantKills)
+			}
+		})
+	}
+}
+
+func TestListingThroughRunner(t *testing.T) {
+	useTestPolicy(t)
+	fake := useFakeSS(t)
+	fake.add(1001, "10.0.0.1:50090", "192.0.2.7:40000")
+	fake.add(1002, "[::ffff:10.0.0.1]:50090", "[2001:db8::7]:40001")
+
+	conns, err := listConnectionsFrom(context.Background(), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseConns(conns)
+	if len(conns) != 2 {
+		t.Fatalf("listed %d connections, want 2", len(conns))
+	}
+	for _, c := range conns {
+		if c.TCPState != "ESTAB" || c.Process != "svc" || c.PID != 4242 || c.UID != 1000 ||
+			c.Timer != "keepalive" || c.BytesSent != 4096 || c.BytesReceived != 2048 || c.SndWnd != 65536 {
+			t.Errorf("record not fully parsed: %+v", *c)
+		}
+		if !strings.HasSuffix(c.LocalAddr, ":50090") {
+			t.Errorf("local address %q", c.LocalAddr)
+		}
+	}
+}
+
+func TestListingLineLimit(t *testing.T) {
+	const local, peer = "10.0.0.1:50090", "192.0.2.7:40000"
+	// paddedRecord is a one-line record of exactly n bytes, its cgroup path
+	// padded out; snd_wnd comes last, so a truncated read would lose it
+	paddedRecord := func(n int) string {
+		head := "ESTAB 0 0 " + local + " " + peer + ` users:(("svc",pid=4242,fd=3)) uid:1000 ino:1001 sk:1 cgroup:/`
+		tail := " <-> snd_wnd:65536"
+		return head + strings.Repeat("x", n-len(head)-len(tail)) + tail
+	}
+
+	for _, kb := range []int{1, 64, 128} {
+		limit := kb * 1024
+		tests := []struct {
+			name   string
+			length int
+			fits   bool
+		}{
+			{"just under", limit - 1, true},
+			{"just over", limit + 1, false},
+		}
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%dKB %s", kb, tt.name), func(t *testing.T) {
+				useTestPolicy(t)
+				setFor(t, &maxLineKB, kb)
+				fake := useFakeSS(t)
+				fake.addRecord(local, peer, paddedRecord(tt.length))
+				fake.add(1002, "10.0.0.1:50090", "192.0.2.8:40000")
+
+				conns, err := listConnectionsFrom(context.Background(), "", "")
+				defer releaseConns(conns)
+				if !tt.fits {
+					if !errors.Is(err, bufio.ErrTooLong) || errorClass(err) != "config" {
+						t.Fatalf("err = %v (%s), want a config error wrapping bufio.ErrTooLong", err, errorClass(err))
+					}
+					if conns != nil {
+						t.Fatalf("got %d connections from a failed listing, want none", len(conns))
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(conns) != 2 {
+					t.Fatalf("listed %d connections, want 2", len(conns))
+				}
+				for _, c := range conns {
+					if c.Inode == "1001" && (c.PeerAddr != peer || c.SndWnd != 65536) {
+						t.Errorf("long record truncated: peer %q, snd_wnd %d", c.PeerAddr, c.SndWnd)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestPolicyDiff(t *testing.T) {
+	useTestPolicy(t)
+	manual := useManualClock(t)
+	useEmptyTracker(t)
+	setFor(t, &maxTransferMB, 0)
+	track := func(inode string, age time.Duration, sent int64, pinned bool) {
+		connections[inode] = &ConnectionInfo{
+			Inode: inode, ConnectionID: "10.0.0.1:50090 -> 192.0.2.7:" + inode,
+			LocalAddr: "10.0.0.1:50090", PeerAddr: "192.0.2.7:" + inode,
+			State: StateActive, TimeAdded: manual.Now().Add(-age), UID: 1000, PID: 4242, Process: "svc",
+			BytesSent: sent, Pinned: pinned,
+		}
+	}
+	track("1001", 150*time.Minute, 0, false) // past max-active already
+	track("1002", 90*time.Minute, 0, false)  // past the proposed max-active
+	track("1003", 30*time.Minute, 8<<20, false)
+	track("1004", 90*time.Minute, 0, true)
+	track("1005", 30*time.Minute, 0, false)
+
+	tests := []struct {
+		name   string
+		doc    string
+		status int
+		want   map[string]string // inode -> reason code
+	}{
+		{"unchanged", "max-active=2h\n", http.StatusOK, map[string]string{}},
+		{"whole document", "# tighter\nmax-active=1h\nmax-transfer=5\n", http.StatusOK,
+			map[string]string{"1002": ReasonMaxActive, "1003": ReasonTransferQuota}},
+		{"left-out flags keep their values", "max-transfer=5\n", http.StatusOK,
+			map[string]string{"1003": ReasonTransferQuota}},
+		{"unknown flag", "port=1\n", http.StatusBadRequest, nil},
+		{"bad value", "max-active=soon\n", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handlePolicyDiff(rec, httptest.NewRequest(http.MethodPost, "/policy/diff", strings.NewReader(tt.doc)))
+			if rec.Code != tt.status {
+				t.Fatalf("status %d (%s), want %d", rec.Code, rec.Body, tt.status)
+			}
+			if maxActiveDurMin != 120 || maxTransferMB != 0 {
+				t.Fatalf("live flags not restored: max-active %d, max-transfer %d", maxActiveDurMin, maxTransferMB)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var diff struct {
+				Candidates []policyDiffEntry `json:"new_kill_candidates"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &diff); err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for _, c := range diff.Candidates {
+				code, _, _ := strings.Cut(c.Reason, ":")
+				got[c.Inode] = code
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("new kill candidates = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGuardianVictims(t *testing.T) {
+	useTestPolicy(t)
+	manual := useManualClock(t)
+	useEmptyTracker(t)
+	setFor(t, &killRootOwned, false)
+	now := manual.Now()
+	track := func(inode string, age, idle time.Duration, uid int, pinned bool) *ConnectionInfo {
+		conn := &ConnectionInfo{
+			Inode: inode, State: StateActive, UID: uid, PID: 4242, Process: "svc", Pinned: pinned,
+			TimeAdded: now.Add(-age), LastTraffic: now.Add(-idle),
+		}
+		connections[inode] = conn
+		return conn
+	}
+	track("busy-old", 5*time.Hour, 0, 1000, false)
+	track("idle", time.Hour, 50*time.Minute, 1000, false)
+	track("idle-older", 2*time.Hour, 50*time.Minute, 1000, false)
+	track("idlest-root", 3*time.Hour, 3*time.Hour, 0, false)
+	track("idlest-pinned", 3*time.Hour, 3*time.Hour, 1000, true)
+	scheduled := track("idlest-scheduled", 3*time.Hour, 3*time.Hour, 1000, false)
+	track("busy-new", 10*time.Minute, 0, 1000, false)
+
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{1, []string{"idle-older"}},
+		{2, []string{"idle-older", "idle"}},
+		{4, []string{"idle-older", "idle", "busy-old", "busy-new"}},
+		{10, []string{"idle-older", "idle", "busy-old", "busy-new"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.n), func(t *testing.T) {
+			var got []string
+			for _, conn := range guardianVictims([]*ConnectionInfo{scheduled}, tt.n, now) {
+				got = append(got, conn.Inode)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("victims = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPins(t *testing.T) {
+	useEmptyTracker(t)
+	conns := map[string]*ConnectionInfo{
+		"1001": {Inode: "1001", PeerAddr: "192.0.2.7:40000"},
+		"1002": {Inode: "1002", PeerAddr: "[::ffff:192.0.2.7]:40001"},
+		"1003": {Inode: "1003", PeerAddr: "[2001:db8::1]:443"},
+		"1004": {Inode: "1004", PeerAddr: "[fe80::1%eth0]:22"},
+		"1005": {Inode: "1005", PeerAddr: "10.0.0.5:8080", ClientIP: "::ffff:198.51.100.9"},
+		"1006": {Inode: "1006", PeerAddr: "10.0.0.6:8080", Pinned: true, PinReason: "stale"},
+	}
+	maps.Copy(connections, conns)
+
+	applyPins(map[string]string{
+		"192.0.2.7":                "office",
+		"[::ffff:203.0.113.1]:9":   "unused",
+		"2001:db8::1":              "v6 peer",
+		"[fe80::1]:22":             "jump host",
+		"198.51.100.9":             "behind proxy",
+		"1001":                     "by inode",
+		"[::ffff:192.0.2.7]:40001": "by mapped peer",
+	})
+	want := map[string]string{
+		"1001": "by inode",
+		"1002": "by mapped peer",
+		"1003": "v6 peer",
+		"1004": "jump host",
+		"1005": "behind proxy",
+		"1006": "",
+	}
+	for inode, reason := range want {
+		if conn := conns[inode]; conn.Pinned != (reason != "") || conn.PinReason != reason {
+			t.Errorf("%s (%s): pinned %v [%s], want [%s]", inode, conn.PeerAddr, conn.Pinned, conn.PinReason, reason)
+		}
+	}
+
+	applyPins(map[string]string{"192.0.2.7": "office"})
+	for _, inode := range []string{"1001", "1002"} {
+		if conn := conns[inode]; !conn.Pinned || conn.PinReason != "office" {
+			t.Errorf("%s (%s): pinned %v [%s], want by the IPv4 pin", inode, conn.PeerAddr, conn.Pinned, conn.PinReason)
+		}
+	}
+}
+
+func TestCanaryForgetsDepartedConnections(t *testing.T) {
+	useTestPolicy(t)
+	manual := useManualClock(t)
+	useEmptyTracker(t)
+	setFor(t, &canary, canary)
+	setFor(t, &canarySettings, "max-active=30")
+	setFor(t, &canaryPercent, 100)
+	setFor(t, &canaryMinutes, 1440)
+	if err := setupCanary(); err != nil {
+		t.Fatal(err)
+	}
+	now := manual.Now()
+	policy, due := Policy{MaxActive: maxActiveDurMin}, map[string]bool{"max-active": true}
+	old := &ConnectionInfo{Inode: "1001", PeerAddr: "192.0.2.7:40000", State: StateActive, TimeAdded: now.Add(-time.Hour)}
+	young := &ConnectionInfo{Inode: "1002", PeerAddr: "192.0.2.8:40000", State: StateActive, TimeAdded: now.Add(-time.Minute)}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := canaryDecision(old, now, policy, due); !ok {
+		t.Fatalf("canary policy spared a connection past its max-active")
+	}
+	if _, ok := canaryDecision(young, now, policy, due); ok {
+		t.Fatalf("canary policy killed a connection within its max-active")
+	}
+	forgetCanary(old)
+	forgetCanary(old)
+	if len(canary.inGroup) != 1 || len(canary.flagged) != 0 {
+		t.Errorf("%d evaluated and %d flagged connections kept, want only the tracked one", len(canary.inGroup), len(canary.flagged))
+	}
+	if want := (canaryTally{group: 1, kills: 1}); canary.gone != want {
+		t.Errorf("tally of departed connections = %+v, want %+v", canary.gone, want)
+	}
+}
+
+// useBenchListing serves a stable synthetic listing of n connections until
+// the test ends
+func useBenchListing(b testing.TB, n int) {
+	useTestPolicy(b)
+	setFor(b, &dryRun, true)
+	setFor[CommandRunner](b, &runner, &benchRunner{listing: benchListing(n, 0, 0)})
+	useSSFormat(b, testFormat)
+}
+
+// BenchmarkListing parses a listing of 10000 connections per op. Entries come
+// from the pool, so past the first op each socket costs two allocations: its
+// record text and the copy of the strings kept from it.
+func BenchmarkListing(b *testing.B) {
+	const lines = 10000
+	useBenchListing(b, lines)
+	b.ReportAllocs()
+	for b.Loop() {
+		conns, err := listConnectionsFrom(context.Background(), "", "")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(conns) != lines {
+			b.Fatalf("listed %d connections, want %d", len(conns), lines)
+		}
+		releaseConns(conns)
+	}
+}
+
+// BenchmarkSteadyCycle runs a full monitoring cycle over 10000 connections
+// that are all tracked already, the daemon's steady state
+func BenchmarkSteadyCycle(b *testing.B) {
+	const lines = 10000
+	useBenchListing(b, lines)
+	manual := useManualClock(b)
+	useEmptyTracker(b)
+	monitorConnections()
+	b.ReportAllocs()
+	for b.Loop() {
+		manual.Advance(time.Minute)
+		if stats := monitorConnections(); stats.Tracked != lines {
+			b.Fatalf("tracking %d connections, want %d", stats.Tracked, lines)
+		}
+	}
+}
+
+func TestSteadyCycleAllocations(t *testing.T) {
+	const lines = 1000
+	useBenchListing(t, lines)
+	manual := useManualClock(t)
+	useEmptyTracker(t)
+	monitorConnections()
+	allocs := testing.AllocsPerRun(5, func() {
+		manual.Advance(time.Minute)
+		monitorConnections()
+	})
+	// The listed record and the strings detach keeps; tracked entries,
+	// the seen set and listed entries are all reused
+	if perConn := allocs / lines; perConn > 2.2 {
+		t.Errorf("%.2f allocations per tracked connection and cycle, want at most 2.2", perConn)
+	}
+}
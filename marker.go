@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	killMarkers   bool
+	markerJournal bool
+	markerCmd     string
+)
+
+func init() {
+	flag.BoolVar(&killMarkers, "kill-marker", false, "Give every kill a correlation marker (a UUID) carried by its event and log line")
+	flag.BoolVar(&markerJournal, "marker-journald", false, "Log each kill marker to the journal on behalf of the socket's owner, so it shows in 'journalctl -u <its unit>' (implies -kill-marker)")
+	flag.StringVar(&markerCmd, "marker-cmd", "", "Command run after each kill to put its marker in the service's own logs; {marker}, {process} and the -probe-cmd placeholders are filled in (implies -kill-marker)")
+}
+
+// journalSocket is where journald takes native protocol datagrams
+const journalSocket = "/run/systemd/journal/socket"
+
+// markerTimeout bounds one -marker-cmd
+const markerTimeout = 10 * time.Second
+
+// markersEnabled reports whether kills get a correlation marker
+func markersEnabled() bool {
+	return killMarkers || markerJournal || markerCmd != ""
+}
+
+// newMarker returns a random (version 4) UUID
+func newMarker() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// killMarkersFor returns a marker for each connection about to be killed, or
+// nil when markers are off
+func killMarkersFor(conns []*ConnectionInfo) []string {
+	if !markersEnabled() {
+		return nil
+	}
+	markers := make([]string, len(conns))
+	for i := range conns {
+		markers[i] = newMarker()
+	}
+	return markers
+}
+
+// injectMarker puts the marker of a successful kill in the owning service's
+// logs. Called without mu held.
+func injectMarker(conn *ConnectionInfo, marker string, reason KillReason) {
+	msg := fmt.Sprintf("DeadSocketDropper killed connection %s (%s), marker %s", conn.ConnectionID, reason, marker)
+	if markerJournal {
+		if err := journalMarker(conn, marker, msg); err != nil {
+			log.Printf("Error logging marker %s to the journal: %v", marker, err)
+		}
+	}
+	if markerCmd != "" {
+		args := expandProbeArgs(markerCmd, conn)
+		replacer := strings.NewReplacer("{marker}", marker, "{process}", conn.Process)
+		for i, arg := range args {
+			args[i] = replacer.Replace(arg)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), markerTimeout)
+		defer cancel()
+		if out, err := runner.Run(ctx, args[0], args[1:]...); err != nil {
+			log.Printf("Error running -marker-cmd for marker %s: %v: %s", marker, err, strings.TrimSpace(string(out)))
+		}
+	}
+}
+
+// journalMarker sends msg to journald with the native protocol. OBJECT_PID
+// names the socket's owner, and journald, trusting root, adds that process's
+// unit as OBJECT_SYSTEMD_UNIT, which 'journalctl -u' matches.
+func journalMarker(conn *ConnectionInfo, marker, msg string) error {
+	fields := []string{
+		"MESSAGE=" + msg,
+		"SYSLOG_IDENTIFIER=deadsocketdropper",
+		"PRIORITY=5",
+		"DSD_MARKER=" + marker,
+		"DSD_CONNECTION=" + conn.ConnectionID,
+		"DSD_INODE=" + conn.Inode,
+	}
+	if conn.PID > 0 && !remoteMode() && conn.Netns == "" {
+		fields = append(fields, "OBJECT_PID="+strconv.Itoa(conn.PID))
+	}
+
+	sock, err := net.Dial("unixgram", journalSocket)
+	if err != nil {
+		return err
+	}
+	defer sock.Close()
+	_, err = sock.Write([]byte(strings.Join(fields, "\n") + "\n"))
+	return err
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// MetricsWriter receives the statistics of every completed monitoring cycle
+type MetricsWriter interface {
+	WriteCycle(CycleStats) error
+}
+
+var metricsWriters []MetricsWriter
+
+// setupMetricsWriters registers the metrics outputs enabled by command-line flags
+func setupMetricsWriters() error {
+	if influxURL != "" || influxFile != "" {
+		w, err := newInfluxWriter()
+		if err != nil {
+			return err
+		}
+		metricsWriters = append(metricsWriters, w)
+	}
+	if textfileDir != "" {
+		if info, err := os.Stat(textfileDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("-textfile-dir %s is not a directory", textfileDir)
+		}
+		metricsWriters = append(metricsWriters, &TextfileWriter{})
+	}
+	return nil
+}
+
+// writeCycleMetrics hands the cycle statistics to every metrics writer
+func writeCycleMetrics(stats CycleStats) {
+	for _, w := range metricsWriters {
+		writeMetrics(w, stats)
+	}
+}
+
+// writeMetrics runs one writer, so a panicking writer cannot stop the others
+func writeMetrics(w MetricsWriter, stats CycleStats) {
+	defer recoverPanic(fmt.Sprintf("metrics writer %T", w))
+	if err := w.WriteCycle(stats); err != nil {
+		log.Printf("Error writing metrics: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	influxURL  string
+	influxFile string
+)
+
+func init() {
+	flag.StringVar(&influxURL, "influx-url", "", "InfluxDB/Telegraf line-protocol write URL, e.g. http://host:8086/api/v2/write?org=o&bucket=b (token from INFLUX_TOKEN)")
+	flag.StringVar(&influxFile, "influx-file", "", "File to append line-protocol measurements to each cycle")
+}
+
+// InfluxWriter emits one line-protocol measurement per cycle to an HTTP endpoint and/or a file
+type InfluxWriter struct {
+	token  string
+	host   string
+	client *http.Client
+}
+
+func newInfluxWriter() (*InfluxWriter, error) {
+	hostname, _ := os.Hostname()
+	return &InfluxWriter{
+		token:  os.Getenv("INFLUX_TOKEN"),
+		host:   hostname,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// WriteCycle formats and delivers the measurement for one cycle
+func (w *InfluxWriter) WriteCycle(stats CycleStats) error {
+	fields := fmt.Sprintf("tracked=%di,new=%di,killed=%di,expired=%di,errors=%di,cycle_ms=%.3f",
+		stats.Tracked, stats.New, stats.Killed, stats.Expired, stats.Errors,
+		float64(stats.Duration.Microseconds())/1000)
+	fields += fmt.Sprintf(",rss_bytes=%di,cpu_s=%.3f,degraded=%t", stats.RSSBytes, stats.CPUTime.Seconds(), degraded)
+	if p, n := lifetimes.Percentiles(50, 95, 99); n > 0 {
+		fields += fmt.Sprintf(",lifetime_p50_s=%.0f,lifetime_p95_s=%.0f,lifetime_p99_s=%.0f", p[0].Seconds(), p[1].Seconds(), p[2].Seconds())
+	}
+	if q := stats.Quality; len(q.RTTs) > 0 {
+		fields += fmt.Sprintf(",rtt_p50_ms=%.3f,rtt_p99_ms=%.3f,retrans_ratio_max=%.4f",
+			float64(q.rttPercentile(50).Microseconds())/1000, float64(q.rttPercentile(99).Microseconds())/1000,
+			q.RetransRatios[len(q.RetransRatios)-1])
+	}
+	line := fmt.Sprintf("deadsocketdropper,host=%s,port=%s %s %d\n",
+		escapeInfluxTag(w.host), escapeInfluxTag(sourcePort), fields, stats.Start.UnixNano())
+	for code, n := range stats.Reasons {
+		line += fmt.Sprintf("deadsocketdropper_actions,host=%s,port=%s,reason=%s count=%di %d\n",
+			escapeInfluxTag(w.host), escapeInfluxTag(sourcePort), escapeInfluxTag(code), n, stats.Start.UnixNano())
+	}
+	for class, n := range stats.ErrorClasses {
+		line += fmt.Sprintf("deadsocketdropper_errors,host=%s,port=%s,class=%s count=%di %d\n",
+			escapeInfluxTag(w.host), escapeInfluxTag(sourcePort), class, n, stats.Start.UnixNano())
+	}
+	for _, s := range snapshotKillStats() {
+		line += fmt.Sprintf("deadsocketdropper_kill_backend,host=%s,port=%s,backend=%s attempts=%di,errors=%di,confirmed=%di,unconfirmed=%di,success_rate=%.4f,duration_s=%.6f %d\n",
+			escapeInfluxTag(w.host), escapeInfluxTag(sourcePort), escapeInfluxTag(s.Backend),
+			s.Attempts, s.Errors, s.Confirmed, s.Unconfirmed, s.SuccessRate, s.DurationSeconds, stats.Start.UnixNano())
+	}
+	for _, f := range snapshotFeeds() {
+		line += fmt.Sprintf("deadsocketdropper_feed,host=%s,port=%s,feed=%s,action=%s entries=%di,age_s=%.0f,ok=%t %d\n",
+			escapeInfluxTag(w.host), escapeInfluxTag(sourcePort), escapeInfluxTag(f.Name), f.Action,
+			f.Entries, max(0, stats.Start.Sub(f.Loaded).Seconds()), f.OK, stats.Start.UnixNano())
+	}
+
+	if influxFile != "" {
+		f, err := os.OpenFile(influxFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteString(line)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if influxURL != "" {
+		req, err := http.NewRequest(http.MethodPost, influxURL, bytes.NewBufferString(line))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if w.token != "" {
+			req.Header.Set("Authorization", "Token "+w.token)
+		}
+		resp, err := w.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("%s returned %s", influxURL, resp.Status)
+		}
+	}
+	return nil
+}
+
+// escapeInfluxTag escapes the characters that are special in line-protocol tag values
+func escapeInfluxTag(value string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(value)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var textfileDir string
+
+func init() {
+	flag.StringVar(&textfileDir, "textfile-dir", "", "Directory for node_exporter's textfile collector; deadsocketdropper.prom is rewritten atomically each cycle")
+}
+
+// TextfileWriter renders Prometheus metrics into a .prom file for node_exporter
+type TextfileWriter struct {
+	reasons map[string]int
+	cycles  int
+	new     int
+	killed  int
+	expired int
+	classes map[string]int // errors by class
+}
+
+// WriteCycle accumulates the cycle counters and atomically replaces the .prom file
+func (w *TextfileWriter) WriteCycle(stats CycleStats) error {
+	w.cycles++
+	w.new += stats.New
+	w.killed += stats.Killed
+	w.expired += stats.Expired
+	if w.reasons == nil {
+		w.reasons = make(map[string]int)
+		w.classes = make(map[string]int)
+	}
+	for class, n := range stats.ErrorClasses {
+		w.classes[class] += n
+	}
+	for code, n := range stats.Reasons {
+		w.reasons[code] += n
+	}
+
+	var b strings.Builder
+	writePromMetric(&b, "deadsocketdropper_tracked_connections", "gauge", "Connections currently tracked.", stats.Tracked)
+	writePromMetric(&b, "deadsocketdropper_cycle_duration_seconds", "gauge", "Duration of the last monitoring cycle.", stats.Duration.Seconds())
+	writePromMetric(&b, "deadsocketdropper_last_cycle_timestamp_seconds", "gauge", "Unix time the last monitoring cycle started.", stats.Start.Unix())
+	writePromMetric(&b, "deadsocketdropper_cycles_total", "counter", "Monitoring cycles run.", w.cycles)
+	writePromMetric(&b, "deadsocketdropper_new_connections_total", "counter", "Connections that started being tracked.", w.new)
+	writePromMetric(&b, "deadsocketdropper_killed_connections_total", "counter", "Connections killed.", w.killed)
+	writePromMetric(&b, "deadsocketdropper_expired_connections_total", "counter", "Connections removed after being inactive.", w.expired)
+	writeErrorCounters(&b, w.classes)
+	writePromMetric(&b, "deadsocketdropper_process_resident_memory_bytes", "gauge", "Resident memory of the daemon after the last cycle.", stats.RSSBytes)
+	writePromMetric(&b, "deadsocketdropper_degraded", "gauge", "1 while kills are suppressed because the kernel can't destroy sockets (-on-no-destroy dry-run).", boolToInt(degraded))
+	writePromMetric(&b, "deadsocketdropper_process_cpu_seconds_total", "counter", "CPU time used by the daemon.", stats.CPUTime.Seconds())
+	writeReasonCounters(&b, w.reasons)
+	writeLifetimeHistogram(&b)
+	writeKillBackendMetrics(&b)
+	writeFeedMetrics(&b, stats.Start)
+	writeSnapshotHistogram(&b, "deadsocketdropper_connection_rtt_seconds", "Smoothed RTT of the connections tracked in the last cycle.",
+		rttBuckets, durationsToSeconds(stats.Quality.RTTs))
+	writeSnapshotHistogram(&b, "deadsocketdropper_connection_retransmit_ratio", "Retransmitted segments per segment sent, for the connections tracked in the last cycle.",
+		retransBuckets, stats.Quality.RetransRatios)
+
+	// Write to a temp file in the same directory and rename, so the collector never reads a partial file
+	tmp, err := os.CreateTemp(textfileDir, ".deadsocketdropper.prom.*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(textfileDir, "deadsocketdropper.prom"))
+}
+
+// writePromMetric appends one metric with its HELP and TYPE lines, labelled with the monitored port
+func writePromMetric(b *strings.Builder, name, kind, help string, value any) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n%s{port=%q} %v\n", name, help, name, kind, name, sourcePort, value)
+}
+
+// writeErrorCounters appends the error counter with one series per class, so
+// alerts can tell a misconfiguration from a kernel refusing kills
+func writeErrorCounters(b *strings.Builder, classes map[string]int) {
+	const name = "deadsocketdropper_errors_total"
+	fmt.Fprintf(b, "# HELP %s Errors by class: config, env, list, parse (skipped listing lines), kill and internal.\n# TYPE %s counter\n", name, name)
+	for _, c := range errorClasses {
+		fmt.Fprintf(b, "%s{port=%q,class=%q} %d\n", name, sourcePort, c.name, classes[c.name])
+	}
+}
+
+// writeLifetimeHistogram appends the connection lifetime histogram
+func writeLifetimeHistogram(b *strings.Builder) {
+	const name = "deadsocketdropper_connection_lifetime_seconds"
+	cumulative, count, sum := lifetimes.Histogram()
+
+	fmt.Fprintf(b, "# HELP %s Lifetime of connections that stopped being tracked (expired or killed).\n# TYPE %s histogram\n", name, name)
+	for i, upper := range lifetimeBuckets {
+		fmt.Fprintf(b, "%s_bucket{port=%q,le=\"%g\"} %d\n", name, sourcePort, upper, cumulative[i])
+	}
+	fmt.Fprintf(b, "%s_bucket{port=%q,le=\"+Inf\"} %d\n", name, sourcePort, cumulative[len(cumulative)-1])
+	fmt.Fprintf(b, "%s_sum{port=%q} %g\n%s_count{port=%q} %d\n", name, sourcePort, sum, name, sourcePort, count)
+}
+
+// writeReasonCounters appends the kills and removals broken down by reason code
+func writeReasonCounters(b *strings.Builder, reasons map[string]int) {
+	const name = "deadsocketdropper_actions_total"
+	codes := make([]string, 0, len(reasons))
+	for code := range reasons {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	fmt.Fprintf(b, "# HELP %s Kills and removals by reason code.\n# TYPE %s counter\n", name, name)
+	for _, code := range codes {
+		fmt.Fprintf(b, "%s{port=%q,reason=%q} %d\n", name, sourcePort, code, reasons[code])
+	}
+}
+
+// writeSnapshotHistogram appends a histogram of values sampled in the last cycle
+func writeSnapshotHistogram(b *strings.Builder, name, help string, buckets, values []float64) {
+	var sum float64
+	cumulative := make([]int, len(buckets))
+	for _, v := range values {
+		sum += v
+		for i, upper := range buckets {
+			if v <= upper {
+				cumulative[i]++
+			}
+		}
+	}
+
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, upper := range buckets {
+		fmt.Fprintf(b, "%s_bucket{port=%q,le=\"%g\"} %d\n", name, sourcePort, upper, cumulative[i])
+	}
+	fmt.Fprintf(b, "%s_bucket{port=%q,le=\"+Inf\"} %d\n", name, sourcePort, len(values))
+	fmt.Fprintf(b, "%s_sum{port=%q} %g\n%s_count{port=%q} %d\n", name, sourcePort, sum, name, sourcePort, len(values))
+}
+
+func durationsToSeconds(ds []time.Duration) []float64 {
+	out := make([]float64, len(ds))
+	for i, d := range ds {
+		out[i] = d.Seconds()
+	}
+	return out
+}
+
+// writeKillBackendMetrics appends the kill outcomes and latency of each backend
+func writeKillBackendMetrics(b *strings.Builder) {
+	backends := snapshotKillStats()
+
+	const attempts = "deadsocketdropper_kill_attempts_total"
+	fmt.Fprintf(b, "# HELP %s Kill attempts by backend and outcome (error: the backend failed; unconfirmed: it succeeded but the socket stayed established).\n# TYPE %s counter\n", attempts, attempts)
+	for _, s := range backends {
+		pending := s.Attempts - s.Errors - min(s.Attempts-s.Errors, s.Confirmed+s.Unconfirmed)
+		for _, r := range []struct {
+			result string
+			n      uint64
+		}{{"confirmed", s.Confirmed}, {"unconfirmed", s.Unconfirmed}, {"error", s.Errors}, {"pending", pending}} {
+			fmt.Fprintf(b, "%s{port=%q,backend=%q,result=%q} %d\n", attempts, sourcePort, s.Backend, r.result, r.n)
+		}
+	}
+
+	const duration = "deadsocketdropper_kill_duration_seconds"
+	fmt.Fprintf(b, "# HELP %s Time taken by each kill command or syscall, by backend.\n# TYPE %s histogram\n", duration, duration)
+	for _, s := range backends {
+		cumulative := s.Histogram()
+		for i, upper := range killDurationBuckets {
+			fmt.Fprintf(b, "%s_bucket{port=%q,backend=%q,le=\"%g\"} %d\n", duration, sourcePort, s.Backend, upper, cumulative[i])
+		}
+		fmt.Fprintf(b, "%s_bucket{port=%q,backend=%q,le=\"+Inf\"} %d\n", duration, sourcePort, s.Backend, s.Calls)
+		fmt.Fprintf(b, "%s_sum{port=%q,backend=%q} %g\n%s_count{port=%q,backend=%q} %d\n", duration, sourcePort, s.Backend, s.DurationSeconds, duration, sourcePort, s.Backend, s.Calls)
+	}
+}
+
+// writeFeedMetrics appends the size and freshness of each -feed
+func writeFeedMetrics(b *strings.Builder, now time.Time) {
+	status := snapshotFeeds()
+	if len(status) == 0 {
+		return
+	}
+
+	const entries = "deadsocketdropper_feed_entries"
+	fmt.Fprintf(b, "# HELP %s Addresses and prefixes on each feed.\n# TYPE %s gauge\n", entries, entries)
+	for _, f := range status {
+		fmt.Fprintf(b, "%s{port=%q,feed=%q,action=%q} %d\n", entries, sourcePort, f.Name, f.Action, f.Entries)
+	}
+
+	const age = "deadsocketdropper_feed_age_seconds"
+	fmt.Fprintf(b, "# HELP %s Time since each feed was last loaded successfully.\n# TYPE %s gauge\n", age, age)
+	for _, f := range status {
+		fmt.Fprintf(b, "%s{port=%q,feed=%q,action=%q} %.0f\n", age, sourcePort, f.Name, f.Action, max(0, now.Sub(f.Loaded).Seconds()))
+	}
+
+	const up = "deadsocketdropper_feed_up"
+	fmt.Fprintf(b, "# HELP %s Whether the last refresh of each feed succeeded.\n# TYPE %s gauge\n", up, up)
+	for _, f := range status {
+		fmt.Fprintf(b, "%s{port=%q,feed=%q,action=%q} %d\n", up, sourcePort, f.Name, f.Action, boolToInt(f.OK))
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var allNetns bool
+
+func init() {
+	flag.BoolVar(&allNetns, "all-netns", false, "Also monitor every other network namespace: those in /var/run/netns and those of running containers")
+}
+
+// namedNetnsDir holds the namespaces created with 'ip netns add'
+const namedNetnsDir = "/var/run/netns"
+
+// netnsPaths maps each namespace found by the last sweep to a path nsenter
+// can join it through
+var (
+	netnsPaths   map[string]string
+	netnsPathsMu sync.Mutex
+)
+
+// nsInode identifies the network namespace behind path
+func nsInode(path string) (uint64, bool) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, false
+	}
+	return uint64(st.Ino), true
+}
+
+// findNamespaces returns the network namespaces other than our own, by name.
+// Named namespaces keep their name; any other namespace, such as a
+// container's, is named after its oldest process as "comm:pid".
+func findNamespaces() map[string]string {
+	found := make(map[string]string)
+	seen := make(map[uint64]bool)
+	if self, ok := nsInode("/proc/self/ns/net"); ok {
+		seen[self] = true
+	}
+
+	entries, _ := os.ReadDir(namedNetnsDir)
+	for _, e := range entries {
+		path := filepath.Join(namedNetnsDir, e.Name())
+		if ino, ok := nsInode(path); ok && !seen[ino] {
+			seen[ino] = true
+			found[e.Name()] = path
+		}
+	}
+
+	// The lowest pid in a namespace is usually its init
+	procs, _ := os.ReadDir("/proc")
+	var pids []int
+	for _, e := range procs {
+		if pid, err := strconv.Atoi(e.Name()); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	for _, pid := range pids {
+		path := "/proc/" + strconv.Itoa(pid) + "/ns/net"
+		ino, ok := nsInode(path)
+		if !ok || seen[ino] {
+			continue
+		}
+		seen[ino] = true
+		comm, _ := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/comm")
+		found[strings.TrimSpace(string(comm))+":"+strconv.Itoa(pid)] = path
+	}
+	return found
+}
+
+// netnsOrigin is the origin of the connections listed in netns
+func netnsOrigin(netns string) string {
+	return "netns " + netns
+}
+
+// nsCommand wraps argv to run inside network namespace netns, or returns it
+// unchanged for our own namespace
+func nsCommand(netns string, argv []string) []string {
+	if netns == "" {
+		return argv
+	}
+	netnsPathsMu.Lock()
+	path := netnsPaths[netns]
+	netnsPathsMu.Unlock()
+	return append([]string{nsenterPath, "--net=" + path, "--"}, argv...)
+}
+
+// listAllNamespaces lists our own namespace, then every other one. A
+// namespace that can't be listed, or disappears mid-sweep, is logged and
+// returned in unlisted.
+func listAllNamespaces(ctx context.Context) (all []*ConnectionInfo, unlisted map[string]bool, err error) {
+	all, err = listConnectionsFrom(ctx, "", "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found := findNamespaces()
+	netnsPathsMu.Lock()
+	netnsPaths = found
+	netnsPathsMu.Unlock()
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		conns, err := listConnectionsFrom(ctx, "", name)
+		if err != nil {
+			log.Printf("Error listing connections in network namespace %s: %v", name, err)
+			if unlisted == nil {
+				unlisted = make(map[string]bool)
+			}
+			unlisted[netnsOrigin(name)] = true
+			continue
+		}
+		all = append(all, conns...)
+	}
+	return all, unlisted, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	pagerDutyRoutingKey   string
+	opsgenieURL           string
+	incidentKillFailLimit int
+)
+
+func init() {
+	flag.StringVar(&pagerDutyRoutingKey, "pagerduty-routing-key", "", "PagerDuty Events API v2 routing key for monitor-health incidents")
+	flag.StringVar(&opsgenieURL, "opsgenie-url", "https://api.opsgenie.com/v2/alerts", "Opsgenie alert API URL (API key is read from OPSGENIE_API_KEY)")
+	flag.IntVar(&incidentKillFailLimit, "incident-kill-failures", 3, "Consecutive kill failures before an incident is raised")
+}
+
+// incident is a monitor-health problem forwarded to the on-call tooling
+type incident struct {
+	dedupKey string
+	summary  string
+	details  string
+}
+
+// IncidentNotifier raises PagerDuty/Opsgenie incidents when the dropper itself misbehaves:
+// the lister fails, or kills keep failing.
+type IncidentNotifier struct {
+	mu           sync.Mutex
+	killFailures int
+	opsgenieKey  string
+	hostname     string
+	queue        chan incident
+	client       *http.Client
+}
+
+func newIncidentNotifier() *IncidentNotifier {
+	hostname, _ := os.Hostname()
+	n := &IncidentNotifier{
+		opsgenieKey: os.Getenv("OPSGENIE_API_KEY"),
+		hostname:    hostname,
+		queue:       make(chan incident, 16),
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+	go n.run()
+	return n
+}
+
+// incidentsEnabled reports whether any incident backend is configured
+func incidentsEnabled() bool {
+	return pagerDutyRoutingKey != "" || os.Getenv("OPSGENIE_API_KEY") != ""
+}
+
+// Send inspects the event and queues an incident when a health threshold is crossed
+func (n *IncidentNotifier) Send(ev Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	switch ev.Type {
+	case EventMonitorError:
+		n.raise(incident{
+			dedupKey: "dsd-monitor-error-" + n.hostname,
+			summary:  fmt.Sprintf("DeadSocketDropper on %s: monitoring cycle failed", n.hostname),
+			details:  ev.Message,
+		})
+	case EventWatchdog:
+		n.raise(incident{
+			dedupKey: "dsd-watchdog-" + n.hostname,
+			summary:  fmt.Sprintf("DeadSocketDropper on %s: monitoring cycle hung", n.hostname),
+			details:  ev.Message,
+		})
+	case EventServiceDown:
+		n.raise(incident{
+			dedupKey: "dsd-service-down-" + n.hostname,
+			summary:  fmt.Sprintf("DeadSocketDropper on %s: monitored service on port %s is down, kills suppressed", n.hostname, sourcePort),
+			details:  ev.Message,
+		})
+	case EventKillAbandoned:
+		n.raise(incident{
+			dedupKey: "dsd-kill-abandoned-" + n.hostname,
+			summary:  fmt.Sprintf("DeadSocketDropper on %s: gave up killing %s", n.hostname, ev.ConnectionID),
+			details:  ev.Message,
+		})
+	case EventKillFailed:
+		n.killFailures++
+		if n.killFailures == incidentKillFailLimit {
+			n.raise(incident{
+				dedupKey: "dsd-kill-failures-" + n.hostname,
+				summary:  fmt.Sprintf("DeadSocketDropper on %s: %d consecutive kill failures", n.hostname, n.killFailures),
+				details:  fmt.Sprintf("last failure (Inode %s, %s): %s", ev.Inode, ev.ConnectionID, ev.Message),
+			})
+		}
+	case EventKill:
+		n.killFailures = 0
+	}
+}
+
+// raise queues an incident without blocking; incidents are dropped if the queue is full
+func (n *IncidentNotifier) raise(inc incident) {
+	select {
+	case n.queue <- inc:
+	default:
+		log.Printf("Warning: incident queue full, dropping: %s", inc.summary)
+	}
+}
+
+func (n *IncidentNotifier) run() {
+	for inc := range n.queue {
+		if pagerDutyRoutingKey != "" {
+			if err := n.sendPagerDuty(inc); err != nil {
+				log.Printf("Error sending PagerDuty incident: %v", err)
+			}
+		}
+		if n.opsgenieKey != "" {
+			if err := n.sendOpsgenie(inc); err != nil {
+				log.Printf("Error sending Opsgenie alert: %v", err)
+			}
+		}
+	}
+}
+
+func (n *IncidentNotifier) sendPagerDuty(inc incident) error {
+	body := map[string]any{
+		"routing_key":  pagerDutyRoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    inc.dedupKey,
+		"payload": map[string]any{
+			"summary":   inc.summary,
+			"source":    n.hostname,
+			"severity":  "critical",
+			"component": "DeadSocketDropper",
+			"custom_details": map[string]string{
+				"details": inc.details,
+			},
+		},
+	}
+	return n.post("https://events.pagerduty.com/v2/enqueue", body, nil)
+}
+
+func (n *IncidentNotifier) sendOpsgenie(inc incident) error {
+	body := map[string]any{
+		"message":     inc.summary,
+		"alias":       inc.dedupKey,
+		"description": inc.details,
+		"source":      n.hostname,
+		"priority":    "P2",
+	}
+	return n.post(opsgenieURL, body, map[string]string{"Authorization": "GenieKey " + n.opsgenieKey})
+}
+
+// post sends a JSON body and treats any non-2xx response as an error
+func (n *IncidentNotifier) post(url string, body any, headers map[string]string) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
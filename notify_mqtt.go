@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	mqttBroker   string
+	mqttTopic    string
+	mqttQoS      int
+	mqttUser     string
+	mqttClientID string
+	mqttCA       string
+	mqttCert     string
+	mqttKey      string
+)
+
+func init() {
+	flag.StringVar(&mqttBroker, "mqtt-broker", "", "MQTT broker URL for event publishing, e.g. tcp://host:1883 or tls://host:8883 (empty disables MQTT)")
+	flag.StringVar(&mqttTopic, "mqtt-topic", "deadsocketdropper/{type}", "MQTT topic template; {type} is replaced by the event type")
+	flag.IntVar(&mqttQoS, "mqtt-qos", 0, "MQTT QoS level for published events (0 or 1; at 1, events the broker has not acknowledged are resent after reconnecting)")
+	flag.StringVar(&mqttUser, "mqtt-user", "", "MQTT username (password is read from the MQTT_PASSWORD environment variable)")
+	flag.StringVar(&mqttClientID, "mqtt-client-id", "", "MQTT client ID (default: deadsocketdropper-<hostname>)")
+	flag.StringVar(&mqttCA, "mqtt-ca", "", "CA file to verify a tls:// MQTT broker with (default: system roots)")
+	flag.StringVar(&mqttCert, "mqtt-cert", "", "Client certificate file for a tls:// MQTT broker, with -mqtt-key")
+	flag.StringVar(&mqttKey, "mqtt-key", "", "Client key file for -mqtt-cert")
+}
+
+const mqttKeepAlive = 60 * time.Second
+
+// mqttMaxUnacked bounds the QoS 1 messages kept for resending while the
+// broker is unreachable; the oldest are dropped beyond it
+const mqttMaxUnacked = 1024
+
+// mqttMessage is a QoS 1 publish awaiting its PUBACK
+type mqttMessage struct {
+	topic    string
+	payload  []byte
+	packetID uint16
+	sent     bool // resent with the DUP flag
+}
+
+// MQTTPublisher publishes every event as JSON to a per-type topic.
+// It speaks just enough MQTT 3.1.1 to connect and publish at QoS 0 or 1.
+// At QoS 1 a message is kept until the broker acknowledges it, and resent
+// with DUP set after a reconnect.
+type MQTTPublisher struct {
+	queue     chan Event
+	addr      string
+	tlsConfig *tls.Config // nil for a plain tcp:// broker
+	clientID  string
+	password  string
+
+	conn     net.Conn
+	reader   *bufio.Reader
+	packetID uint16
+	unacked  []*mqttMessage
+}
+
+func newMQTTPublisher() (*MQTTPublisher, error) {
+	u, err := url.Parse(mqttBroker)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -mqtt-broker: %w", err)
+	}
+	if mqttQoS != 0 && mqttQoS != 1 {
+		return nil, fmt.Errorf("-mqtt-qos must be 0 or 1")
+	}
+
+	p := &MQTTPublisher{
+		queue:    make(chan Event, 256),
+		addr:     u.Host,
+		clientID: mqttClientID,
+		password: os.Getenv("MQTT_PASSWORD"),
+	}
+
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		if u.Port() == "" {
+			p.addr = net.JoinHostPort(u.Hostname(), "1883")
+		}
+	case "tls", "ssl", "mqtts":
+		if p.tlsConfig, err = mqttTLSConfig(u.Hostname()); err != nil {
+			return nil, err
+		}
+		if u.Port() == "" {
+			p.addr = net.JoinHostPort(u.Hostname(), "8883")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported -mqtt-broker scheme %q (use tcp:// or tls://)", u.Scheme)
+	}
+	if p.tlsConfig == nil && (mqttCA != "" || mqttCert != "" || mqttKey != "") {
+		return nil, fmt.Errorf("-mqtt-ca, -mqtt-cert and -mqtt-key need a tls:// -mqtt-broker")
+	}
+
+	if p.clientID == "" {
+		hostname, _ := os.Hostname()
+		p.clientID = "deadsocketdropper-" + hostname
+	}
+
+	go p.run()
+	return p, nil
+}
+
+// mqttTLSConfig builds the TLS settings for a broker named host from
+// -mqtt-ca, -mqtt-cert and -mqtt-key
+func mqttTLSConfig(host string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: host}
+	if mqttCA != "" {
+		pem, err := os.ReadFile(mqttCA)
+		if err != nil {
+			return nil, fmt.Errorf("-mqtt-ca: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("-mqtt-ca: no certificates in %s", mqttCA)
+		}
+	}
+	if (mqttCert == "") != (mqttKey == "") {
+		return nil, fmt.Errorf("-mqtt-cert and -mqtt-key must be given together")
+	}
+	if mqttCert != "" {
+		cert, err := tls.LoadX509KeyPair(mqttCert, mqttKey)
+		if err != nil {
+			return nil, fmt.Errorf("-mqtt-cert/-mqtt-key: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// Send queues the event for publishing, dropping it if the broker is falling behind
+func (p *MQTTPublisher) Send(ev Event) {
+	select {
+	case p.queue <- ev:
+	default:
+		log.Printf("Warning: MQTT queue full, dropping %s event", ev.Type)
+	}
+}
+
+func (p *MQTTPublisher) run() {
+	ping := time.NewTicker(mqttKeepAlive / 2)
+	defer ping.Stop()
+
+	for {
+		select {
+		case ev := <-p.queue:
+			payload, err := marshalEvent(ev)
+			if err != nil {
+				log.Printf("Error encoding MQTT event: %v", err)
+				continue
+			}
+			topic := strings.ReplaceAll(mqttTopic, "{type}", ev.Type)
+			if mqttQoS == 1 {
+				p.keep(topic, payload)
+				p.flush()
+				continue
+			}
+			if err := p.publish(&mqttMessage{topic: topic, payload: payload}); err != nil {
+				log.Printf("Error publishing to MQTT broker %s: %v", p.addr, err)
+				p.disconnect()
+			}
+		case <-ping.C:
+			if p.conn == nil {
+				// Reconnects to resend what the broker hasn't acknowledged
+				p.flush()
+				continue
+			}
+			if err := p.ping(); err != nil {
+				log.Printf("MQTT keepalive to %s failed: %v", p.addr, err)
+				p.disconnect()
+			}
+		}
+	}
+}
+
+// keep adds a QoS 1 message to those awaiting a PUBACK
+func (p *MQTTPublisher) keep(topic string, payload []byte) {
+	if len(p.unacked) == mqttMaxUnacked {
+		log.Printf("Warning: %d MQTT messages unacknowledged, dropping the oldest", mqttMaxUnacked)
+		p.unacked = append(p.unacked[:0], p.unacked[1:]...)
+	}
+	p.packetID++
+	if p.packetID == 0 {
+		p.packetID = 1
+	}
+	p.unacked = append(p.unacked, &mqttMessage{topic: topic, payload: payload, packetID: p.packetID})
+}
+
+// flush publishes the unacknowledged messages in order, stopping at the
+// first failure; the rest are tried again later
+func (p *MQTTPublisher) flush() {
+	for len(p.unacked) > 0 {
+		if err := p.publish(p.unacked[0]); err != nil {
+			log.Printf("Error publishing to MQTT broker %s, %d messages kept for resending: %v", p.addr, len(p.unacked), err)
+			p.disconnect()
+			return
+		}
+		p.unacked[0] = nil
+		p.unacked = p.unacked[1:]
+	}
+}
+
+// connect opens the transport and performs the CONNECT/CONNACK handshake
+func (p *MQTTPublisher) connect() error {
+	var conn net.Conn
+	var err error
+	if p.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", p.addr, p.tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", p.addr, 10*time.Second)
+	}
+	if err != nil {
+		return err
+	}
+
+	var vh []byte
+	vh = appendMQTTString(vh, "MQTT")
+	vh = append(vh, 4)  // protocol level 3.1.1
+	flags := byte(0x02) // clean session
+	if mqttQoS == 1 {
+		flags = 0 // keep the session, so the broker takes resent messages as such
+	}
+	if mqttUser != "" {
+		flags |= 0x80
+		if p.password != "" {
+			flags |= 0x40
+		}
+	}
+	vh = append(vh, flags)
+	vh = binary.BigEndian.AppendUint16(vh, uint16(mqttKeepAlive/time.Second))
+	vh = appendMQTTString(vh, p.clientID)
+	if mqttUser != "" {
+		vh = appendMQTTString(vh, mqttUser)
+		if p.password != "" {
+			vh = appendMQTTString(vh, p.password)
+		}
+	}
+
+	p.conn = conn
+	p.reader = bufio.NewReader(conn)
+	if err := p.writePacket(0x10, vh); err != nil {
+		p.disconnect()
+		return err
+	}
+
+	packetType, body, err := p.readPacket()
+	if err != nil {
+		p.disconnect()
+		return fmt.Errorf("reading CONNACK: %w", err)
+	}
+	if packetType != 0x20 || len(body) != 2 {
+		p.disconnect()
+		return fmt.Errorf("unexpected packet 0x%02x instead of CONNACK", packetType)
+	}
+	if body[1] != 0 {
+		p.disconnect()
+		return fmt.Errorf("broker refused connection (return code %d)", body[1])
+	}
+	return nil
+}
+
+// publish sends msg at -mqtt-qos and, at QoS 1, waits for its PUBACK
+func (p *MQTTPublisher) publish(msg *mqttMessage) error {
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+
+	header := 0x30 | byte(mqttQoS<<1)
+	var body []byte
+	body = appendMQTTString(body, msg.topic)
+	if mqttQoS == 1 {
+		body = binary.BigEndian.AppendUint16(body, msg.packetID)
+		if msg.sent {
+			header |= 0x08 // DUP
+		}
+		msg.sent = true
+	}
+	body = append(body, msg.payload...)
+
+	if err := p.writePacket(header, body); err != nil {
+		return err
+	}
+	if mqttQoS == 0 {
+		return nil
+	}
+
+	packetType, ack, err := p.readPacket()
+	if err != nil {
+		return fmt.Errorf("reading PUBACK: %w", err)
+	}
+	if packetType != 0x40 || len(ack) != 2 || binary.BigEndian.Uint16(ack) != msg.packetID {
+		return fmt.Errorf("unexpected packet 0x%02x instead of PUBACK", packetType)
+	}
+	return nil
+}
+
+func (p *MQTTPublisher) ping() error {
+	if err := p.writePacket(0xC0, nil); err != nil {
+		return err
+	}
+	packetType, _, err := p.readPacket()
+	if err != nil {
+		return err
+	}
+	if packetType != 0xD0 {
+		return fmt.Errorf("unexpected packet 0x%02x instead of PINGRESP", packetType)
+	}
+	return nil
+}
+
+func (p *MQTTPublisher) disconnect() {
+	if p.conn != nil {
+		p.writePacket(0xE0, nil)
+		p.conn.Close()
+		p.conn = nil
+		p.reader = nil
+	}
+}
+
+// writePacket sends a packet with the given fixed-header byte and body
+func (p *MQTTPublisher) writePacket(header byte, body []byte) error {
+	packet := []byte{header}
+	// Remaining length is a base-128 varint
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	packet = append(packet, body...)
+
+	p.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := p.conn.Write(packet)
+	return err
+}
+
+// readPacket reads one packet, returning its type (upper nibble) and body
+func (p *MQTTPublisher) readPacket() (byte, []byte, error) {
+	p.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	header, err := p.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, fmt.Errorf("malformed remaining length")
+		}
+		b, err := p.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(p.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header & 0xF0, body, nil
+}
+
+// appendMQTTString appends a length-prefixed UTF-8 string
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
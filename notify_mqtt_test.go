@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mqttPublish is a PUBLISH as a fake broker received it
+type mqttPublish struct {
+	dup      bool
+	topic    string
+	packetID uint16
+}
+
+// fakeBroker accepts MQTT connections on loopback and answers CONNECT. Each
+// connection reads one PUBLISH and reports it; only those after the first
+// drop connections are acknowledged.
+func fakeBroker(t *testing.T, drop int) (addr string, published <-chan mqttPublish) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	ch := make(chan mqttPublish, 16)
+	go func() {
+		for n := 0; ; n++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			if header, _, err := readTestPacket(r); err != nil || header&0xF0 != 0x10 {
+				conn.Close()
+				continue
+			}
+			conn.Write([]byte{0x20, 2, 0, 0}) // CONNACK, accepted
+			header, body, err := readTestPacket(r)
+			if err != nil || header&0xF0 != 0x30 {
+				conn.Close()
+				continue
+			}
+			topicLen := int(binary.BigEndian.Uint16(body))
+			msg := mqttPublish{
+				dup:      header&0x08 != 0,
+				topic:    string(body[2 : 2+topicLen]),
+				packetID: binary.BigEndian.Uint16(body[2+topicLen:]),
+			}
+			ch <- msg
+			if n >= drop {
+				conn.Write([]byte{0x40, 2, byte(msg.packetID >> 8), byte(msg.packetID)}) // PUBACK
+				readTestPacket(r)                                                        // until the client hangs up
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String(), ch
+}
+
+// readTestPacket reads one MQTT packet, returning its whole fixed-header byte
+func readTestPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
+
+func TestMQTTResendsUnacknowledged(t *testing.T) {
+	setFor(t, &mqttQoS, 1)
+	addr, published := fakeBroker(t, 1)
+	p := &MQTTPublisher{addr: addr, clientID: "test"}
+	defer p.disconnect()
+
+	p.keep("deadsocketdropper/kill", []byte(`{}`))
+	p.flush()
+	if first := <-published; first.dup || first.packetID != 1 {
+		t.Errorf("first publish %+v, want packet 1 without DUP", first)
+	}
+	if len(p.unacked) != 1 {
+		t.Fatalf("%d messages kept after a missing PUBACK, want 1", len(p.unacked))
+	}
+
+	p.flush()
+	if resent := <-published; !resent.dup || resent.packetID != 1 || resent.topic != "deadsocketdropper/kill" {
+		t.Errorf("resent publish %+v, want packet 1 with DUP", resent)
+	}
+	if len(p.unacked) != 0 {
+		t.Errorf("%d messages kept after the PUBACK, want none", len(p.unacked))
+	}
+}
+
+// writeTestCert writes a self-signed certificate and its key to dir
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "broker.example"},
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func TestMQTTTLSConfig(t *testing.T) {
+	cert, key := writeTestCert(t, t.TempDir())
+	tests := []struct {
+		name          string
+		ca, cert, key string
+		wantErr       bool
+	}{
+		{"system roots", "", "", "", false},
+		{"CA and client certificate", cert, cert, key, false},
+		{"missing CA file", "/nonexistent/ca.pem", "", "", true},
+		{"CA file without certificates", key, "", "", true},
+		{"certificate without key", "", cert, "", true},
+		{"key without certificate", "", "", key, true},
+		{"mismatched pair", "", key, cert, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFor(t, &mqttCA, tt.ca)
+			setFor(t, &mqttCert, tt.cert)
+			setFor(t, &mqttKey, tt.key)
+			config, err := mqttTLSConfig("broker.example")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if config.ServerName != "broker.example" || (config.RootCAs != nil) != (tt.ca != "") ||
+				len(config.Certificates) > 0 != (tt.cert != "") {
+				t.Errorf("config for %+v: server %q, custom roots %v, %d certificates",
+					tt, config.ServerName, config.RootCAs != nil, len(config.Certificates))
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	natsURL     string
+	natsSubject string
+)
+
+func init() {
+	flag.StringVar(&natsURL, "nats-url", "", "NATS server URL for event publishing, e.g. nats://user@host:4222 or tls://host:4222 (empty disables NATS)")
+	flag.StringVar(&natsSubject, "nats-subject", "deadsocketdropper.{type}", "NATS subject template; {type} is replaced by the event type")
+}
+
+// NATSPublisher publishes every event, in the versioned JSON schema, to a NATS subject
+type NATSPublisher struct {
+	queue    chan Event
+	addr     string
+	host     string
+	useTLS   bool
+	user     string
+	password string
+	token    string
+
+	mu   sync.Mutex // guards writes on conn (publisher and PONG replies)
+	conn net.Conn
+	w    *bufio.Writer
+}
+
+func newNATSPublisher() (*NATSPublisher, error) {
+	u, err := url.Parse(natsURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -nats-url: %w", err)
+	}
+
+	p := &NATSPublisher{
+		queue:    make(chan Event, 256),
+		addr:     u.Host,
+		host:     u.Hostname(),
+		password: os.Getenv("NATS_PASSWORD"),
+		token:    os.Getenv("NATS_TOKEN"),
+	}
+	if u.User != nil {
+		p.user = u.User.Username()
+	}
+
+	switch u.Scheme {
+	case "nats", "tcp":
+	case "tls":
+		p.useTLS = true
+	default:
+		return nil, fmt.Errorf("unsupported -nats-url scheme %q (use nats:// or tls://)", u.Scheme)
+	}
+	if u.Port() == "" {
+		p.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	go p.run()
+	return p, nil
+}
+
+// Send queues the event for publishing, dropping it if the server is falling behind
+func (p *NATSPublisher) Send(ev Event) {
+	select {
+	case p.queue <- ev:
+	default:
+		log.Printf("Warning: NATS queue full, dropping %s event", ev.Type)
+	}
+}
+
+func (p *NATSPublisher) run() {
+	for ev := range p.queue {
+		payload, err := marshalEvent(ev)
+		if err != nil {
+			log.Printf("Error encoding NATS event: %v", err)
+			continue
+		}
+		subject := strings.ReplaceAll(natsSubject, "{type}", ev.Type)
+		if err := p.publish(subject, payload); err != nil {
+			log.Printf("Error publishing to NATS server %s: %v", p.addr, err)
+			p.disconnect()
+		}
+	}
+}
+
+// connect reads the server INFO, upgrades to TLS if needed and sends CONNECT
+func (p *NATSPublisher) connect() error {
+	conn, err := net.DialTimeout("tcp", p.addr, 10*time.Second)
+	if err != nil {
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("did not receive INFO from server: %v", err)
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info)
+
+	if p.useTLS || info.TLSRequired {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: p.host})
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return fmt.Errorf("tls handshake: %w", err)
+		}
+		conn = tlsConn
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	hostname, _ := os.Hostname()
+	opts := map[string]any{
+		"verbose":      false,
+		"pedantic":     false,
+		"tls_required": p.useTLS || info.TLSRequired,
+		"name":         "deadsocketdropper-" + hostname,
+		"lang":         "go",
+	}
+	if p.user != "" {
+		opts["user"] = p.user
+		opts["pass"] = p.password
+	}
+	if p.token != "" {
+		opts["auth_token"] = p.token
+	}
+	connectJSON, _ := json.Marshal(opts)
+
+	p.conn = conn
+	p.w = bufio.NewWriter(conn)
+	if _, err := fmt.Fprintf(p.w, "CONNECT %s\r\n", connectJSON); err != nil {
+		return err
+	}
+	if err := p.w.Flush(); err != nil {
+		return err
+	}
+
+	go p.readLoop(conn)
+	return nil
+}
+
+// readLoop answers server PINGs and logs protocol errors until the connection drops
+func (p *NATSPublisher) readLoop(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			p.mu.Lock()
+			if p.conn == conn {
+				p.w.WriteString("PONG\r\n")
+				p.w.Flush()
+			}
+			p.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			log.Printf("NATS server error: %s", strings.TrimSpace(line))
+		}
+	}
+}
+
+func (p *NATSPublisher) publish(subject string, payload []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+
+	p.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	fmt.Fprintf(p.w, "PUB %s %d\r\n", subject, len(payload))
+	p.w.Write(payload)
+	p.w.WriteString("\r\n")
+	return p.w.Flush()
+}
+
+func (p *NATSPublisher) disconnect() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+		p.w = nil
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	smtpAddr          string
+	smtpFrom          string
+	smtpUser          string
+	smtpTLSMode       string
+	smtpKillTo        string
+	smtpFailureTo     string
+	smtpDigestMinutes int
+	smtpReportTo      string
+)
+
+func init() {
+	flag.StringVar(&smtpAddr, "smtp-addr", "", "SMTP server host:port for email alerts (empty disables email)")
+	flag.StringVar(&smtpFrom, "smtp-from", "", "Sender address for email alerts")
+	flag.StringVar(&smtpUser, "smtp-user", "", "SMTP username (password is read from the SMTP_PASSWORD environment variable)")
+	flag.StringVar(&smtpTLSMode, "smtp-tls", "starttls", "SMTP TLS mode: 'starttls', 'tls' (implicit, usually port 465) or 'none'")
+	flag.StringVar(&smtpKillTo, "smtp-kill-to", "", "Comma-separated recipients for kill events")
+	flag.StringVar(&smtpFailureTo, "smtp-failure-to", "", "Comma-separated recipients for monitor failures (kill errors, listing errors)")
+	minutesVar(&smtpDigestMinutes, "smtp-digest-interval", 15, "Minutes between email digests")
+	flag.StringVar(&smtpReportTo, "smtp-report-to", "", "Comma-separated recipients for the -digest reports")
+}
+
+// SMTPNotifier batches events and mails them as periodic digests,
+// routing kill events and monitor failures to separate recipients.
+type SMTPNotifier struct {
+	mu       sync.Mutex
+	kills    []Event
+	failures []Event
+	password string
+	hostname string
+}
+
+func newSMTPNotifier() (*SMTPNotifier, error) {
+	if smtpFrom == "" {
+		return nil, fmt.Errorf("-smtp-from is required when -smtp-addr is set")
+	}
+	if smtpKillTo == "" && smtpFailureTo == "" && smtpReportTo == "" {
+		return nil, fmt.Errorf("at least one of -smtp-kill-to, -smtp-failure-to or -smtp-report-to is required")
+	}
+	if smtpTLSMode != "starttls" && smtpTLSMode != "tls" && smtpTLSMode != "none" {
+		return nil, fmt.Errorf("invalid -smtp-tls %q", smtpTLSMode)
+	}
+	if smtpDigestMinutes < 1 {
+		return nil, fmt.Errorf("-smtp-digest-interval must be at least 1")
+	}
+
+	hostname, _ := os.Hostname()
+	n := &SMTPNotifier{
+		password: os.Getenv("SMTP_PASSWORD"),
+		hostname: hostname,
+	}
+	go n.run(minutes(smtpDigestMinutes))
+	return n, nil
+}
+
+// Send queues the event for the next digest
+func (n *SMTPNotifier) Send(ev Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	switch {
+	case ev.IsFailure():
+		if smtpFailureTo != "" {
+			n.failures = append(n.failures, ev)
+		}
+	case ev.Type == EventKill:
+		if smtpKillTo != "" {
+			n.kills = append(n.kills, ev)
+		}
+	case ev.Type == EventDigest && ev.Digest != nil:
+		// Reports go out right away rather than with the next batch
+		if smtpReportTo != "" {
+			go func() {
+				subject := fmt.Sprintf("[DeadSocketDropper] %s report for %s", ev.Digest.Period, n.hostname)
+				if err := n.send(smtpReportTo, subject, strings.ReplaceAll(ev.Digest.String(), "\n", "\r\n")); err != nil {
+					log.Printf("Error sending %s report: %v", ev.Digest.Period, err)
+				}
+			}()
+		}
+	}
+}
+
+func (n *SMTPNotifier) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n.mu.Lock()
+		kills, failures := n.kills, n.failures
+		n.kills, n.failures = nil, nil
+		n.mu.Unlock()
+
+		if len(failures) > 0 {
+			subject := fmt.Sprintf("[DeadSocketDropper] %d monitor failure(s) on %s", len(failures), n.hostname)
+			if err := n.mail(smtpFailureTo, subject, failures); err != nil {
+				log.Printf("Error sending failure digest: %v", err)
+			}
+		}
+		if len(kills) > 0 {
+			subject := fmt.Sprintf("[DeadSocketDropper] %d connection(s) killed on %s", len(kills), n.hostname)
+			if err := n.mail(smtpKillTo, subject, kills); err != nil {
+				log.Printf("Error sending kill digest: %v", err)
+			}
+		}
+	}
+}
+
+// mail delivers one digest message to the given comma-separated recipients
+func (n *SMTPNotifier) mail(recipients, subject string, events []Event) error {
+	var body strings.Builder
+	for _, ev := range events {
+		fmt.Fprintf(&body, "%s  %-13s", formatTime(ev.Time), ev.Type)
+		if ev.Inode != "" {
+			fmt.Fprintf(&body, "  Inode %s: %s", ev.Inode, ev.ConnectionID)
+		}
+		if ev.Reason != "" {
+			fmt.Fprintf(&body, "  [%s]", ev.Reason)
+		}
+		if ev.Message != "" {
+			fmt.Fprintf(&body, "  (%s)", ev.Message)
+		}
+		body.WriteString("\r\n")
+	}
+	return n.send(recipients, subject, body.String())
+}
+
+// send mails text to the given comma-separated recipients
+func (n *SMTPNotifier) send(recipients, subject, text string) error {
+	to := splitList(recipients)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", smtpFrom)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	body.WriteString(text)
+
+	client, err := n.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if smtpUser != "" {
+		host, _, _ := net.SplitHostPort(smtpAddr)
+		if err := client.Auth(smtp.PlainAuth("", smtpUser, n.password, host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if err := client.Mail(smtpFrom); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("rcpt %s: %w", rcpt, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(body.String())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// SMTP network limits: connecting, and the whole conversation of one message,
+// so a stalled server fails the send instead of hanging the digest
+const (
+	smtpDialTimeout = 10 * time.Second
+	smtpSendTimeout = time.Minute
+)
+
+// dial connects to the SMTP server using the configured TLS mode
+func (n *SMTPNotifier) dial() (*smtp.Client, error) {
+	host, _, err := net.SplitHostPort(smtpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -smtp-addr: %w", err)
+	}
+	tlsConfig := &tls.Config{ServerName: host}
+
+	dialer := &net.Dialer{Timeout: smtpDialTimeout}
+	var conn net.Conn
+	if smtpTLSMode == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", smtpAddr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", smtpAddr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(smtpSendTimeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if smtpTLSMode == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("starttls: %w", err)
+		}
+	}
+	return client, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var out []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+var (
+	quietOutput   bool
+	verboseOutput bool
+	debugOutput   bool
+)
+
+func init() {
+	flag.BoolVar(&quietOutput, "quiet", false, "Only print kills and errors")
+	flag.BoolVar(&verboseOutput, "verbose", false, "Also print per-line parse decisions and the policy evaluation of every connection")
+	flag.BoolVar(&debugOutput, "debug", false, "Like -verbose, plus the raw ss lines behind each decision")
+}
+
+// Output tiers: errors go through log.Printf, everything else through one of
+// these. None of them print with -output json, where events and cycle
+// summaries replace the prose.
+
+// alertf prints kills and kill failures, shown at every level
+func alertf(format string, args ...any) {
+	if !jsonOutput {
+		fmt.Printf(format, args...)
+	}
+}
+
+// infof prints routine progress, hidden by -quiet
+func infof(format string, args ...any) {
+	if !quietOutput && !jsonOutput {
+		fmt.Printf(format, args...)
+	}
+}
+
+// verbosef prints per-connection detail with -verbose or -debug
+func verbosef(format string, args ...any) {
+	if verboseEnabled() {
+		fmt.Printf(format, args...)
+	}
+}
+
+// verboseEnabled reports whether verbosef prints. Per-connection call sites
+// check it first, since boxing the arguments allocates even when nothing prints.
+func verboseEnabled() bool {
+	return (verboseOutput || debugOutput) && !jsonOutput
+}
+
+// debugf prints raw input with -debug
+func debugf(format string, args ...any) {
+	if debugOutput && !jsonOutput {
+		fmt.Printf(format, args...)
+	}
+}
+
+// traceDecision reports the policy outcome for one connection with -verbose,
+// and the ss line it was based on with -debug
+func traceDecision(conn *ConnectionInfo, now time.Time, decision string) {
+	if !verboseEnabled() {
+		return
+	}
+	verbosef("   . Inode %s [%s, age %s, %s/s out, %s/s in]: %s\n", conn.Inode, conn.State, humanDuration(now.Sub(conn.TimeAdded)),
+		humanBytes(int64(conn.SendRate)), humanBytes(int64(conn.RecvRate)), decision)
+	if conn.Raw != "" {
+		debugf("       ss: %s\n", conn.Raw)
+	}
+}
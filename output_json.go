@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var outputFormat string
+
+func init() {
+	flag.StringVar(&outputFormat, "output", "text", "Output format: 'text' or 'json' (one versioned JSON object per line)")
+}
+
+// jsonOutput is set at startup when every printed line is a JSON object
+var jsonOutput bool
+
+// outputSchemaVersion is bumped whenever a field of the JSON output changes meaning or is removed
+const outputSchemaVersion = 1
+
+// outputLine is one line of -output json. Type selects which of the optional
+// fields is set: start (Config), cycle (Cycle), event (Event), analysis
+// (Analysis), lifetimes and log (Message).
+type outputLine struct {
+	Schema   string            `json:"schema"`
+	Version  int               `json:"version"`
+	Type     string            `json:"type"`
+	Time     time.Time         `json:"time"`
+	Message  string            `json:"message,omitempty"`
+	Config   map[string]string `json:"config,omitempty"`
+	Cycle    *cycleOutput      `json:"cycle,omitempty"`
+	Event    *Event            `json:"event,omitempty"`
+	Analysis *analysisOutput   `json:"analysis,omitempty"`
+}
+
+type cycleOutput struct {
+	Start      time.Time      `json:"start"`
+	DurationMS int64          `json:"duration_ms"`
+	Tracked    int            `json:"tracked"`
+	New        int            `json:"new"`
+	Killed     int            `json:"killed"`
+	Expired    int            `json:"expired"`
+	Errors     int            `json:"errors"`
+	Reasons    map[string]int `json:"reasons,omitempty"`
+	RSSBytes   int64          `json:"rss_bytes"`
+	CPUSeconds float64        `json:"cpu_seconds"`
+	ScanPeers  int            `json:"scan_peers,omitempty"`
+}
+
+type analysisOutput struct {
+	Ended             int    `json:"ended"`
+	StillOpen         int    `json:"still_open"`
+	P50               string `json:"p50,omitempty"`
+	P995              string `json:"p99_5,omitempty"`
+	SuggestedActive   int    `json:"suggested_max_active,omitempty"`
+	SuggestedInactive int    `json:"suggested_max_inactive,omitempty"`
+	CurrentTooLow     bool   `json:"current_max_active_too_low,omitempty"`
+}
+
+var jsonMu sync.Mutex
+
+// printJSON writes one output line; concurrent writers never interleave
+func printJSON(line outputLine) {
+	line.Schema = "deadsocketdropper.output"
+	line.Version = outputSchemaVersion
+	if line.Time.IsZero() {
+		line.Time = clock.Now()
+	}
+	line.Time = line.Time.UTC()
+	data, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+	jsonMu.Lock()
+	defer jsonMu.Unlock()
+	os.Stdout.Write(append(data, '\n'))
+}
+
+// setupOutputFormat switches to JSON output: log lines are wrapped, events and
+// cycle summaries are printed by a sink and a metrics writer, prose is muted
+func setupOutputFormat() error {
+	switch outputFormat {
+	case "text":
+		return nil
+	case "json":
+	default:
+		return fmt.Errorf("invalid -output %q: must be 'text' or 'json'", outputFormat)
+	}
+
+	jsonOutput = true
+	log.SetFlags(0)
+	log.SetOutput(jsonLogWriter{})
+	sinks = append(sinks, jsonEventSink{})
+	metricsWriters = append(metricsWriters, jsonCycleWriter{})
+	return nil
+}
+
+// printJSONStart announces the effective configuration
+func printJSONStart() {
+	config := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		config[f.Name] = f.Value.String()
+	})
+	printJSON(outputLine{Type: "start", Config: config})
+}
+
+type jsonLogWriter struct{}
+
+func (jsonLogWriter) Write(p []byte) (int, error) {
+	printJSON(outputLine{Type: "log", Message: strings.TrimRight(string(p), "\n")})
+	return len(p), nil
+}
+
+type jsonEventSink struct{}
+
+func (jsonEventSink) Send(ev Event) {
+	printJSON(outputLine{Type: "event", Time: ev.Time, Event: &ev})
+}
+
+type jsonCycleWriter struct{}
+
+func (jsonCycleWriter) WriteCycle(s CycleStats) error {
+	printJSON(outputLine{Type: "cycle", Cycle: &cycleOutput{
+		Start:      s.Start.UTC(),
+		DurationMS: s.Duration.Milliseconds(),
+		Tracked:    s.Tracked,
+		New:        s.New,
+		Killed:     s.Killed,
+		Expired:    s.Expired,
+		Errors:     s.Errors,
+		Reasons:    s.Reasons,
+		RSSBytes:   s.RSSBytes,
+		CPUSeconds: s.CPUTime.Seconds(),
+		ScanPeers:  s.ScanPeers,
+	}})
+	return nil
+}
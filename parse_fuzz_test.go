@@ -0,0 +1,126 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Records as 'ss -tinpeoH' (iproute2-6.1.0) prints them, continuation joined
+var ssRecordSeeds = []string{
+	`ESTAB 0      0      127.0.0.1:48271 127.0.0.1:46032 users:(("svc",pid=129,fd=11)) uid:65534 ino:145036 sk:25d cgroup:/ <-> ts sack bbr wscale:10,10 rto:204 rtt:0.022/0.012 ato:40 mss:32768 pmtu:65535 rcvmss:7981 advmss:65483 cwnd:11 bytes_sent:395 bytes_acked:395 bytes_received:7981 segs_out:3 segs_in:5 data_segs_out:1 data_segs_in:1 bbr:(bw:6898515624bps,mrtt:0.02,pacing_gain:2.88672,cwnd_gain:2.88672) send 131072000000bps lastsnd:64128 lastrcv:64288 lastack:64128 pacing_rate 374584320000bps delivery_rate 6898526312bps delivered:2 app_limited rcv_space:65483 rcv_ssthresh:110319 minrtt:0.02 snd_wnd:65536`,
+	`ESTAB 0      0      127.0.0.1:46032 127.0.0.1:48271 users:(("client",pid=31192,fd=19)) timer:(keepalive,56sec,0) ino:145035 sk:25e cgroup:/ <-> ts sack bbr wscale:10,10 rto:204 rtt:0.024/0.013 ato:40 mss:55296 pmtu:65535 rcvmss:536 advmss:65483 cwnd:11 bytes_sent:7981 bytes_acked:7982 bytes_received:395 segs_out:5 segs_in:4 data_segs_out:1 data_segs_in:1 send 202752000000bps lastsnd:64288 lastrcv:64128 lastack:3304 delivered:2 app_limited rcv_space:65495 rcv_ssthresh:65495 minrtt:0.009 snd_wnd:110592`,
+	`ESTAB 0      0      [::ffff:10.0.0.1]:8080 [::ffff:192.0.2.7]:51234 users:(("nginx",pid=812,fd=14),("nginx",pid=813,fd=14)) timer:(persist,1.2sec,3) uid:33 ino:98127 sk:1f <-> ts sack cubic wscale:7,7 rto:216 rtt:15.2/4 mss:1448 cwnd:10 bytes_sent:1048576 bytes_received:512 snd_wnd:0`,
+	`FIN-WAIT-2 0 0 10.0.0.1:8080 192.0.2.9:40000 timer:(timewait,30sec,0) ino:0 sk:3 <->`,
+	`ESTAB 0 0 10.0.0.1:8080 192.0.2.9:40000 users:(("x ino:1",pid=1,fd=1)) sk:3`,
+}
+
+// Records as 'ss -xpeH' prints them
+var unixRecordSeeds = []string{
+	`u_str ESTAB 0      0      /run/app.sock 145417 * 145416 users:(("app",pid=31192,fd=21)) <->`,
+	`u_str ESTAB 0      0      * 906    * 907    users:(("svc",pid=129,fd=8),("svc",pid=129,fd=6)) <->`,
+	`u_str ESTAB 0      0      /run/app.sock 659    * 658    ---`,
+}
+
+// ss headers of several iproute2 releases
+var ssHeaderSeeds = []string{
+	"State Recv-Q Send-Q Local Address:Port  Peer Address:Port Process",
+	"State      Recv-Q Send-Q Local Address:Port               Peer Address:Port",
+	"Recv-Q Send-Q Local Address:Port Peer Address:PortProcess",
+	"Netid State Recv-Q Send-Q Local Address:Port   Peer Address:Port  Process",
+}
+
+// checkRecord fails t unless a successfully parsed record identifies one socket
+func checkRecord(t *testing.T, line string, c *ConnectionInfo) {
+	t.Helper()
+	if c.Inode == "" || leadingDigits(c.Inode) != c.Inode {
+		t.Errorf("inode %q from %q", c.Inode, line)
+	}
+	if c.TCPState == "" {
+		t.Errorf("no state from %q", line)
+	}
+	if !validAddr(c.LocalAddr) || !validAddr(c.PeerAddr) {
+		t.Errorf("addresses %q -> %q from %q", c.LocalAddr, c.PeerAddr, line)
+	}
+}
+
+func FuzzParseSSRecord(f *testing.F) {
+	for _, line := range ssRecordSeeds {
+		f.Add(line, false)
+	}
+	for _, line := range unixRecordSeeds {
+		f.Add(line, true)
+	}
+	unixFormat := &ssFormat{Version: "iproute2-test", NoHeader: true}
+	if err := unixFormat.parseHeader(ssHeaderSeeds[3]); err != nil {
+		f.Fatal(err)
+	}
+	f.Fuzz(func(t *testing.T, line string, unix bool) {
+		format := testFormat
+		setFor(t, &protocol, "tcp")
+		if unix {
+			format = unixFormat
+			protocol = "unix"
+		}
+		var c ConnectionInfo
+		if err := parseSSRecord(line, format, &c); err != nil {
+			return
+		}
+		checkRecord(t, line, &c)
+	})
+}
+
+func FuzzParseHeader(f *testing.F) {
+	for _, header := range ssHeaderSeeds {
+		for _, line := range ssRecordSeeds {
+			f.Add(header, line)
+		}
+	}
+	f.Fuzz(func(t *testing.T, header, line string) {
+		format := &ssFormat{Version: "iproute2-test", NoHeader: true}
+		if err := format.parseHeader(header); err != nil {
+			return
+		}
+		if format.LocalCol < 0 || format.PeerCol < 0 || format.minFields() > maxSSColumns {
+			t.Fatalf("header %q accepted as %s", header, format)
+		}
+		// Whatever layout a header yields, records must parse against it safely
+		for _, proto := range []string{"tcp", "unix"} {
+			setFor(t, &protocol, proto)
+			var c ConnectionInfo
+			if err := parseSSRecord(line, format, &c); err == nil {
+				checkRecord(t, line, &c)
+			}
+		}
+	})
+}
+
+func FuzzParseConfigDoc(f *testing.F) {
+	for _, doc := range []string{
+		"max-active=2h\nmax-inactive = 30m\n",
+		"# tightened during the incident\n-dry-run=true\n\nwarn-before=5\n",
+		"max-transfer=1G\nthroughput-window=10m\npressure-max-active=20m",
+		"port=8080\n",
+		"max-active\n",
+		"max-active==\r\n",
+	} {
+		f.Add(doc)
+	}
+	f.Fuzz(func(t *testing.T, doc string) {
+		values, err := parseConfigDoc(doc)
+		if err != nil {
+			if values != nil {
+				t.Fatalf("values %v returned with error %v", values, err)
+			}
+			return
+		}
+		for key, value := range values {
+			if !slices.Contains(liveFlags, key) {
+				t.Errorf("key %q is not a live flag, from %q", key, doc)
+			}
+			if strings.TrimSpace(value) != value {
+				t.Errorf("value %q of %s is not trimmed, from %q", value, key, doc)
+			}
+		}
+	})
+}
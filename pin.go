@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadPins reads the pin file into a map of match key -> reason.
+// Blank lines and lines starting with '#' are ignored.
+func loadPins(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parsePins(f)
+}
+
+// parsePins reads '<key> <reason>' lines, as in the pin file
+func parsePins(r io.Reader) (map[string]string, error) {
+	pins := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, reason, _ := strings.Cut(line, " ")
+		reason = strings.TrimSpace(reason)
+		if reason == "" {
+			reason = "pinned"
+		}
+		pins[key] = reason
+	}
+
+	return pins, scanner.Err()
+}
+
+// readPins loads the pin file, returning nil when pinning is disabled or the
+// file can't be read (the previous pins are then kept rather than dropped)
+func readPins() map[string]string {
+	if pinFile == "" {
+		return nil
+	}
+
+	pins, err := loadPins(pinFile)
+	if err != nil {
+		log.Printf("Warning: Could not read pin file %s: %v", pinFile, err)
+		return nil
+	}
+	return pins
+}
+
+// applyPins marks tracked connections matching pins as pinned and clears the
+// pin of any connection no longer listed. Must be called with mu held.
+func applyPins(pins map[string]string) {
+	if pins == nil {
+		return
+	}
+
+	index := indexPins(pins)
+	for _, conn := range connections {
+		reason, ok := index.match(conn)
+		switch {
+		case ok && !conn.Pinned:
+			log.Printf("Pinned connection (Inode %s): %s [%s]", conn.Inode, conn.ConnectionID, reason)
+		case !ok && conn.Pinned:
+			log.Printf("Unpinned connection (Inode %s): %s", conn.Inode, conn.ConnectionID)
+		}
+		conn.Pinned = ok
+		conn.PinReason = reason
+	}
+}
+
+// pinIndex holds pins by what they match. Addresses are kept parsed, unmapped
+// and without zone, so an IPv4 pin also matches a peer ss shows IPv4-mapped
+// on a dual-stack listener.
+type pinIndex struct {
+	inodes map[string]string
+	peers  map[netip.AddrPort]string
+	ips    map[netip.Addr]string
+}
+
+func indexPins(pins map[string]string) pinIndex {
+	index := pinIndex{
+		inodes: make(map[string]string),
+		peers:  make(map[netip.AddrPort]string),
+		ips:    make(map[netip.Addr]string),
+	}
+	for key, reason := range pins {
+		if ap, err := netip.ParseAddrPort(key); err == nil {
+			index.peers[netip.AddrPortFrom(ap.Addr().Unmap().WithZone(""), ap.Port())] = reason
+		} else if ip, err := netip.ParseAddr(key); err == nil {
+			index.ips[ip.Unmap().WithZone("")] = reason
+		} else {
+			index.inodes[key] = reason
+		}
+	}
+	return index
+}
+
+// match returns the reason conn is pinned for: by inode, peer IP:port, peer
+// IP or the client IP behind a proxy
+func (index pinIndex) match(conn *ConnectionInfo) (string, bool) {
+	if reason, ok := index.inodes[conn.Inode]; ok {
+		return reason, true
+	}
+	if ip, ok := localIP(conn.PeerAddr); ok {
+		if _, port, err := net.SplitHostPort(conn.PeerAddr); err == nil {
+			if n, err := strconv.ParseUint(port, 10, 16); err == nil {
+				if reason, ok := index.peers[netip.AddrPortFrom(ip, uint16(n))]; ok {
+					return reason, true
+				}
+			}
+		}
+		if reason, ok := index.ips[ip]; ok {
+			return reason, true
+		}
+	}
+	if ip, err := netip.ParseAddr(conn.ClientIP); err == nil {
+		if reason, ok := index.ips[ip.Unmap().WithZone("")]; ok {
+			return reason, true
+		}
+	}
+	return "", false
+}
+
+// countPinned returns how many tracked connections are currently pinned
+func countPinned() int {
+	n := 0
+	for _, conn := range connections {
+		if conn.Pinned {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var pluginConfigFile string
+
+func init() {
+	flag.StringVar(&pluginConfigFile, "plugin-config", "", "File declaring exec plugins, one '[notifier name]' or '[policy name]' block each")
+}
+
+// pluginDefaultTimeout bounds one plugin invocation unless its block sets timeout
+const pluginDefaultTimeout = 10 * time.Second
+
+// plugin is one block of -plugin-config. Plugins are external programs that
+// get one JSON request on stdin per invocation and answer on stdout.
+type plugin struct {
+	Kind    string
+	Name    string
+	Argv    []string
+	Timeout time.Duration
+	Events  map[string]bool   // notifier event filter; empty passes every event
+	Config  map[string]string // every other key of the block, handed to the plugin
+}
+
+// pluginKinds registers the plugins of each block kind
+var pluginKinds = map[string]func(*plugin){
+	"notifier": func(p *plugin) {
+		sinks = append(sinks, newPluginNotifier(p))
+	},
+	"policy": func(p *plugin) {
+		policyPlugins = append(policyPlugins, p)
+	},
+}
+
+// pluginRequest is the JSON a plugin reads on stdin
+type pluginRequest struct {
+	Type        string            `json:"type"` // "event" or "evaluate"
+	Plugin      string            `json:"plugin"`
+	Config      map[string]string `json:"config,omitempty"`
+	Event       json.RawMessage   `json:"event,omitempty"`       // the versioned event envelope
+	Connections []pluginConn      `json:"connections,omitempty"` // for "evaluate"
+}
+
+// parsePluginConfig reads blocks such as
+//
+//	[notifier chat]
+//	exec = /usr/local/bin/chat-notify --room ops
+//	events = kill,kill_failed
+//	timeout = 5
+//	room = #ops
+//
+// exec is required; keys other than exec, events and timeout are passed to
+// the plugin as its config.
+func parsePluginConfig(text string) ([]*plugin, error) {
+	var plugins []*plugin
+	var cur *plugin
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			head := strings.Fields(strings.Trim(line, "[]"))
+			if len(head) != 2 {
+				return nil, fmt.Errorf("line %d: expected [kind name], got %s", n+1, line)
+			}
+			if _, ok := pluginKinds[head[0]]; !ok {
+				return nil, fmt.Errorf("line %d: unknown plugin kind %q", n+1, head[0])
+			}
+			cur = &plugin{Kind: head[0], Name: head[1], Timeout: pluginDefaultTimeout, Config: map[string]string{}}
+			plugins = append(plugins, cur)
+			continue
+		}
+		if cur == nil {
+			return nil, fmt.Errorf("line %d: setting outside a plugin block", n+1)
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n+1)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "exec":
+			cur.Argv = strings.Fields(value)
+		case "events":
+			cur.Events = make(map[string]bool)
+			for _, t := range splitList(value) {
+				cur.Events[t] = true
+			}
+		case "timeout":
+			secs, err := strconv.Atoi(value)
+			if err != nil || secs < 1 {
+				return nil, fmt.Errorf("line %d: timeout must be a positive number of seconds", n+1)
+			}
+			cur.Timeout = time.Duration(secs) * time.Second
+		default:
+			cur.Config[key] = value
+		}
+	}
+	for _, p := range plugins {
+		if len(p.Argv) == 0 {
+			return nil, fmt.Errorf("%s %s: missing exec", p.Kind, p.Name)
+		}
+	}
+	return plugins, nil
+}
+
+// call runs the plugin once with req on stdin and returns its stdout
+func (p *plugin) call(req pluginRequest) ([]byte, error) {
+	req.Plugin = p.Name
+	req.Config = p.Config
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+	out, err := runner.Exchange(ctx, input, p.Argv[0], p.Argv[1:]...)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("timed out after %s", p.Timeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return out, err
+}
+
+// setupPlugins registers the plugins declared in -plugin-config
+func setupPlugins() error {
+	if pluginConfigFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(pluginConfigFile)
+	if err != nil {
+		return err
+	}
+	plugins, err := parsePluginConfig(string(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", pluginConfigFile, err)
+	}
+	for _, p := range plugins {
+		pluginKinds[p.Kind](p)
+		infof("Plugin: %s %s (%s)\n", p.Kind, p.Name, strings.Join(p.Argv, " "))
+	}
+	return nil
+}
+
+// pluginNotifier hands every event to a notifier plugin, one invocation per event
+type pluginNotifier struct {
+	p     *plugin
+	queue chan Event
+}
+
+func newPluginNotifier(p *plugin) *pluginNotifier {
+	n := &pluginNotifier{p: p, queue: make(chan Event, 256)}
+	go n.run()
+	return n
+}
+
+// Send queues the event, dropping it if the plugin is falling behind
+func (n *pluginNotifier) Send(ev Event) {
+	if len(n.p.Events) > 0 && !n.p.Events[ev.Type] {
+		return
+	}
+	select {
+	case n.queue <- ev:
+	default:
+		log.Printf("Warning: plugin %s queue full, dropping %s event", n.p.Name, ev.Type)
+	}
+}
+
+func (n *pluginNotifier) run() {
+	for ev := range n.queue {
+		payload, err := marshalEvent(ev)
+		if err != nil {
+			log.Printf("Error encoding event for plugin %s: %v", n.p.Name, err)
+			continue
+		}
+		if _, err := n.p.call(pluginRequest{Type: "event", Event: payload}); err != nil {
+			log.Printf("Error running notifier plugin %s: %v", n.p.Name, err)
+		}
+	}
+}
+
+// policyPlugins are asked every cycle which connections to kill
+var policyPlugins []*plugin
+
+// pluginConn is a connection as shown to policy plugins. Send and receive
+// rates are those measured up to the previous cycle.
+type pluginConn struct {
+	ID            string    `json:"id"` // to be echoed in the verdict
+	Inode         string    `json:"inode"`
+	Host          string    `json:"host,omitempty"`
+	State         ConnState `json:"state"`
+	TCPState      string    `json:"tcp_state"`
+	LocalAddr     string    `json:"local_addr"`
+	PeerAddr      string    `json:"peer_addr"`
+	ClientIP      string    `json:"client_ip,omitempty"`
+	Process       string    `json:"process,omitempty"`
+	PID           int       `json:"pid,omitempty"`
+	AgeSeconds    float64   `json:"age_seconds"`
+	BytesSent     int64     `json:"bytes_sent"`
+	BytesReceived int64     `json:"bytes_received"`
+	SendRate      float64   `json:"send_rate"`
+	RecvRate      float64   `json:"recv_rate"`
+	RTTMs         float64   `json:"rtt_ms"`
+	RetransRate   float64   `json:"retrans_rate"`
+}
+
+// pluginVerdict is the JSON a policy plugin writes on stdout
+type pluginVerdict struct {
+	Kill []struct {
+		ID     string `json:"id"`
+		Reason string `json:"reason"`
+	} `json:"kill"`
+}
+
+// evaluatePolicyPlugins asks every policy plugin about the listed connections
+// and returns the kills they request, by connection key. A failing plugin is
+// logged and requests nothing. Must be called without mu held.
+func evaluatePolicyPlugins(listed []*ConnectionInfo, now time.Time) map[string]KillReason {
+	if len(policyPlugins) == 0 || len(listed) == 0 {
+		return nil
+	}
+
+	conns := make([]pluginConn, 0, len(listed))
+	mu.Lock()
+	for _, c := range listed {
+		pc := pluginConn{ID: c.key(), Inode: c.Inode, Host: c.Host, State: StateNew, TCPState: c.TCPState,
+			LocalAddr: c.LocalAddr, PeerAddr: c.PeerAddr, Process: c.Process, PID: c.PID,
+			BytesSent: c.BytesSent, BytesReceived: c.BytesReceived, RTTMs: c.RTTMs, RetransRate: c.RetransRate}
+		if tracked, ok := connections[c.key()]; ok {
+			pc.State = tracked.State
+			pc.ClientIP = tracked.ClientIP
+			pc.AgeSeconds = now.Sub(tracked.TimeAdded).Seconds()
+			pc.SendRate, pc.RecvRate = tracked.SendRate, tracked.RecvRate
+		}
+		conns = append(conns, pc)
+	}
+	mu.Unlock()
+
+	verdicts := make(map[string]KillReason)
+	for _, p := range policyPlugins {
+		out, err := p.call(pluginRequest{Type: "evaluate", Connections: conns})
+		if err != nil {
+			log.Printf("Error running policy plugin %s: %v", p.Name, err)
+			continue
+		}
+		// Printing nothing requests no kills
+		if len(bytes.TrimSpace(out)) == 0 {
+			continue
+		}
+		var v pluginVerdict
+		if err := json.Unmarshal(out, &v); err != nil {
+			log.Printf("Error reading verdict of policy plugin %s: %v", p.Name, err)
+			continue
+		}
+		for _, k := range v.Kill {
+			if _, ok := verdicts[k.ID]; !ok {
+				verdicts[k.ID] = KillReason{ReasonPlugin, p.Name + ": " + k.Reason}
+			}
+		}
+	}
+	return verdicts
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// intervalPolicies are the policies -policy-interval can slow down. Expiry of
+// inactive connections and kill retries run every check regardless.
+var intervalPolicies = []string{"max-active", "max-persist", "max-zero-window", "bandwidth", "plugin"}
+
+// policyIntervalMap is the -policy-interval flag: "policy=minutes[,policy=minutes]"
+type policyIntervalMap map[string]int
+
+var policyIntervals = make(policyIntervalMap)
+
+// policyLastRun is when each slowed-down policy was last evaluated
+var policyLastRun = make(map[string]time.Time)
+
+func init() {
+	flag.Var(&policyIntervals, "policy-interval", "Check some policies less often than every -check-interval, e.g. 'max-active=30,bandwidth=5m' (bare numbers are minutes; policies: "+strings.Join(intervalPolicies, ", ")+")")
+}
+
+func (m *policyIntervalMap) String() string {
+	var parts []string
+	for name, n := range *m {
+		parts = append(parts, name+"="+humanMinutes(n))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (m *policyIntervalMap) Set(value string) error {
+	for _, kv := range strings.Split(value, ",") {
+		name, raw, ok := strings.Cut(kv, "=")
+		n, err := parseMinutes(raw)
+		if !ok || err != nil || n < 1 {
+			return fmt.Errorf("invalid policy interval %q: want policy=<duration>", kv)
+		}
+		known := false
+		for _, p := range intervalPolicies {
+			known = known || p == name
+		}
+		if !known {
+			return fmt.Errorf("unknown policy %q", name)
+		}
+		(*m)[name] = n
+	}
+	return nil
+}
+
+// duePolicies returns the policies evaluated this cycle and records their
+// run. A policy without its own interval is due every cycle; one with an
+// interval is due once that much time has passed, give or take half a check
+// interval so ticker jitter doesn't skip a whole cycle.
+func duePolicies(now time.Time) map[string]bool {
+	slack := minutes(checkIntervalMin) / 2
+	due := make(map[string]bool, len(intervalPolicies))
+	for _, name := range intervalPolicies {
+		interval, ok := policyIntervals[name]
+		if !ok {
+			due[name] = true
+			continue
+		}
+		last, ran := policyLastRun[name]
+		if !ran || now.Sub(last) >= minutes(interval)-slack {
+			due[name] = true
+			policyLastRun[name] = now
+		}
+	}
+	return due
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Listed connections are parsed into entries taken from connPool. An entry
+// whose connection is already tracked only carries fresh figures into the
+// tracked copy, so it is handed back once the cycle has merged it. With a
+// stable set of connections, steady-state cycles then allocate little beyond
+// the listing text itself.
+var connPool struct {
+	sync.Mutex
+	free []*ConnectionInfo
+}
+
+// acquireConn returns a zeroed entry for a listed connection
+func acquireConn() *ConnectionInfo {
+	connPool.Lock()
+	defer connPool.Unlock()
+	n := len(connPool.free)
+	if n == 0 {
+		return new(ConnectionInfo)
+	}
+	c := connPool.free[n-1]
+	connPool.free = connPool.free[:n-1]
+	*c = ConnectionInfo{}
+	return c
+}
+
+// releaseConns hands listed entries back to the pool. The caller must not
+// keep any reference to them.
+func releaseConns(conns []*ConnectionInfo) {
+	connPool.Lock()
+	defer connPool.Unlock()
+	connPool.free = append(connPool.free, conns...)
+}
+
+// seenBuf is the set of listed keys, cleared and reused by every cycle
+var seenBuf = make(map[string]bool)
+
+// listingSizeHint is the number of records in the last listing, used to size
+// the next one up front. The collector and the evaluator may both list.
+var listingSizeHint atomic.Int64
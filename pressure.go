@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	pressureMaxActiveMin int
+	pressureHighPct      int
+	pressureLowPct       int
+
+	underPressure bool
+)
+
+func init() {
+	minutesVar(&pressureMaxActiveMin, "pressure-max-active", 0, "Max active duration in minutes used while the host is under pressure (0 disables adaptive thresholds)")
+	flag.IntVar(&pressureHighPct, "pressure-high", 90, "Ephemeral port or file handle usage, in percent, that switches to -pressure-max-active")
+	flag.IntVar(&pressureLowPct, "pressure-low", 75, "Usage, in percent, below which the normal -max-active is restored")
+}
+
+// currentMaxActiveMin returns the max-active threshold for this cycle, switching
+// between the configured and the pressure value with hysteresis
+func currentMaxActiveMin() int {
+	if pressureMaxActiveMin <= 0 {
+		return maxActiveDurMin
+	}
+
+	usage, detail, err := hostPressure()
+	if err != nil {
+		log.Printf("Warning: Could not read host pressure, keeping current thresholds: %v", err)
+	} else {
+		switch {
+		case !underPressure && usage >= float64(pressureHighPct):
+			underPressure = true
+			log.Printf("Host under pressure (%s): max-active tightened from %s to %s", detail, humanMinutes(maxActiveDurMin), humanMinutes(pressureMaxActiveMin))
+		case underPressure && usage < float64(pressureLowPct):
+			underPressure = false
+			log.Printf("Host pressure relieved (%s): max-active restored to %s", detail, humanMinutes(maxActiveDurMin))
+		}
+	}
+
+	if underPressure {
+		return pressureMaxActiveMin
+	}
+	return maxActiveDurMin
+}
+
+// lastActiveLimit is the global max-active the monitor loop applies with the
+// live flags and the pressure and flood state of the last cycle, without
+// sampling the host again
+func lastActiveLimit() int {
+	limit := maxActiveDurMin
+	if underPressure && pressureMaxActiveMin > 0 {
+		limit = pressureMaxActiveMin
+	}
+	return tightenMaxActive(limit)
+}
+
+// hostPressure returns the highest of ephemeral port usage and file handle usage, in percent
+func hostPressure() (float64, string, error) {
+	ports, err := ephemeralPortUsage()
+	if err != nil {
+		return 0, "", err
+	}
+	files, err := fileHandleUsage()
+	if err != nil {
+		return 0, "", err
+	}
+
+	detail := fmt.Sprintf("ephemeral ports %.0f%%, file handles %.0f%%", ports, files)
+	return max(ports, files), detail, nil
+}
+
+// ephemeralPortUsage compares TCP sockets in use or in TIME-WAIT with the size of the local port range
+func ephemeralPortUsage() (float64, error) {
+	rangeData, err := os.ReadFile("/proc/sys/net/ipv4/ip_local_port_range")
+	if err != nil {
+		return 0, err
+	}
+	bounds := strings.Fields(string(rangeData))
+	if len(bounds) != 2 {
+		return 0, fmt.Errorf("unexpected ip_local_port_range: %q", rangeData)
+	}
+	low, _ := strconv.Atoi(bounds[0])
+	high, _ := strconv.Atoi(bounds[1])
+	if high <= low {
+		return 0, fmt.Errorf("unexpected ip_local_port_range: %q", rangeData)
+	}
+
+	used := 0
+	for _, path := range []string{"/proc/net/sockstat", "/proc/net/sockstat6"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if !strings.HasPrefix(line, "TCP:") && !strings.HasPrefix(line, "TCP6:") {
+				continue
+			}
+			fields := strings.Fields(line)
+			for i := 1; i+1 < len(fields); i += 2 {
+				if fields[i] == "inuse" || fields[i] == "tw" {
+					n, _ := strconv.Atoi(fields[i+1])
+					used += n
+				}
+			}
+		}
+	}
+
+	return float64(used) * 100 / float64(high-low+1), nil
+}
+
+// fileHandleUsage compares allocated file handles with fs.file-max
+func fileHandleUsage() (float64, error) {
+	data, err := os.ReadFile("/proc/sys/fs/file-nr")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 3 {
+		return 0, fmt.Errorf("unexpected file-nr: %q", data)
+	}
+	allocated, _ := strconv.ParseFloat(fields[0], 64)
+	maximum, _ := strconv.ParseFloat(fields[2], 64)
+	if maximum <= 0 {
+		return 0, fmt.Errorf("unexpected file-nr: %q", data)
+	}
+	return allocated * 100 / maximum, nil
+}
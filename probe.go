@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	probeCmd     string
+	probeTimeout int
+)
+
+func init() {
+	flag.StringVar(&probeCmd, "probe-cmd", "", "Liveness probe run before each kill; exit status 0 means the client is alive and spares it. Placeholders: {local} {peer} {peer_ip} {peer_port} {inode} {pid}")
+	flag.IntVar(&probeTimeout, "probe-timeout", 10, "Seconds before a liveness probe is considered failed")
+}
+
+// probeAlive runs the configured probe for a kill candidate. It returns true only when
+// the probe exits successfully; a failing, timed-out or unrunnable probe means "kill".
+func probeAlive(conn *ConnectionInfo) (bool, error) {
+	args := expandProbeArgs(probeCmd, conn)
+	if len(args) == 0 {
+		return false, fmt.Errorf("empty probe command")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(probeTimeout)*time.Second)
+	defer cancel()
+
+	output, err := runner.Run(ctx, args[0], args[1:]...)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, fmt.Errorf("probe timed out after %ds", probeTimeout)
+		}
+		return false, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return true, nil
+}
+
+// expandProbeArgs splits the template on whitespace and fills the placeholders of each
+// argument, so connection data never passes through a shell
+func expandProbeArgs(template string, conn *ConnectionInfo) []string {
+	peerIP, peerPort := conn.PeerAddr, ""
+	if i := strings.LastIndex(conn.PeerAddr, ":"); i >= 0 {
+		peerIP = strings.Trim(conn.PeerAddr[:i], "[]")
+		peerPort = conn.PeerAddr[i+1:]
+	}
+
+	replacer := strings.NewReplacer(
+		"{local}", conn.LocalAddr,
+		"{peer}", conn.PeerAddr,
+		"{peer_ip}", peerIP,
+		"{peer_port}", peerPort,
+		"{inode}", conn.Inode,
+		"{pid}", strconv.Itoa(conn.PID),
+	)
+
+	args := strings.Fields(template)
+	for i, arg := range args {
+		args[i] = replacer.Replace(arg)
+	}
+	return args
+}
+
+// filterProbed drops the candidates whose liveness probe succeeds
+func filterProbed(conns []*ConnectionInfo, reasons []KillReason) ([]*ConnectionInfo, []KillReason) {
+	if probeCmd == "" {
+		return conns, reasons
+	}
+
+	var keptConns []*ConnectionInfo
+	var keptReasons []KillReason
+	for i, conn := range conns {
+		alive, err := probeAlive(conn)
+		if alive {
+			infof(" = Sparing connection, liveness probe succeeded (Inode %s): %s\n", conn.Inode, conn.ConnectionID)
+			continue
+		}
+		verbosef(" . Liveness probe failed (Inode %s): %v\n", conn.Inode, err)
+		keptConns = append(keptConns, conn)
+		keptReasons = append(keptReasons, reasons[i])
+	}
+	return keptConns, keptReasons
+}
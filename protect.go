@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	neverTouch    string
+	killRootOwned bool
+)
+
+func init() {
+	flag.StringVar(&neverTouch, "never-touch", "", "Comma-separated process names, pid:N and uid:N whose sockets are never killed, whatever policy matches (e.g. sshd,corosync,uid:0)")
+	flag.BoolVar(&killRootOwned, "kill-root-owned", false, "Let policies kill sockets owned by root (uid 0) or by the kernel (established with no owning process); they are left alone by default")
+}
+
+// protection is the parsed -never-touch list
+type protection struct {
+	names map[string]bool
+	pids  map[int]bool
+	uids  map[int]bool
+}
+
+var protected protection
+
+// parseNeverTouch parses a -never-touch list
+func parseNeverTouch(list string) (protection, error) {
+	p := protection{names: map[string]bool{}, pids: map[int]bool{}, uids: map[int]bool{}}
+	for _, item := range splitList(list) {
+		kind, value, found := strings.Cut(item, ":")
+		if !found {
+			p.names[item] = true
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("invalid -never-touch entry %q", item)
+		}
+		switch kind {
+		case "pid":
+			p.pids[n] = true
+		case "uid":
+			p.uids[n] = true
+		default:
+			return p, fmt.Errorf("invalid -never-touch entry %q: use a process name, pid:N or uid:N", item)
+		}
+	}
+	return p, nil
+}
+
+// ownerRules reports whether the list has process name or pid rules, which
+// need the owner of each socket
+func (p protection) ownerRules() bool {
+	return len(p.names) > 0 || len(p.pids) > 0
+}
+
+// protects reports whether conn belongs to a protected owner, and why. An
+// owner that ss did not report can't be cleared, so it counts as protected
+// while rules of that kind exist.
+func (p protection) protects(conn *ConnectionInfo) (string, bool) {
+	if name, ok := feedMatch(conn, FeedAllow); ok {
+		return "feed " + name, true
+	}
+	if why, ok := privilegedOwner(conn); ok && !killRootOwned {
+		return why, true
+	}
+	// Without -p ('list' and 'status') no owner is known at all, so name and
+	// pid rules are skipped rather than claiming every socket
+	if p.ownerRules() && listOwners {
+		switch {
+		case conn.PID <= 0:
+			return "owner process unknown", true
+		case p.names[conn.Process]:
+			return "process " + conn.Process, true
+		case p.pids[conn.PID]:
+			return fmt.Sprintf("pid %d", conn.PID), true
+		}
+	}
+	if len(p.uids) > 0 {
+		switch {
+		case conn.UID < 0:
+			return "owner uid unknown", true
+		case p.uids[conn.UID]:
+			return fmt.Sprintf("uid %d", conn.UID), true
+		}
+	}
+	return "", false
+}
+
+// privilegedOwner reports whether conn belongs to root or to the kernel. A
+// kernel socket (NFS, iSCSI and the like) is established yet held by no
+// process; an orphan closing down has no process either but is fair game.
+// Without -p in the listing no owner is known, so only the uid counts.
+func privilegedOwner(conn *ConnectionInfo) (string, bool) {
+	switch {
+	case conn.UID == 0:
+		return "root-owned", true
+	case listOwners && conn.PID <= 0 && conn.TCPState == "ESTAB" && protocol != "unix":
+		return "kernel-owned", true
+	}
+	return "", false
+}
@@ -0,0 +1,42 @@
+package main
+
+import "flag"
+
+var (
+	protocol string
+	unixPath string
+)
+
+func init() {
+	flag.StringVar(&protocol, "protocol", "tcp", "Transport protocol of the monitored port: 'tcp', 'udp', 'sctp', or 'unix' for the socket at -unix-path")
+	flag.StringVar(&unixPath, "unix-path", "", "Path of the Unix domain socket monitored with -protocol unix")
+}
+
+// protocolFlags are the ss options selecting each -protocol
+var protocolFlags = map[string]string{
+	"tcp":  "-t",
+	"udp":  "-u",
+	"sctp": "-S",
+	"unix": "-x",
+}
+
+// protocolFlag returns the ss option listing -protocol sockets
+func protocolFlag() string {
+	return protocolFlags[protocol]
+}
+
+// destroySupported reports whether the kernel can destroy -protocol sockets
+// through sock_diag, which 'ss --kill' relies on. SCTP diag has no destroy
+// operation and unix sockets have none either, so those are always shut down
+// through the owner's fd.
+func destroySupported() bool {
+	return protocol != "sctp" && protocol != "unix"
+}
+
+// listFilter returns the ss filter selecting the monitored sockets
+func listFilter() []string {
+	if protocol == "unix" {
+		return []string{"src", unixPath}
+	}
+	return append(portFilter(), routingFilter()...)
+}
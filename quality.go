@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rttBuckets are the RTT histogram upper bounds, in seconds
+var rttBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// retransBuckets are the retransmit ratio histogram upper bounds
+var retransBuckets = []float64{0.001, 0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5}
+
+// parseQuality fills the RTT ("rtt:avg/var") and retransmit ("retrans:cur/total")
+// counters of tcp_info from an ss line; must run after parseTraffic
+func (c *ConnectionInfo) parseQuality(line string) {
+	if rtt, ok := fieldValue(line, "rtt:"); ok {
+		avg, dev, _ := strings.Cut(rtt, "/")
+		c.RTTMs, _ = strconv.ParseFloat(avg, 64)
+		c.RTTVarMs, _ = strconv.ParseFloat(dev, 64)
+	}
+	if retrans, ok := fieldValue(line, "retrans:"); ok {
+		_, total, _ := strings.Cut(retrans, "/")
+		c.Retrans, _ = strconv.ParseInt(leadingDigits(total), 10, 64)
+	}
+	if c.SegsOut > 0 {
+		c.RetransRate = float64(c.Retrans) / float64(c.SegsOut)
+	}
+}
+
+// updateQuality copies the quality figures of the latest listing
+func (c *ConnectionInfo) updateQuality(listed *ConnectionInfo) {
+	c.RTTMs = listed.RTTMs
+	c.RTTVarMs = listed.RTTVarMs
+	c.Retrans = listed.Retrans
+	c.RetransRate = listed.RetransRate
+}
+
+// QualitySnapshot holds the RTT and retransmit ratio of every live connection
+// at the end of a cycle, sorted ascending
+type QualitySnapshot struct {
+	RTTs          []time.Duration
+	RetransRatios []float64
+}
+
+// takeQualitySnapshot collects the quality of the live connections; must be called with mu held
+func takeQualitySnapshot() QualitySnapshot {
+	var q QualitySnapshot
+	for _, conn := range connections {
+		if !conn.Alive() || conn.RTTMs == 0 {
+			continue
+		}
+		q.RTTs = append(q.RTTs, time.Duration(conn.RTTMs*float64(time.Millisecond)))
+		q.RetransRatios = append(q.RetransRatios, conn.RetransRate)
+	}
+	sort.Slice(q.RTTs, func(i, j int) bool { return q.RTTs[i] < q.RTTs[j] })
+	sort.Float64s(q.RetransRatios)
+	return q
+}
+
+// rttPercentile returns the p-th percentile (0-100) of the snapshot RTTs
+func (q QualitySnapshot) rttPercentile(p float64) time.Duration {
+	if len(q.RTTs) == 0 {
+		return 0
+	}
+	return q.RTTs[int(float64(len(q.RTTs)-1)*p/100)]
+}
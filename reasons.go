@@ -0,0 +1,32 @@
+package main
+
+// Machine-readable reason codes attached to every kill and removal
+const (
+	ReasonMaxActive     = "MAX_ACTIVE_EXCEEDED"
+	ReasonPersistTimer  = "PERSIST_TIMER"
+	ReasonZeroWindow    = "ZERO_WINDOW"
+	ReasonTransferQuota = "TRANSFER_QUOTA"
+	ReasonThroughput    = "THROUGHPUT_EXCEEDED"
+	ReasonExhaustion    = "RESOURCE_EXHAUSTION"
+	ReasonInactive      = "INACTIVE_EXPIRED"
+	ReasonPlugin        = "PLUGIN_POLICY"
+	ReasonChaos         = "CHAOS_TEST"
+	ReasonFeed          = "THREAT_FEED"
+)
+
+// KillReason pairs a reason code with a human-readable detail
+type KillReason struct {
+	Code   string
+	Detail string
+}
+
+func (r KillReason) String() string {
+	return r.Code + ": " + r.Detail
+}
+
+// reasonEvent builds a connection event carrying a reason code
+func reasonEvent(eventType string, conn *ConnectionInfo, reason KillReason) Event {
+	ev := connEvent(eventType, conn, reason.Detail)
+	ev.Reason = reason.Code
+	return ev
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+)
+
+var (
+	remoteHosts string
+	sshCommand  string
+)
+
+func init() {
+	flag.StringVar(&remoteHosts, "remote", "", "Comma-separated hosts ([user@]host) to monitor over SSH instead of the local machine; read-only, kills are disabled")
+	flag.StringVar(&sshCommand, "ssh-cmd", "ssh -o BatchMode=yes -o ConnectTimeout=10", "Command used to reach -remote hosts; the host and the ss command line are appended")
+}
+
+// remoteMode reports whether connections are listed on remote hosts
+func remoteMode() bool {
+	return remoteHosts != ""
+}
+
+// ssCommand returns the command line running ss with args locally, or
+// through SSH on host
+func ssCommand(host string, args ...string) []string {
+	if host == "" {
+		return append([]string{ssPath}, args...)
+	}
+	ssh := strings.Fields(sshCommand)
+	return append(ssh, host, ssPath+" "+strings.Join(args, " "))
+}
+
+// listCommand returns the ss listing command line for the layout detected on host
+func listCommand(host string, format *ssFormat) []string {
+	opts := protocolFlag() + "npeoi"
+	if !listOwners {
+		opts = strings.Replace(opts, "p", "", 1)
+	}
+	if format.NoHeader {
+		opts += "H"
+	}
+	return ssCommand(host, append([]string{opts}, listFilter()...)...)
+}
+
+// listCurrentConnections lists the monitored port locally, or on every -remote
+// host. A remote host that can't be listed is logged and skipped, and its
+// origin returned in unlisted so its connections are left as they were; the
+// listing only fails when no host answers.
+func listCurrentConnections(ctx context.Context) (all []*ConnectionInfo, unlisted map[string]bool, err error) {
+	if allNetns {
+		return listAllNamespaces(ctx)
+	}
+	if !remoteMode() {
+		all, err = listConnectionsFrom(ctx, "", "")
+		return all, nil, err
+	}
+
+	var lastErr error
+	for _, host := range splitList(remoteHosts) {
+		conns, err := listConnectionsFrom(ctx, host, "")
+		if err != nil {
+			log.Printf("Error listing connections on %s: %v", host, err)
+			lastErr = err
+			if unlisted == nil {
+				unlisted = make(map[string]bool)
+			}
+			unlisted[host] = true
+			continue
+		}
+		all = append(all, conns...)
+	}
+	if len(unlisted) == len(splitList(remoteHosts)) {
+		return nil, nil, fmt.Errorf("no remote host answered: %w", lastErr)
+	}
+	return all, unlisted, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	reputationThreshold    int
+	reputationMaxActiveMin int
+	reputationHalfLifeMin  int
+	reputationMinLifetimes int
+)
+
+func init() {
+	flag.IntVar(&reputationThreshold, "reputation-threshold", 0, "Peers scoring below this reputation (0-100) get -reputation-max-active (0 only scores peers)")
+	minutesVar(&reputationMaxActiveMin, "reputation-max-active", 30, "Max-active in minutes for peers below -reputation-threshold")
+	minutesVar(&reputationHalfLifeMin, "reputation-half-life", 1440, "Minutes after which a peer's kills, lifetimes and idle samples count half toward its reputation")
+	flag.IntVar(&reputationMinLifetimes, "reputation-min-samples", 3, "Connections a peer must have ended before its average lifetime counts toward its reputation")
+}
+
+// PeerReputation is what the reputation of a peer is built from. The counts
+// are weights that decay with -reputation-half-life rather than plain totals.
+type PeerReputation struct {
+	Peer        string    `json:"peer"`
+	Score       float64   `json:"score"` // 100 is spotless, 0 the worst
+	Kills       float64   `json:"kills"`
+	AvgLifetime float64   `json:"avg_lifetime_seconds"`
+	IdleRatio   float64   `json:"idle_ratio"` // share of checks its connections moved no data
+	Updated     time.Time `json:"updated"`
+
+	lifetimes    float64 // decayed number of ended connections
+	lifetimeSecs float64 // decayed sum of their lifetimes
+	samples      float64 // decayed number of traffic samples
+	idle         float64 // decayed number of those without traffic
+}
+
+var (
+	reputations   = make(map[string]*PeerReputation)
+	reputationsMu sync.Mutex
+)
+
+// reputationFor returns peer's record decayed to now, creating it. Must be
+// called with reputationsMu held.
+func reputationFor(peer string, now time.Time) *PeerReputation {
+	rec, ok := reputations[peer]
+	if !ok {
+		peer = strings.Clone(peer) // may be a slice of a connection's strings
+		rec = &PeerReputation{Peer: peer, Updated: now}
+		reputations[peer] = rec
+	}
+	rec.decay(now)
+	return rec
+}
+
+// decay ages the weights from Updated to now
+func (r *PeerReputation) decay(now time.Time) {
+	elapsed := now.Sub(r.Updated)
+	if elapsed <= 0 || reputationHalfLifeMin <= 0 {
+		return
+	}
+	f := math.Exp2(-elapsed.Minutes() / float64(reputationHalfLifeMin))
+	r.Kills *= f
+	r.lifetimes *= f
+	r.lifetimeSecs *= f
+	r.samples *= f
+	r.idle *= f
+	r.Updated = now
+}
+
+// score computes the reputation: kills weigh most, then how much of the time
+// the peer's connections sit idle, then how close they live to max-active on
+// average, which is what dead connections do
+func (r *PeerReputation) score() {
+	r.AvgLifetime, r.IdleRatio = 0, 0
+	if r.lifetimes > 0 && r.lifetimes >= float64(reputationMinLifetimes) {
+		r.AvgLifetime = r.lifetimeSecs / r.lifetimes
+	}
+	if r.samples > 0 {
+		r.IdleRatio = r.idle / r.samples
+	}
+	longLived := 0.0
+	if maxActiveDurMin > 0 {
+		longLived = min(1, r.AvgLifetime/float64(maxActiveDurMin*60))
+	}
+	s := 100 - min(60, 20*r.Kills) - 30*r.IdleRatio - 10*longLived
+	r.Score = math.Round(max(0, s)*10) / 10
+}
+
+// reputationKill counts a successful kill against the connection's peer
+func reputationKill(conn *ConnectionInfo, now time.Time) {
+	reputationsMu.Lock()
+	defer reputationsMu.Unlock()
+	reputationFor(peerIP(conn), now).Kills++
+}
+
+// reputationLifetime records how long one of the peer's connections lived
+func reputationLifetime(conn *ConnectionInfo, lifetime time.Duration, now time.Time) {
+	reputationsMu.Lock()
+	defer reputationsMu.Unlock()
+	rec := reputationFor(peerIP(conn), now)
+	rec.lifetimes++
+	rec.lifetimeSecs += lifetime.Seconds()
+}
+
+// reputationSample records whether a connection moved data since the previous
+// check. Only TCP listings carry the byte counters.
+func reputationSample(conn *ConnectionInfo, now time.Time) {
+	if protocol != "tcp" {
+		return
+	}
+	reputationsMu.Lock()
+	defer reputationsMu.Unlock()
+	rec := reputationFor(peerIP(conn), now)
+	rec.samples++
+	if conn.SendRate == 0 && conn.RecvRate == 0 {
+		rec.idle++
+	}
+}
+
+// lowReputation reports whether conn's peer scores below -reputation-threshold
+func lowReputation(conn *ConnectionInfo) bool {
+	if reputationThreshold <= 0 {
+		return false
+	}
+	reputationsMu.Lock()
+	defer reputationsMu.Unlock()
+	rec, ok := reputations[peerIP(conn)]
+	if !ok {
+		return false
+	}
+	rec.score()
+	return rec.Score < float64(reputationThreshold)
+}
+
+// decayReputations forgets peers whose history has decayed to nothing.
+// Called once per cycle.
+func decayReputations(now time.Time) {
+	reputationsMu.Lock()
+	defer reputationsMu.Unlock()
+	for peer, rec := range reputations {
+		rec.decay(now)
+		if rec.Kills < 0.01 && rec.lifetimes < 0.01 && rec.samples < 0.01 {
+			delete(reputations, peer)
+		}
+	}
+}
+
+// snapshotReputations scores every peer for the API
+func snapshotReputations(now time.Time) []PeerReputation {
+	reputationsMu.Lock()
+	defer reputationsMu.Unlock()
+	out := make([]PeerReputation, 0, len(reputations))
+	for _, rec := range reputations {
+		rec.decay(now)
+		rec.score()
+		out = append(out, *rec)
+	}
+	return out
+}
+
+// validateReputation checks the reputation flags
+func validateReputation() error {
+	if reputationThreshold < 0 || reputationThreshold > 100 {
+		return fmt.Errorf("-reputation-threshold %d must be between 0 and 100", reputationThreshold)
+	}
+	if reputationThreshold > 0 && reputationMaxActiveMin < 1 {
+		return fmt.Errorf("-reputation-max-active must be at least 1 minute")
+	}
+	if reputationHalfLifeMin < 1 {
+		return fmt.Errorf("-reputation-half-life must be at least 1 minute")
+	}
+	return nil
+}
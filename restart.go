@@ -0,0 +1,134 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	restartThreshold   int
+	restartWindowMin   int
+	restartCmd         string
+	restartCooldownMin int
+)
+
+func init() {
+	flag.IntVar(&restartThreshold, "restart-threshold", 0, "Restart a process's service once this many of its sockets were killed within -restart-window (0 disables)")
+	minutesVar(&restartWindowMin, "restart-window", 60, "Minutes over which kills count toward -restart-threshold")
+	flag.StringVar(&restartCmd, "restart-cmd", "systemctl restart {unit}", "Command restarting a leaking service; {unit} (the process's systemd unit), {pid} and {process} are filled in")
+	minutesVar(&restartCooldownMin, "restart-cooldown", 30, "Minutes after a restart before the same unit or process may be restarted again")
+}
+
+// restartTimeout bounds one -restart-cmd
+const restartTimeout = 2 * time.Minute
+
+var (
+	leakKills    = make(map[int][]time.Time)  // kills per owning pid within -restart-window
+	lastRestarts = make(map[string]time.Time) // by unit, or process when it has none
+	leakMu       sync.Mutex
+)
+
+// validateRestart checks the restart flags
+func validateRestart() error {
+	if restartThreshold < 0 {
+		return fmt.Errorf("-restart-threshold must not be negative")
+	}
+	if restartThreshold > 0 && (restartWindowMin < 1 || restartCooldownMin < 0 || strings.TrimSpace(restartCmd) == "") {
+		return fmt.Errorf("-restart-threshold needs a -restart-window of at least 1 minute, a non-negative -restart-cooldown and a -restart-cmd")
+	}
+	return nil
+}
+
+// countLeak records a killed socket against its owning process and restarts
+// the process's service when it crosses -restart-threshold. Called without
+// mu held.
+func countLeak(conn *ConnectionInfo, now time.Time) {
+	if restartThreshold <= 0 || conn.PID <= 0 || remoteMode() {
+		return
+	}
+	window := minutes(restartWindowMin)
+
+	leakMu.Lock()
+	for pid, kills := range leakKills {
+		if now.Sub(kills[len(kills)-1]) >= window {
+			delete(leakKills, pid)
+		}
+	}
+	kept := leakKills[conn.PID][:0]
+	for _, t := range leakKills[conn.PID] {
+		if now.Sub(t) < window {
+			kept = append(kept, t)
+		}
+	}
+	kept = append(kept, now)
+	leakKills[conn.PID] = kept
+	if len(kept) < restartThreshold {
+		leakMu.Unlock()
+		return
+	}
+
+	unit := processUnit(conn.PID)
+	target := cmp.Or(unit, conn.Process)
+	if last, ok := lastRestarts[target]; ok && now.Sub(last) < minutes(restartCooldownMin) {
+		leakMu.Unlock()
+		return
+	}
+	lastRestarts[target] = now
+	delete(leakKills, conn.PID)
+	leakMu.Unlock()
+
+	restartLeaking(conn, unit, len(kept))
+}
+
+// restartLeaking runs -restart-cmd for the process owning conn
+func restartLeaking(conn *ConnectionInfo, unit string, kills int) {
+	if unit == "" && strings.Contains(restartCmd, "{unit}") {
+		log.Printf("Process %s (pid %d) leaked %d sockets in %s but runs in no systemd unit, not restarting", conn.Process, conn.PID, kills, humanMinutes(restartWindowMin))
+		return
+	}
+	replacer := strings.NewReplacer("{unit}", unit, "{pid}", strconv.Itoa(conn.PID), "{process}", conn.Process)
+	args := strings.Fields(restartCmd)
+	for i, arg := range args {
+		args[i] = replacer.Replace(arg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), restartTimeout)
+	defer cancel()
+	if out, err := runner.Run(ctx, args[0], args[1:]...); err != nil {
+		log.Printf("Error restarting %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+		return
+	}
+	msg := fmt.Sprintf("%s (pid %d) had %d sockets killed within %s, ran: %s", conn.Process, conn.PID, kills, humanMinutes(restartWindowMin), strings.Join(args, " "))
+	alertf(" ! Restarted leaking service: %s\n", msg)
+	emitEvent(connEvent(EventRestart, conn, msg))
+}
+
+// processUnit returns the systemd service pid runs in, from /proc/<pid>/cgroup
+// (e.g. "0::/system.slice/nginx.service"), or "" outside of one
+func processUnit(pid int) string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		dirs := strings.Split(parts[2], "/")
+		for i := len(dirs) - 1; i >= 0; i-- {
+			if strings.HasSuffix(dirs[i], ".service") {
+				return dirs[i]
+			}
+		}
+	}
+	return ""
+}
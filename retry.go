@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+var killRetries int
+
+func init() {
+	flag.IntVar(&killRetries, "kill-retries", 3, "Failed kill attempts per backend before escalating to the other backend, then giving up with an alert")
+}
+
+// backendFor returns the kill backend to use for the next attempt on conn: the
+// configured one, or the alternate once killRetries attempts have failed
+func backendFor(conn *ConnectionInfo) string {
+	if conn.KillFailures < killRetries || !destroySupported() {
+		return killMethod
+	}
+	if killMethod == "ss" {
+		return "fd"
+	}
+	return "ss"
+}
+
+// recordKillFailure keeps a connection whose kill failed in the tracker and
+// schedules the next attempt with exponential backoff (one, two, four... check
+// intervals). It returns true once both backends are exhausted and the kill is
+// abandoned. Must be called with mu held.
+func recordKillFailure(conn *ConnectionInfo, reason KillReason, now time.Time) bool {
+	conn.KillFailures++
+	conn.PendingReason = reason
+
+	if conn.KillFailures >= 2*killRetries {
+		conn.setState(StateKillAbandoned, now)
+		return true
+	}
+	conn.setState(StateKillRetry, now)
+
+	attemptOnBackend := (conn.KillFailures-1)%killRetries + 1
+	backoff := minutes(checkIntervalMin) << (attemptOnBackend - 1)
+	conn.NextKillAttempt = now.Add(backoff)
+
+	alertf(" ! Kill failed (attempt %d of %d, Inode %s), retrying in %s via %s\n",
+		conn.KillFailures, 2*killRetries, conn.Inode, humanDuration(backoff), backendFor(conn))
+	return false
+}
+
+// closingStates are TCP states a socket passes through after a successful
+// shutdown; seeing one of them still counts as a confirmed kill
+var closingStates = map[string]bool{
+	"FIN-WAIT-1": true,
+	"FIN-WAIT-2": true,
+	"CLOSING":    true,
+	"LAST-ACK":   true,
+	"TIME-WAIT":  true,
+	"CLOSED":     true,
+}
+
+// confirmKill checks a KILL_PENDING connection against the latest listing: gone
+// (or closing) confirms the kill and drops the entry as KILLED, still established
+// counts as a failed attempt. Must be called with mu held.
+func confirmKill(conn *ConnectionInfo, listed bool, now time.Time) {
+	// KillFailures only grows below, so backendFor still names the backend that made this kill
+	observeConfirmation(backendFor(conn), !listed || closingStates[conn.TCPState])
+	if !listed || closingStates[conn.TCPState] {
+		conn.setState(StateKilled, now)
+		detail := "gone from listing"
+		if listed {
+			detail = "closing (" + conn.TCPState + ")"
+		}
+		reportConn(rowConfirmed, conn, detail, " . Kill confirmed (Inode %s): %s\n", conn.Inode, conn.ConnectionID)
+		forgetCanary(conn)
+		delete(connections, conn.key())
+		return
+	}
+
+	err := fmt.Errorf("connection still %s after kill", conn.TCPState)
+	ev := connEvent(EventKillFailed, conn, err.Error())
+	ev.Reason = conn.PendingReason.Code
+	emitEvent(ev)
+
+	if recordKillFailure(conn, conn.PendingReason, now) {
+		reportAbandoned(conn, err)
+	}
+}
+
+// reportAbandoned announces that a connection could not be killed by any backend
+func reportAbandoned(conn *ConnectionInfo, cause error) {
+	alertf(" ! Giving up on killing connection after %d attempts (Inode %s): %s\n", conn.KillFailures, conn.Inode, conn.ConnectionID)
+	ev := connEvent(EventKillAbandoned, conn, fmt.Sprintf("all kill backends failed after %d attempts: %v", conn.KillFailures, cause))
+	ev.Reason = conn.PendingReason.Code
+	emitEvent(ev)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ProcessStats counts the tracked connections of one owning process. With a
+// SO_REUSEPORT listener group each process accepts its own share of the
+// port, and these are the shares.
+type ProcessStats struct {
+	Process string    `json:"process"`
+	PID     int       `json:"pid"`
+	Tracked int       `json:"tracked"`
+	Oldest  time.Time `json:"oldest_added,omitzero"`
+}
+
+// listenerGroups returns the owners ("name/pid") of the sockets listening on
+// the monitored ports, by listening address. More than one on an address is
+// a SO_REUSEPORT group, whose connections ss attributes to the process that
+// accepted them.
+func listenerGroups() (map[string][]string, error) {
+	if protocol != "tcp" && protocol != "sctp" {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	argv := ssCommand("", append([]string{protocolFlag() + "lnpH"}, portFilter()...)...)
+	out, err := runner.Run(ctx, argv[0], argv[1:]...)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	groups := make(map[string][]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		owner := "unknown"
+		if process, pid, _, ok := parseUsers(scanner.Text()); ok {
+			owner = fmt.Sprintf("%s/%d", process, pid)
+		}
+		groups[fields[3]] = append(groups[fields[3]], owner)
+	}
+	return groups, nil
+}
+
+// reportListenerGroup announces a SO_REUSEPORT group on the monitored port
+func reportListenerGroup() {
+	if remoteMode() || allNetns {
+		return
+	}
+	groups, err := listenerGroups()
+	if err != nil {
+		log.Printf("Warning: could not list the listeners on port %s: %v", sourcePort, err)
+		return
+	}
+	for addr, owners := range groups {
+		if len(owners) > 1 {
+			infof("Listener Group (SO_REUSEPORT) on %s: %d sockets: %s\n", addr, len(owners), strings.Join(owners, ", "))
+		}
+	}
+}
+
+// snapshotProcesses groups the tracked connections by owning process
+func snapshotProcesses() []ProcessStats {
+	mu.Lock()
+	defer mu.Unlock()
+	byPID := make(map[int]*ProcessStats)
+	for _, conn := range connections {
+		p, ok := byPID[conn.PID]
+		if !ok {
+			p = &ProcessStats{Process: conn.Process, PID: conn.PID}
+			byPID[conn.PID] = p
+		}
+		p.Tracked++
+		if p.Oldest.IsZero() || conn.TimeAdded.Before(p.Oldest) {
+			p.Oldest = conn.TimeAdded
+		}
+	}
+	out := make([]ProcessStats, 0, len(byPID))
+	for _, p := range byPID {
+		out = append(out, *p)
+	}
+	return out
+}
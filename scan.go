@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+)
+
+var scanMinPeers int
+
+func init() {
+	flag.IntVar(&scanMinPeers, "scan-peers", 0, "Report a probable port scan when at least this many distinct peers each had a single connection seen in only one listing (0 disables)")
+}
+
+// scanPeerListMax bounds the peers quoted in the alert line; the event carries all of them
+const scanPeerListMax = 10
+
+// detectScan looks for the footprint of a scan: many peers that each opened
+// exactly one connection, seen in a single listing and gone by this one. It
+// returns those peers, sorted, when there are at least -scan-peers of them.
+// Must be called with mu held, after unseen connections are marked missing.
+func detectScan(now time.Time) []string {
+	if scanMinPeers <= 0 {
+		return nil
+	}
+
+	// Connections per peer IP, and how many of them were one-off
+	type peerKey struct {
+		host string
+		ip   netip.Addr
+	}
+	total := make(map[peerKey]int)
+	oneOff := make(map[peerKey]int)
+	for _, conn := range connections {
+		ip, ok := peerAddr(conn)
+		if !ok {
+			continue
+		}
+		key := peerKey{conn.origin(), ip}
+		total[key]++
+		if conn.State == StateMissing && conn.StateSince.Equal(now) && conn.TimeAdded.Equal(conn.LastSeen) {
+			oneOff[key]++
+		}
+	}
+
+	var keys []peerKey
+	for key, n := range oneOff {
+		if n == 1 && total[key] == 1 {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) < scanMinPeers {
+		return nil
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].host != keys[j].host {
+			return keys[i].host < keys[j].host
+		}
+		return keys[i].ip.Less(keys[j].ip)
+	})
+	peers := make([]string, len(keys))
+	for i, key := range keys {
+		peers[i] = key.ip.String()
+		if key.host != "" {
+			peers[i] = key.host + ": " + peers[i]
+		}
+	}
+
+	msg := fmt.Sprintf("%d peers each opened a single short-lived connection", len(peers))
+	shown := peers
+	if len(shown) > scanPeerListMax {
+		shown = shown[:scanPeerListMax]
+	}
+	alertf(" ! Probable port scan on port %s: %s (%s%s)\n", sourcePort, msg, strings.Join(shown, ", "), more(len(peers)-len(shown)))
+	emitEvent(Event{Type: EventScan, Message: msg, Peers: peers})
+	return peers
+}
+
+// more formats the count of items left out of a list
+func more(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" and %d more", n)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Policy holds the thresholds applied to a connection; zero disables a limit
+type Policy struct {
+	MaxActive     int // minutes
+	MaxPersist    int // minutes
+	MaxZeroWindow int // minutes
+	MaxTransfer   int // MB
+	MaxThroughput int // KB/s
+}
+
+// policyScope overrides the global thresholds for connections to one local
+// address or prefix, to one local port under -all-ports, or for those owned
+// by one process (by name or pid), as when several processes share the port
+// through SO_REUSEPORT
+type policyScope struct {
+	prefix  netip.Prefix
+	port    int
+	process string
+	pid     int
+	policy  Policy
+	set     map[string]bool // keys given explicitly; the rest fall back to the global flags
+}
+
+// scopeList is the -scope flag: "<local-ip|cidr|port:N|process:NAME|pid:N>,key=value[,key=value]", repeatable
+type scopeList []policyScope
+
+var scopes scopeList
+
+func init() {
+	flag.Var(&scopes, "scope", "Per local address or owning process thresholds, e.g. '192.0.2.10,max-active=30,max-persist=5' or 'process:nginx,max-active=10' (repeatable; selectors: address, prefix, port:N, process:NAME, pid:N; keys: max-active, max-persist, max-zero-window, max-transfer, max-throughput)")
+}
+
+func (s *scopeList) String() string {
+	var parts []string
+	for _, sc := range *s {
+		parts = append(parts, sc.label())
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s *scopeList) Set(value string) error {
+	parts := strings.Split(value, ",")
+	sc := policyScope{set: make(map[string]bool)}
+	if name, ok := strings.CutPrefix(parts[0], "process:"); ok && name != "" {
+		sc.process = name
+	} else if raw, ok := strings.CutPrefix(parts[0], "pid:"); ok {
+		pid, err := strconv.Atoi(raw)
+		if err != nil || pid <= 0 {
+			return fmt.Errorf("invalid scope pid %q", raw)
+		}
+		sc.pid = pid
+	} else if raw, ok := strings.CutPrefix(parts[0], "port:"); ok {
+		port, err := strconv.Atoi(raw)
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("invalid scope port %q", raw)
+		}
+		sc.port = port
+	} else {
+		prefix, err := netip.ParsePrefix(parts[0])
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(parts[0])
+			if addrErr != nil {
+				return fmt.Errorf("invalid scope address %q", parts[0])
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		sc.prefix = prefix.Masked()
+	}
+
+	if err := sc.parseSettings(parts[1:]); err != nil {
+		return err
+	}
+	if len(sc.set) == 0 {
+		return fmt.Errorf("scope %q sets no threshold", value)
+	}
+	*s = append(*s, sc)
+	return nil
+}
+
+// parseSettings reads "key=value" thresholds into the scope
+func (sc *policyScope) parseSettings(settings []string) error {
+	for _, kv := range settings {
+		key, raw, ok := strings.Cut(kv, "=")
+		parse := strconv.Atoi
+		if key == "max-active" || key == "max-persist" || key == "max-zero-window" {
+			parse = parseMinutes
+		}
+		n, err := parse(raw)
+		if !ok || err != nil || n < 0 {
+			return fmt.Errorf("invalid scope setting %q: want key=<non-negative integer or duration>", kv)
+		}
+		switch key {
+		case "max-active":
+			sc.policy.MaxActive = n
+		case "max-persist":
+			sc.policy.MaxPersist = n
+		case "max-zero-window":
+			sc.policy.MaxZeroWindow = n
+		case "max-transfer":
+			sc.policy.MaxTransfer = n
+		case "max-throughput":
+			sc.policy.MaxThroughput = n
+		default:
+			return fmt.Errorf("unknown scope setting %q", key)
+		}
+		sc.set[key] = true
+	}
+	return nil
+}
+
+// label names what the scope selects, as given on the command line
+func (sc policyScope) label() string {
+	switch {
+	case sc.process != "":
+		return "process:" + sc.process
+	case sc.pid > 0:
+		return "pid:" + strconv.Itoa(sc.pid)
+	case sc.port > 0:
+		return "port:" + strconv.Itoa(sc.port)
+	}
+	return sc.prefix.String()
+}
+
+// matches reports whether the scope selects conn, whose local IP is ip when ipOK
+func (sc policyScope) matches(conn *ConnectionInfo, ip netip.Addr, ipOK bool) bool {
+	switch {
+	case sc.process != "":
+		return conn.Process == sc.process
+	case sc.pid > 0:
+		return conn.PID == sc.pid
+	case sc.port > 0:
+		_, port, err := net.SplitHostPort(conn.LocalAddr)
+		return err == nil && port == strconv.Itoa(sc.port)
+	}
+	return ipOK && sc.prefix.Contains(ip)
+}
+
+// example returns a connection the scope selects, for showing its thresholds
+func (sc policyScope) example() *ConnectionInfo {
+	if sc.process != "" || sc.pid > 0 {
+		return &ConnectionInfo{Process: sc.process, PID: sc.pid}
+	}
+	if sc.port > 0 {
+		return &ConnectionInfo{LocalAddr: net.JoinHostPort("0.0.0.0", strconv.Itoa(sc.port))}
+	}
+	return &ConnectionInfo{LocalAddr: net.JoinHostPort(sc.prefix.Addr().String(), monitoredPorts()[0])}
+}
+
+// localIP extracts the IP of an ss local address such as 192.0.2.10:50090 or [::ffff:192.0.2.10]:50090
+func localIP(localAddr string) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(localAddr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	host, _, _ = strings.Cut(host, "%") // link-local zone or interface suffix
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// policyFor returns the thresholds for a connection: those of the first scope
+// matching it (by local address, port or owner), falling back to the global flags. maxActive is
+// the global max-active of this cycle, which already reflects host pressure;
+// under pressure a scoped max-active is tightened to -pressure-max-active too.
+func policyFor(conn *ConnectionInfo, maxActive int) Policy {
+	global := Policy{
+		MaxActive:     maxActive,
+		MaxPersist:    maxPersistMin,
+		MaxZeroWindow: maxZeroWindowMin,
+		MaxTransfer:   maxTransferMB,
+		MaxThroughput: maxThroughputKBps,
+	}
+	p := global
+	ip, ipOK := localIP(conn.LocalAddr)
+	for _, sc := range scopes {
+		if sc.matches(conn, ip, ipOK) {
+			p = sc.overlay(global)
+			break
+		}
+	}
+	if lowReputation(conn) {
+		p.MaxActive = min(p.MaxActive, reputationMaxActiveMin)
+	}
+	return p
+}
+
+// overlay returns p with the thresholds the scope sets explicitly
+func (sc policyScope) overlay(p Policy) Policy {
+	if sc.set["max-active"] {
+		p.MaxActive = tightenMaxActive(sc.policy.MaxActive)
+	}
+	if sc.set["max-persist"] {
+		p.MaxPersist = sc.policy.MaxPersist
+	}
+	if sc.set["max-zero-window"] {
+		p.MaxZeroWindow = sc.policy.MaxZeroWindow
+	}
+	if sc.set["max-transfer"] {
+		p.MaxTransfer = sc.policy.MaxTransfer
+	}
+	if sc.set["max-throughput"] {
+		p.MaxThroughput = sc.policy.MaxThroughput
+	}
+	return p
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "time"
+
+// selfUsage is only implemented on Linux
+func selfUsage() (rss int64, cpu time.Duration) {
+	return 0, 0
+}
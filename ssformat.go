@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSSColumns bounds the column indexes a detected layout may use
+const maxSSColumns = 10
+
+// ssProbeTimeout bounds the startup probe of one ss installation
+const ssProbeTimeout = 30 * time.Second
+
+// ssFormat is the output layout of one ss installation, detected at startup
+type ssFormat struct {
+	Version  string // as printed by 'ss -V', e.g. "iproute2-6.1.0"
+	NoHeader bool   // -H is supported; otherwise the header line is skipped while parsing
+	StateCol int    // -1 when ss omits the column, as for connected UDP sockets
+	LocalCol int
+	PeerCol  int
+}
+
+var (
+	ssFormats   = make(map[string]*ssFormat) // by host, "" for this machine
+	ssFormatsMu sync.Mutex
+)
+
+func (f *ssFormat) String() string {
+	header := "-H"
+	if !f.NoHeader {
+		header = "header skipped"
+	}
+	return fmt.Sprintf("%s (%s, state column %d, local %d, peer %d)", f.Version, header, f.StateCol, f.LocalCol, f.PeerCol)
+}
+
+// minFields is the number of columns a socket line needs
+func (f *ssFormat) minFields() int {
+	return max(f.StateCol, f.LocalCol, f.PeerCol) + 1
+}
+
+// parseHeader locates the columns in an ss header line such as
+// "State Recv-Q Send-Q Local Address:Port Peer Address:Port Process".
+// Some releases glue "Process" onto the peer heading.
+func (f *ssFormat) parseHeader(header string) error {
+	f.StateCol, f.LocalCol, f.PeerCol = -1, -1, -1
+	col := 0
+	for _, tok := range strings.Fields(header) {
+		if strings.HasPrefix(tok, "Address:") {
+			continue // second word of "Local Address:Port"
+		}
+		switch tok {
+		case "State":
+			f.StateCol = col
+		case "Local":
+			f.LocalCol = col
+		case "Peer":
+			f.PeerCol = col
+		}
+		col++
+	}
+	if f.LocalCol < 0 || f.PeerCol < 0 {
+		return errors.New("expected Local Address:Port and Peer Address:Port columns")
+	}
+	if f.minFields() > maxSSColumns {
+		return fmt.Errorf("address columns past column %d", maxSSColumns)
+	}
+	return nil
+}
+
+// probeSSFormat detects the version and column layout of ss on host
+func probeSSFormat(host string) (*ssFormat, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ssProbeTimeout)
+	defer cancel()
+
+	argv := ssCommand(host, "-V")
+	out, err := runner.Run(ctx, argv[0], argv[1:]...)
+	if err != nil {
+		return nil, fmt.Errorf("ss -V: %w", err)
+	}
+	f := &ssFormat{Version: "unknown version"}
+	for _, tok := range strings.Fields(string(out)) {
+		if strings.HasPrefix(tok, "iproute2-") {
+			f.Version = tok
+		}
+	}
+
+	// The header names the columns even when no socket matches
+	argv = ssCommand(host, append([]string{protocolFlag() + "n"}, listFilter()...)...)
+	out, err = runner.Output(ctx, argv[0], argv[1:]...)
+	if err != nil {
+		return nil, fmt.Errorf("ss test listing (%s): %w", f.Version, err)
+	}
+	header, _, _ := strings.Cut(string(out), "\n")
+	if err := f.parseHeader(header); err != nil {
+		return nil, fmt.Errorf("unrecognized ss output format (%s, header %q): %w", f.Version, header, err)
+	}
+
+	// Old releases reject -H, or print the header regardless
+	argv = ssCommand(host, append([]string{protocolFlag() + "nH"}, listFilter()...)...)
+	out, err = runner.Output(ctx, argv[0], argv[1:]...)
+	f.NoHeader = err == nil && !strings.HasPrefix(string(out), header)
+	return f, nil
+}
+
+// ssFormatFor returns the layout of ss on host, probing it on first use
+func ssFormatFor(host string) (*ssFormat, error) {
+	ssFormatsMu.Lock()
+	f, ok := ssFormats[host]
+	ssFormatsMu.Unlock()
+	if ok {
+		return f, nil
+	}
+
+	f, err := probeSSFormat(host)
+	if err != nil {
+		return nil, err
+	}
+	ssFormatsMu.Lock()
+	ssFormats[host] = f
+	ssFormatsMu.Unlock()
+	return f, nil
+}
+
+// setupSSFormat probes the local ss, or every -remote host, before the first
+// cycle. An unusable local ss is fatal; a remote host that can't be probed
+// yet is probed again on its first listing.
+func setupSSFormat() error {
+	if !remoteMode() {
+		f, err := ssFormatFor("")
+		if err != nil {
+			return err
+		}
+		verbosef("ss: %s\n", f)
+		return nil
+	}
+
+	for _, host := range splitList(remoteHosts) {
+		f, err := ssFormatFor(host)
+		if err != nil {
+			log.Printf("Warning: could not probe ss on %s, retrying on first listing: %v", host, err)
+			continue
+		}
+		verbosef("ss on %s: %s\n", host, f)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"time"
+)
+
+var warnBeforeMin int
+
+func init() {
+	minutesVar(&warnBeforeMin, "warn-before", 10, "Minutes before max-active at which a connection enters the WARNED state and a warning event is emitted (0 disables)")
+}
+
+// ConnState is the lifecycle state of a tracked connection
+type ConnState string
+
+const (
+	StateNew           ConnState = "NEW"            // first seen in the latest listing
+	StateActive        ConnState = "ACTIVE"         // seen in at least two listings
+	StateWarned        ConnState = "WARNED"         // close to the max-active limit
+	StateMissing       ConnState = "MISSING"        // absent from the latest listing, waiting to expire
+	StateKillPending   ConnState = "KILL_PENDING"   // kill command succeeded, awaiting confirmation
+	StateKillRetry     ConnState = "KILL_RETRY"     // kill failed, next attempt scheduled
+	StateKillAbandoned ConnState = "KILL_ABANDONED" // every kill backend failed; tracked but left alone
+	StateKilled        ConnState = "KILLED"         // kill confirmed (terminal)
+	StateExpired       ConnState = "EXPIRED"        // removed after being missing too long (terminal)
+)
+
+// maxTransitions bounds the history kept per connection
+const maxTransitions = 16
+
+// StateChange records when a connection entered a state
+type StateChange struct {
+	State ConnState `json:"state"`
+	At    time.Time `json:"at"`
+}
+
+// setState moves the connection to a new state, recording the transition time
+func (c *ConnectionInfo) setState(state ConnState, at time.Time) {
+	if c.State == state {
+		return
+	}
+	c.State = state
+	c.StateSince = at
+	c.Transitions = append(c.Transitions, StateChange{State: state, At: at})
+	if len(c.Transitions) > maxTransitions {
+		c.Transitions = c.Transitions[len(c.Transitions)-maxTransitions:]
+	}
+}
+
+// Alive reports whether the connection was present in the latest listing and is
+// not already being killed, i.e. whether kill policies apply to it
+func (c *ConnectionInfo) Alive() bool {
+	return c.State == StateNew || c.State == StateActive || c.State == StateWarned
+}
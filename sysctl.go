@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// sysctlDir holds the TCP sysctls the advisor reads and writes
+const sysctlDir = "/proc/sys/net/ipv4/"
+
+// sysctlAdvice is one recommended sysctl change and the evidence behind it
+type sysctlAdvice struct {
+	name     string
+	current  int
+	proposed int
+	why      string
+}
+
+// runSysctlAdvisor implements 'sysctl': it reads the TCP sysctls that decide
+// how long the kernel keeps a dead connection (tcp_keepalive_time,
+// tcp_retries2, tcp_fin_timeout), lists the monitored port once to see
+// which of them matter here, and suggests values. With -apply -yes the
+// suggestions are written to /proc/sys; they don't survive a reboot.
+func runSysctlAdvisor(args []string) error {
+	fs := oneShotFlags("sysctl")
+	apply := fs.Bool("apply", false, "Write the suggested values (needs -yes)")
+	yes := fs.Bool("yes", false, "Confirm -apply")
+	if err := prepareOneShot(fs, args, false); err != nil {
+		return err
+	}
+	if protocol != "tcp" || remoteMode() || allNetns {
+		return fmt.Errorf("the sysctl advisor only covers local TCP (no -protocol, -remote or -all-netns)")
+	}
+
+	values := make(map[string]int)
+	for _, name := range []string{"tcp_keepalive_time", "tcp_keepalive_intvl", "tcp_keepalive_probes", "tcp_retries2", "tcp_fin_timeout"} {
+		n, err := readSysctl(name)
+		if err != nil {
+			return err
+		}
+		values[name] = n
+		fmt.Printf("%s = %d\n", name, n)
+	}
+
+	conns, _, err := listCurrentConnections(context.Background())
+	if err != nil {
+		return err
+	}
+	var keepalive, retransmitting, finWait2 int
+	for _, conn := range conns {
+		switch {
+		case conn.Timer == "keepalive":
+			keepalive++
+		case conn.Timer == "on" && conn.TimerRetrans >= 3:
+			retransmitting++
+		}
+		if conn.TCPState == "FIN-WAIT-2" {
+			finWait2++
+		}
+	}
+	fmt.Printf("Port %s: %d connections, %d with keepalive, %d retransmitting to a silent peer, %d in FIN-WAIT-2\n",
+		sourcePort, len(conns), keepalive, retransmitting, finWait2)
+
+	advice := adviseSysctls(values, keepalive, retransmitting, finWait2)
+	if len(advice) == 0 {
+		fmt.Println("No changes suggested")
+		return nil
+	}
+	for _, a := range advice {
+		fmt.Printf("Suggest %s %d -> %d: %s\n", a.name, a.current, a.proposed, a.why)
+	}
+
+	if !*apply {
+		fmt.Println("Run with -apply -yes to write these values")
+		return nil
+	}
+	if !*yes {
+		return fmt.Errorf("-apply changes kernel settings for the whole host; add -yes to confirm")
+	}
+	for _, a := range advice {
+		if err := os.WriteFile(sysctlDir+a.name, []byte(strconv.Itoa(a.proposed)+"\n"), 0o644); err != nil {
+			return fmt.Errorf("writing %s: %w", a.name, err)
+		}
+		fmt.Printf("Set %s = %d\n", a.name, a.proposed)
+	}
+	fmt.Println("Add these to /etc/sysctl.d/ to keep them after a reboot")
+	return nil
+}
+
+// adviseSysctls turns the sysctl values and what the listing shows into
+// suggestions. A setting is only touched when the port shows the symptom it
+// governs, so a quiet host gets no advice.
+func adviseSysctls(values map[string]int, keepalive, retransmitting, finWait2 int) []sysctlAdvice {
+	var advice []sysctlAdvice
+
+	// Keepalive should notice a dead peer before -max-active reaps it
+	detect := values["tcp_keepalive_time"] + values["tcp_keepalive_intvl"]*values["tcp_keepalive_probes"]
+	if keepalive > 0 && detect > maxActiveDurMin*60 {
+		proposed := max(60, maxActiveDurMin*60/2)
+		if proposed < values["tcp_keepalive_time"] {
+			advice = append(advice, sysctlAdvice{"tcp_keepalive_time", values["tcp_keepalive_time"], proposed,
+				fmt.Sprintf("%d connections use keepalive, but a dead peer is only noticed after %ds, beyond -max-active (%s)", keepalive, detect, humanMinutes(maxActiveDurMin))})
+		}
+	}
+
+	// 15 retries keep retransmitting to a vanished peer for about 15 minutes; 8 give up after about 100s
+	if retransmitting > 0 && values["tcp_retries2"] > 8 {
+		advice = append(advice, sysctlAdvice{"tcp_retries2", values["tcp_retries2"], 8,
+			fmt.Sprintf("%d connections are retransmitting to a silent peer, and %d retries take many minutes to give up", retransmitting, values["tcp_retries2"])})
+	}
+
+	if finWait2 > 0 && values["tcp_fin_timeout"] > 30 {
+		advice = append(advice, sysctlAdvice{"tcp_fin_timeout", values["tcp_fin_timeout"], 30,
+			fmt.Sprintf("%d connections wait in FIN-WAIT-2 for a peer that may never close", finWait2)})
+	}
+	return advice
+}
+
+// readSysctl reads an integer sysctl of net.ipv4
+func readSysctl(name string) (int, error) {
+	data, err := os.ReadFile(sysctlDir + name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var colorMode string
+
+func init() {
+	flag.StringVar(&colorMode, "color", "auto", "Render cycles as colored tables: 'auto' (when stdout is a terminal), 'always' or 'never'")
+}
+
+// prettyOutput is set at startup when cycles are rendered as tables
+var prettyOutput bool
+
+// setupPrettyOutput decides between tables and plain lines. Must run after
+// setupLogFile, which may redirect stdout away from the terminal, and
+// setupOutputFormat, as JSON output never renders tables.
+func setupPrettyOutput() error {
+	switch colorMode {
+	case "always":
+		prettyOutput = !jsonOutput
+	case "never":
+		prettyOutput = false
+	case "auto":
+		info, err := os.Stdout.Stat()
+		prettyOutput = err == nil && info.Mode()&os.ModeCharDevice != 0 && !jsonOutput &&
+			os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+	default:
+		return fmt.Errorf("invalid -color %q: must be 'auto', 'always' or 'never'", colorMode)
+	}
+	return nil
+}
+
+// rowKind is the action shown in a cycle table row
+type rowKind int
+
+const (
+	rowNew rowKind = iota
+	rowWarned
+	rowPinned
+	rowWouldKill
+	rowKilled
+	rowKillFailed
+	rowConfirmed
+	rowExpired
+)
+
+var rowStyles = map[rowKind]struct {
+	label  string
+	color  string
+	always bool // shown even with -quiet
+}{
+	rowNew:        {"new", "\033[32m", false},
+	rowWarned:     {"warned", "\033[33m", false},
+	rowPinned:     {"pinned", "\033[36m", false},
+	rowWouldKill:  {"would kill", "\033[35m", true},
+	rowKilled:     {"killed", "\033[31m", true},
+	rowKillFailed: {"kill failed", "\033[1;31m", true},
+	rowConfirmed:  {"confirmed", "\033[90m", false},
+	rowExpired:    {"expired", "\033[90m", false},
+}
+
+const colorReset = "\033[0m"
+
+type cycleRow struct {
+	kind                     rowKind
+	inode, conn, age, detail string
+}
+
+// cycleRows collects the table of the running cycle; only the monitor loop touches it
+var cycleRows []cycleRow
+
+// reportConn prints a connection action as a plain line, or queues it as a table
+// row when rendering tables
+func reportConn(kind rowKind, conn *ConnectionInfo, detail string, format string, args ...any) {
+	if prettyOutput {
+		tableRow(kind, conn, detail)
+		return
+	}
+	if rowStyles[kind].always {
+		alertf(format, args...)
+	} else {
+		infof(format, args...)
+	}
+}
+
+// tableRow queues a table row; it is a no-op for plain output
+func tableRow(kind rowKind, conn *ConnectionInfo, detail string) {
+	if !prettyOutput || (quietOutput && !rowStyles[kind].always) {
+		return
+	}
+	cycleRows = append(cycleRows, cycleRow{
+		kind:   kind,
+		inode:  conn.Inode,
+		conn:   conn.ConnectionID,
+		age:    humanDuration(clock.Now().Sub(conn.TimeAdded)),
+		detail: detail,
+	})
+}
+
+// plainf prints a line only for plain output, where tables replace it otherwise
+func plainf(format string, args ...any) {
+	if !prettyOutput {
+		alertf(format, args...)
+	}
+}
+
+// printCycleHeader announces a cycle
+func printCycleHeader(start time.Time) {
+	if prettyOutput {
+		infof("\n\033[1m--- %s ---%s\n", formatTime(start), colorReset)
+		return
+	}
+	infof("\n--- Executing monitoring cycle: %s ---\n", formatTime(start))
+}
+
+// printCycleSummary ends a cycle with the tracked count, preceded by the cycle
+// table when rendering tables
+func printCycleSummary(tracked, pinned, scanPeers int) {
+	scan := ""
+	if scanPeers > 0 {
+		scan = fmt.Sprintf(", probable port scan from %d peers", scanPeers)
+	}
+	if !prettyOutput {
+		infof("Total tracked connections: %d (pinned: %d)%s\n", tracked, pinned, scan)
+		return
+	}
+
+	rows := cycleRows
+	cycleRows = nil
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].kind < rows[j].kind })
+	if len(rows) > 0 {
+		header := []string{"ACTION", "INODE", "CONNECTION", "AGE", "DETAIL"}
+		widths := make([]int, len(header))
+		cells := make([][]string, len(rows))
+		for i, r := range rows {
+			cells[i] = []string{rowStyles[r.kind].label, r.inode, r.conn, r.age, r.detail}
+		}
+		for _, line := range append([][]string{header}, cells...) {
+			for c, cell := range line {
+				widths[c] = max(widths[c], utf8.RuneCountInString(cell))
+			}
+		}
+		fmt.Printf("\033[1m%s%s\n", alignRow(header, widths), colorReset)
+		for i, r := range rows {
+			fmt.Printf("%s%s%s\n", rowStyles[r.kind].color, alignRow(cells[i], widths), colorReset)
+		}
+	}
+	infof("Tracked: %d (pinned: %d)%s\n", tracked, pinned, scan)
+}
+
+// alignRow pads every cell but the last to its column width
+func alignRow(cells []string, widths []int) string {
+	var b strings.Builder
+	for c, cell := range cells {
+		b.WriteString(cell)
+		if c < len(cells)-1 {
+			b.WriteString(strings.Repeat(" ", widths[c]-utf8.RuneCountInString(cell)+2))
+		}
+	}
+	return strings.TrimRight(b.String(), " ")
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"time"
+)
+
+var (
+	parseChunk   int
+	parsePauseMs int
+)
+
+func init() {
+	flag.IntVar(&parseChunk, "parse-chunk", 0, "Parse the ss listing in chunks of this many lines, pausing -parse-pause between chunks to spread CPU use (0 parses in one go)")
+	flag.IntVar(&parsePauseMs, "parse-pause", 10, "Pause between parse chunks, in milliseconds")
+}
+
+// parseThrottle pauses after every -parse-chunk lines
+type parseThrottle struct {
+	lines int
+}
+
+// tick counts one parsed line and sleeps at the end of a chunk
+func (t *parseThrottle) tick() {
+	if parseChunk <= 0 {
+		return
+	}
+	t.lines++
+	if t.lines%parseChunk == 0 {
+		time.Sleep(time.Duration(parsePauseMs) * time.Millisecond)
+	}
+}
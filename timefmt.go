@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	timestampFormat string
+	timezone        string
+)
+
+func init() {
+	flag.StringVar(&timestampFormat, "timestamp-format", "rfc1123", "Timestamp format of human output and log lines: rfc1123, rfc3339, datetime, or a Go layout such as '2006-01-02 15:04:05'")
+	flag.StringVar(&timezone, "timezone", "Local", "Time zone of human output and log lines: Local, UTC or a name such as Europe/Berlin. Machine-readable output is always UTC")
+}
+
+// timestampLayouts are the named -timestamp-format values
+var timestampLayouts = map[string]string{
+	"rfc1123":  time.RFC1123,
+	"rfc3339":  time.RFC3339,
+	"datetime": time.DateTime,
+}
+
+var (
+	displayLayout   = time.RFC1123
+	displayLocation = time.Local
+)
+
+// formatTime formats t for human output
+func formatTime(t time.Time) string {
+	return t.In(displayLocation).Format(displayLayout)
+}
+
+// timestampWriter prefixes every log line with formatTime
+type timestampWriter struct {
+	w io.Writer
+}
+
+func (t timestampWriter) Write(p []byte) (int, error) {
+	if _, err := fmt.Fprintf(t.w, "%s %s", formatTime(clock.Now()), p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// setupTimeFormat applies -timestamp-format and -timezone. Log lines keep
+// the standard log prefix unless one of them is set.
+func setupTimeFormat() error {
+	if layout, ok := timestampLayouts[strings.ToLower(timestampFormat)]; ok {
+		displayLayout = layout
+	} else if strings.ContainsAny(timestampFormat, "0123456789") {
+		displayLayout = timestampFormat
+	} else {
+		return fmt.Errorf("unknown -timestamp-format %q", timestampFormat)
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return fmt.Errorf("-timezone: %w", err)
+	}
+	displayLocation = loc
+
+	if strings.ToLower(timestampFormat) != "rfc1123" || timezone != "Local" {
+		log.SetFlags(0)
+		log.SetOutput(timestampWriter{os.Stderr})
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The ss listing is tokenized in a single pass over each line. Every value
+// returned here is a substring of the line; parseSSRecord only copies the few
+// a connection keeps, so the line itself can be dropped once parsed.
+
+// isSpace reports whether b separates ss columns
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t'
+}
+
+// splitFields fills dst with the leading whitespace-separated fields of line
+// and returns how many were found
+func splitFields(line string, dst []string) int {
+	n := 0
+	for i := 0; i < len(line) && n < len(dst); {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		start := i
+		for i < len(line) && !isSpace(line[i]) {
+			i++
+		}
+		if i > start {
+			dst[n] = line[start:i]
+			n++
+		}
+	}
+	return n
+}
+
+// fieldValue returns the value of the "key:value" token starting with key
+// (e.g. "ino:"). Only whole tokens outside quoted process names match, so
+// "rtt:" does not find "minrtt:" and a process named "x ino:1" is no inode.
+func fieldValue(line, key string) (string, bool) {
+	for i := 0; ; {
+		j := strings.Index(line[i:], key)
+		if j < 0 {
+			return "", false
+		}
+		j += i
+		if (j == 0 || isSpace(line[j-1])) && strings.Count(line[:j], `"`)%2 == 0 {
+			v := line[j+len(key):]
+			for k := 0; k < len(v); k++ {
+				if isSpace(v[k]) {
+					return v[:k], true
+				}
+			}
+			return v, true
+		}
+		i = j + len(key)
+	}
+}
+
+// leadingDigits returns the decimal prefix of s
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+// fieldInt returns the integer value of key in line, or 0 when absent
+func fieldInt(line, key string) int64 {
+	v, ok := fieldValue(line, key)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(leadingDigits(v), 10, 64)
+	return n
+}
+
+// parseUsers extracts the first owner of 'users:(("name",pid=N,fd=N),...)'.
+// The process name is quoted and may contain spaces, so it is scanned by hand.
+func parseUsers(line string) (process string, pid, fd int, ok bool) {
+	i := strings.Index(line, `users:(("`)
+	if i < 0 {
+		return "", 0, 0, false
+	}
+	rest := line[i+len(`users:(("`):]
+	end := strings.IndexByte(rest, '"')
+	if end < 0 {
+		return "", 0, 0, false
+	}
+	process, rest = rest[:end], rest[end+1:]
+
+	rest, found := strings.CutPrefix(rest, ",pid=")
+	if !found {
+		return "", 0, 0, false
+	}
+	digits := leadingDigits(rest)
+	pid, _ = strconv.Atoi(digits)
+
+	rest, found = strings.CutPrefix(rest[len(digits):], ",fd=")
+	if !found {
+		return "", 0, 0, false
+	}
+	fd, _ = strconv.Atoi(leadingDigits(rest))
+	return process, pid, fd, true
+}
+
+// parseTimer splits 'timer:(name,expire,retrans)'
+func parseTimer(line string) (name, expire string, retrans int, ok bool) {
+	v, found := fieldValue(line, "timer:(")
+	if !found {
+		return "", "", 0, false
+	}
+	name, v, found = strings.Cut(v, ",")
+	if !found || name == "" {
+		return "", "", 0, false
+	}
+	expire, v, found = strings.Cut(v, ",")
+	if !found {
+		return "", "", 0, false
+	}
+	digits := leadingDigits(v)
+	if digits == "" {
+		return "", "", 0, false
+	}
+	retrans, _ = strconv.Atoi(digits)
+	return name, expire, retrans, true
+}
+
+var (
+	errNoInode       = errors.New("no inode")
+	errTooFewColumns = errors.New("too few columns")
+	errBadAddress    = errors.New("malformed address")
+)
+
+// validAddr reports whether s looks like the "host:port" ss prints. Anything
+// else would end up in a kill filter.
+func validAddr(s string) bool {
+	i := strings.LastIndexByte(s, ':')
+	if i <= 0 {
+		return false
+	}
+	port := s[i+1:]
+	return port != "" && leadingDigits(port) == port
+}
+
+// parseSSRecord fills c from one ss record (a socket line with its tcp_info
+// continuation joined) laid out as format. It only reads line, so it is safe
+// to feed arbitrary input; a record it can't attribute to a single socket is
+// rejected rather than guessed at.
+func parseSSRecord(line string, format *ssFormat, c *ConnectionInfo) error {
+	if protocol == "unix" {
+		if err := parseUnixRecord(line, format, c); err != nil {
+			return err
+		}
+		c.detach()
+		return nil
+	}
+
+	ino, _ := fieldValue(line, "ino:")
+	c.Inode = leadingDigits(ino)
+	if c.Inode == "" {
+		return errNoInode
+	}
+
+	// Columns as located in the header of this ss release
+	var fields [maxSSColumns]string
+	if n := splitFields(line, fields[:]); n < format.minFields() {
+		return fmt.Errorf("inode %s: %w (%d)", c.Inode, errTooFewColumns, n)
+	}
+	c.TCPState = "ESTAB" // the only state ss lists without a State column
+	if format.StateCol >= 0 {
+		c.TCPState = fields[format.StateCol]
+	}
+	c.LocalAddr = fields[format.LocalCol]
+	c.PeerAddr = fields[format.PeerCol]
+	if !validAddr(c.LocalAddr) || !validAddr(c.PeerAddr) {
+		return fmt.Errorf("inode %s: %w %q -> %q", c.Inode, errBadAddress, c.LocalAddr, c.PeerAddr)
+	}
+
+	// Owning process, as reported by 'ss -p' (first entry only)
+	c.PID, c.FD = -1, -1
+	if process, pid, fd, ok := parseUsers(line); ok {
+		c.Process, c.PID, c.FD = process, pid, fd
+	}
+
+	// Socket owner, as reported by 'ss -e', which leaves uid:0 out
+	c.UID = 0
+	if uid, ok := fieldValue(line, "uid:"); ok {
+		if digits := leadingDigits(uid); digits != "" {
+			c.UID, _ = strconv.Atoi(digits)
+		}
+	}
+
+	// Active timer, as reported by 'ss -o'
+	if name, expire, retrans, ok := parseTimer(line); ok {
+		c.Timer, c.TimerExpire, c.TimerRetrans = name, expire, retrans
+	}
+
+	// Cumulative byte and segment counters ('ss -i')
+	c.parseTraffic(line)
+	c.parseQuality(line)
+
+	// Peer's advertised receive window, from tcp_info ('ss -i', iproute2 >= 5.x)
+	c.SndWnd = -1
+	if wnd, ok := fieldValue(line, "snd_wnd:"); ok {
+		c.SndWnd, _ = strconv.Atoi(leadingDigits(wnd))
+	}
+	c.detach()
+	return nil
+}
+
+// ssWords are the states and timer names ss prints, shared rather than copied
+var ssWords = make(map[string]string)
+
+func init() {
+	for _, w := range []string{
+		"ESTAB", "SYN-SENT", "SYN-RECV", "FIN-WAIT-1", "FIN-WAIT-2", "TIME-WAIT",
+		"CLOSE-WAIT", "LAST-ACK", "CLOSING", "LISTEN", "UNCONN",
+		"on", "keepalive", "timewait", "persist", "unknown",
+	} {
+		ssWords[w] = w
+	}
+}
+
+// detach copies the strings c keeps out of the record they were sliced from,
+// so a tracked connection doesn't pin its whole ss line in memory. They are
+// copied in one piece, one allocation per record.
+func (c *ConnectionInfo) detach() {
+	kept := []*string{&c.Inode, &c.LocalAddr, &c.PeerAddr, &c.Process, &c.TimerExpire}
+	joined := c.Inode + c.LocalAddr + c.PeerAddr + c.Process + c.TimerExpire
+	for _, field := range kept {
+		n := len(*field)
+		*field, joined = joined[:n], joined[n:]
+	}
+	c.TCPState = internWord(c.TCPState)
+	c.Timer = internWord(c.Timer)
+}
+
+// internWord returns the shared copy of a known ss word, or a copy of s
+func internWord(s string) string {
+	if w, ok := ssWords[s]; ok {
+		return w
+	}
+	return strings.Clone(s)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var (
+	ssPath      string
+	nsenterPath string
+	killCmd     string
+)
+
+func init() {
+	flag.StringVar(&ssPath, "ss-path", "ss", "Path of the ss binary, locally and on -remote hosts")
+	flag.StringVar(&nsenterPath, "nsenter-path", "nsenter", "Path of the nsenter binary used by -all-netns")
+	flag.StringVar(&killCmd, "kill-cmd", "", "Command run instead of 'ss --kill' by the ss backend, e.g. for a patched iproute2. Placeholders: {local} {peer} {peer_ip} {peer_port} {inode} {pid}")
+}
+
+// placeholderPattern matches a {name} placeholder in a command template
+var placeholderPattern = regexp.MustCompile(`\{[a-z_]*\}`)
+
+// templatePlaceholders are the names expandProbeArgs fills in
+var templatePlaceholders = map[string]bool{
+	"{local}": true, "{peer}": true, "{peer_ip}": true, "{peer_port}": true, "{inode}": true, "{pid}": true,
+}
+
+// validateTools checks the tool paths and -kill-cmd at startup, so a typo
+// shows up now rather than as a failed kill hours later
+func validateTools() error {
+	if strings.ContainsAny(ssPath, " \t") || ssPath == "" {
+		return fmt.Errorf("-ss-path %q must be a single path", ssPath)
+	}
+	if killCmd == "" {
+		return nil
+	}
+	args := strings.Fields(killCmd)
+	if len(args) == 0 {
+		return fmt.Errorf("-kill-cmd is blank")
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return fmt.Errorf("-kill-cmd: %w", err)
+	}
+	used := placeholderPattern.FindAllString(killCmd, -1)
+	for _, p := range used {
+		if !templatePlaceholders[p] {
+			return fmt.Errorf("-kill-cmd: unknown placeholder %s", p)
+		}
+	}
+	if len(used) == 0 {
+		return fmt.Errorf("-kill-cmd must name the socket with a placeholder such as {peer} or {inode}")
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// parseTraffic fills the cumulative byte and segment counters printed by
+// 'ss -i'; ss omits counters that are still zero
+func (c *ConnectionInfo) parseTraffic(line string) {
+	c.BytesSent = fieldInt(line, "bytes_sent:")
+	c.BytesReceived = fieldInt(line, "bytes_received:")
+	c.SegsOut = fieldInt(line, "segs_out:")
+	c.SegsIn = fieldInt(line, "segs_in:")
+}
+
+// updateTraffic copies the counters of the latest listing and derives the
+// throughput since the previous sample and when traffic was last seen
+func (c *ConnectionInfo) updateTraffic(listed *ConnectionInfo, now time.Time) {
+	if c.trafficSampled.IsZero() || listed.BytesSent != c.BytesSent || listed.BytesReceived != c.BytesReceived {
+		c.LastTraffic = now
+	}
+	if !c.trafficSampled.IsZero() {
+		if elapsed := now.Sub(c.trafficSampled).Seconds(); elapsed > 0 {
+			c.SendRate = float64(max(listed.BytesSent-c.BytesSent, 0)) / elapsed
+			c.RecvRate = float64(max(listed.BytesReceived-c.BytesReceived, 0)) / elapsed
+		}
+	}
+	c.BytesSent = listed.BytesSent
+	c.BytesReceived = listed.BytesReceived
+	c.SegsOut = listed.SegsOut
+	c.SegsIn = listed.SegsIn
+	c.trafficSampled = now
+}
+
+// humanBytes formats a byte count with a binary unit
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10) + "B"
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return strconv.FormatFloat(float64(n)/float64(div), 'f', 1, 64) + string("KMGTPE"[exp]) + "iB"
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Unix domain sockets (-protocol unix) are listed with 'ss -x' by the path the
+// server is bound to. ss shows each address as a path (or "*") followed by a
+// socket inode, and its ino: field is the inode of the socket file on disk,
+// so these records get their own parser. The kernel can't destroy unix
+// sockets, so they are always shut down through the owner's fd.
+
+var errShutDown = errors.New("already shut down")
+
+// parseUnixRecord fills c from one 'ss -x' record laid out as format. The
+// addresses are kept as "path:inode", e.g. "/run/app.sock:4711 -> *:4710".
+func parseUnixRecord(line string, format *ssFormat, c *ConnectionInfo) error {
+	var fields [maxSSColumns]string
+	n := splitFields(line, fields[:])
+	if n < format.PeerCol+3 {
+		return fmt.Errorf("%w (%d)", errTooFewColumns, n)
+	}
+	path, ino := fields[format.LocalCol], fields[format.LocalCol+1]
+	peer, peerIno := fields[format.PeerCol+1], fields[format.PeerCol+2]
+	if leadingDigits(ino) != ino || ino == "0" {
+		return errNoInode
+	}
+	if leadingDigits(peerIno) != peerIno || peerIno == "" {
+		return fmt.Errorf("inode %s: %w %q", ino, errBadAddress, peer+" "+peerIno)
+	}
+	c.Inode = ino
+	c.LocalAddr = path + ":" + ino
+	c.PeerAddr = peer + ":" + peerIno
+
+	c.TCPState = "ESTAB"
+	if format.StateCol >= 0 {
+		c.TCPState = fields[format.StateCol]
+	}
+	// 'ss -e' marks the shutdown directions. A socket shut down both ways
+	// ("---") is dead already, only its owner has yet to close it; leaving it
+	// out of the listing also confirms our own kills.
+	if rest, ok := fieldValue(line, "---"); ok && rest == "" {
+		return fmt.Errorf("inode %s: %w", ino, errShutDown)
+	}
+	c.PID, c.FD, c.UID, c.SndWnd = -1, -1, -1, -1
+	if process, pid, fd, ok := parseUsers(line); ok {
+		c.Process, c.PID, c.FD = process, pid, fd
+	}
+	return nil
+}
+
+// attributeUnixPeers fills in the process at the other end of each unix
+// connection. The client ends aren't bound to the monitored path, so this
+// takes a second listing of every unix socket on host.
+func attributeUnixPeers(ctx context.Context, host, netns string, format *ssFormat, conns []*ConnectionInfo) error {
+	if len(conns) == 0 {
+		return nil
+	}
+	want := make(map[string][]*ConnectionInfo, len(conns))
+	for _, c := range conns {
+		ino := c.PeerAddr[strings.LastIndexByte(c.PeerAddr, ':')+1:]
+		want[ino] = append(want[ino], c)
+	}
+
+	opts := "-xnp"
+	if format.NoHeader {
+		opts += "H"
+	}
+	argv := nsCommand(netns, ssCommand(host, opts))
+	out, err := runner.Output(ctx, argv[0], argv[1:]...)
+	if err != nil {
+		return fmt.Errorf("listing unix socket owners: %w", err)
+	}
+	var fields [maxSSColumns]string
+	for _, line := range strings.Split(string(out), "\n") {
+		if splitFields(line, fields[:]) < format.LocalCol+2 {
+			continue
+		}
+		owned, ok := want[fields[format.LocalCol+1]]
+		if !ok {
+			continue
+		}
+		if process, pid, _, ok := parseUsers(line); ok {
+			for _, c := range owned {
+				c.PeerProcess, c.PeerPID = process, pid
+			}
+		}
+	}
+	return nil
+}
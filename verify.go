@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"log"
+)
+
+var verifyBeforeKill bool
+
+func init() {
+	flag.BoolVar(&verifyBeforeKill, "verify-before-kill", true, "Re-list connections right before killing and skip any whose inode no longer matches its addresses")
+}
+
+// verifyCandidates re-lists the port and keeps only the candidates whose inode
+// is still bound to the same local and peer address. A connection that closed
+// since the cycle's listing may have had its ports reused by a new one, which
+// the ss kill filter would otherwise destroy. If the re-listing fails, no kill
+// proceeds this cycle.
+func verifyCandidates(conns []*ConnectionInfo, reasons []KillReason) ([]*ConnectionInfo, []KillReason) {
+	if !verifyBeforeKill || len(conns) == 0 {
+		return conns, reasons
+	}
+
+	listed, _, err := listCurrentConnections(cycleContext())
+	if err != nil {
+		log.Printf("Error re-listing connections before kill, skipping %d kill(s): %v", len(conns), err)
+		return nil, nil
+	}
+	defer releaseConns(listed)
+	current := make(map[string]*ConnectionInfo, len(listed))
+	for _, c := range listed {
+		current[c.key()] = c
+	}
+
+	var keptConns []*ConnectionInfo
+	var keptReasons []KillReason
+	for i, conn := range conns {
+		now, ok := current[conn.key()]
+		if !ok || now.LocalAddr != conn.LocalAddr || now.PeerAddr != conn.PeerAddr {
+			infof(" = Skipping kill, connection gone or changed since listing (Inode %s): %s\n", conn.Inode, conn.ConnectionID)
+			continue
+		}
+		keptConns = append(keptConns, conn)
+		keptReasons = append(keptReasons, reasons[i])
+	}
+	return keptConns, keptReasons
+}
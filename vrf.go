@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	vrfDevice string
+	fwmark    string
+)
+
+func init() {
+	flag.StringVar(&vrfDevice, "vrf", "", "Only list and kill sockets bound to this VRF (or other) device")
+	flag.StringVar(&fwmark, "fwmark", "", "Only list and kill sockets carrying this firewall mark, as MARK or MARK/MASK (e.g. 0x10/0xff)")
+}
+
+// routingFilter returns the ss conditions confining listings and kills to
+// -vrf and -fwmark. ss ANDs them with the address conditions they follow.
+func routingFilter() []string {
+	var cond []string
+	if vrfDevice != "" {
+		cond = append(cond, "dev", vrfDevice)
+	}
+	if fwmark != "" {
+		cond = append(cond, "fwmark", fwmark)
+	}
+	return cond
+}
+
+// validateRouting checks -vrf and -fwmark. The device can only be looked up
+// when monitoring this machine.
+func validateRouting() error {
+	if protocol == "unix" && (vrfDevice != "" || fwmark != "") {
+		return fmt.Errorf("-vrf and -fwmark don't apply to -protocol unix")
+	}
+	if vrfDevice != "" && !remoteMode() {
+		if _, err := net.InterfaceByName(vrfDevice); err != nil {
+			return fmt.Errorf("-vrf %s: %w", vrfDevice, err)
+		}
+	}
+	if fwmark != "" {
+		mark, mask, hasMask := strings.Cut(fwmark, "/")
+		_, err := strconv.ParseUint(mark, 0, 32)
+		if err == nil && hasMask {
+			_, err = strconv.ParseUint(mask, 0, 32)
+		}
+		if err != nil {
+			return fmt.Errorf("-fwmark %q: expected MARK or MARK/MASK", fwmark)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	watchdogFactor  int
+	watchdogRestart bool
+)
+
+func init() {
+	flag.IntVar(&watchdogFactor, "watchdog-factor", 3, "Alert when a monitoring cycle hasn't completed within this many check intervals (0 disables the watchdog)")
+	flag.BoolVar(&watchdogRestart, "watchdog-restart", false, "Restart the monitor when a hung cycle does not recover after its commands are cancelled")
+}
+
+// cycleState tracks the running cycle for the watchdog. It has its own lock so a
+// cycle that deadlocks while holding mu can still be detected.
+var cycleState struct {
+	sync.Mutex
+	lastDone time.Time
+	cancel   context.CancelFunc
+	ctx      context.Context
+}
+
+// beginCycle creates the context that bounds the external commands of one cycle
+func beginCycle() {
+	cycleState.Lock()
+	defer cycleState.Unlock()
+	cycleState.ctx, cycleState.cancel = context.WithCancel(context.Background())
+}
+
+// endCycle records a completed cycle
+func endCycle() {
+	cycleState.Lock()
+	defer cycleState.Unlock()
+	cycleState.cancel()
+	cycleState.lastDone = clock.Now()
+}
+
+// cycleContext returns the context of the running cycle; cancelling it kills any
+// ss command the cycle is blocked on
+func cycleContext() context.Context {
+	cycleState.Lock()
+	defer cycleState.Unlock()
+	if cycleState.ctx == nil {
+		return context.Background()
+	}
+	return cycleState.ctx
+}
+
+// startWatchdog supervises the monitor loop. A cycle overdue by watchdogFactor
+// intervals has its goroutine stacks dumped to the log, an alert emitted and its
+// commands cancelled; if it is still hung at the next check, the process
+// re-executes itself when -watchdog-restart is set.
+func startWatchdog() {
+	if watchdogFactor <= 0 {
+		return
+	}
+
+	interval := minutes(checkIntervalMin)
+	limit := time.Duration(watchdogFactor) * interval
+
+	cycleState.Lock()
+	cycleState.lastDone = clock.Now()
+	cycleState.Unlock()
+
+	go func() {
+		ticker := clock.NewTicker(interval)
+		defer ticker.Stop()
+
+		var alerted time.Time
+		for range ticker.C() {
+			cycleState.Lock()
+			lastDone, cancel := cycleState.lastDone, cycleState.cancel
+			cycleState.Unlock()
+
+			overdue := clock.Now().Sub(lastDone)
+			if overdue <= limit {
+				continue
+			}
+
+			if alerted.Equal(lastDone) {
+				// Already reported and cancelled, and still no progress
+				if watchdogRestart {
+					restartSelf()
+				}
+				continue
+			}
+			alerted = lastDone
+
+			msg := fmt.Sprintf("no monitoring cycle completed for %s (limit %s)", overdue.Round(time.Second), limit)
+			log.Printf("Watchdog: %s; goroutine dump:\n%s", msg, goroutineStacks())
+			emitEvent(Event{Type: EventWatchdog, Message: msg})
+			if cancel != nil {
+				cancel()
+			}
+		}
+	}()
+}
+
+// goroutineStacks returns the stacks of all goroutines
+func goroutineStacks() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// restartSelf replaces the process with a fresh copy of itself. Tracked
+// connections are lost; they are rediscovered by the first cycle of the new process.
+func restartSelf() {
+	exe, err := os.Executable()
+	if err != nil {
+		log.Printf("Watchdog: cannot restart, executable not found: %v", err)
+		return
+	}
+	log.Printf("Watchdog: restarting %s", exe)
+	if err := syscall.Exec(exe, os.Args, os.Environ()); err != nil {
+		log.Printf("Watchdog: restart failed: %v", err)
+	}
+}